@@ -0,0 +1,314 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package audit records every write request a server receives, accepted or
+// rejected, to an append-only sink.
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	modbus_server "github.com/hootrhino/goodbusserver"
+	"github.com/hootrhino/goodbusserver/handler"
+	"github.com/hootrhino/goodbusserver/protocol"
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+// Record describes one write request and its outcome. Coil values are 0 or
+// 1. Table, OldValues and NewValues are empty for custom function codes.
+type Record struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	ConnID     uint64    `json:"conn_id,omitempty"`
+	UnitID     byte      `json:"unit_id"`
+	FuncCode   byte      `json:"func_code"`
+	Table      string    `json:"table,omitempty"`
+	Address    uint16    `json:"address"`
+	Quantity   uint16    `json:"quantity"`
+	// OldValues are the values before the write, see Middleware.
+	OldValues []uint16 `json:"old_values,omitempty"`
+	// NewValues are the values stored by an accepted write, or the values
+	// requested by a rejected one.
+	NewValues []uint16 `json:"new_values,omitempty"`
+	Accepted  bool     `json:"accepted"`
+	// Exception is the exception code sent for a rejected write, 0 when the
+	// request was dropped without a response.
+	Exception byte   `json:"exception,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Sink receives audit records. Write is called from every connection
+// goroutine and must be safe for concurrent use.
+type Sink interface {
+	Write(r Record) error
+}
+
+// SinkFunc adapts a function to Sink.
+type SinkFunc func(r Record) error
+
+// Write implements Sink.
+func (f SinkFunc) Write(r Record) error {
+	return f(r)
+}
+
+// Option configures the audit middleware.
+type Option func(*config)
+
+type config struct {
+	custom  []byte
+	onError func(error)
+}
+
+// WithCustomWrites also audits the custom function codes listed. Their
+// address and quantity are taken from the request as parsed by the server.
+func WithCustomWrites(codes ...byte) Option {
+	return func(c *config) {
+		c.custom = append(c.custom, codes...)
+	}
+}
+
+// WithErrorHandler sets a function called when the sink fails. The request
+// itself is not affected.
+func WithErrorHandler(fn func(error)) Option {
+	return func(c *config) {
+		c.onError = fn
+	}
+}
+
+// Middleware records every write request to sink. st must be the store the
+// server was created with.
+//
+// When st is a *store.ObservableStore, the old and new values are captured
+// by a write hook and a subscription, while the store serializes the write,
+// so writes from other connections never end up in a record. With any other
+// store they are read from the store of the request's unit just before and
+// after the write is handled, and a concurrent write may show through.
+//
+// A handler that panics is recorded as rejected before the panic goes on to
+// the server. Frames the server drops before the middleware chain are
+// audited by ParseFailures.
+func Middleware(sink Sink, st store.Store, opts ...Option) modbus_server.Middleware {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	var t *tracker
+	if obs, ok := st.(*store.ObservableStore); ok {
+		t = newTracker(obs)
+	}
+
+	return func(next modbus_server.HandlerFunc) modbus_server.HandlerFunc {
+		return func(ctx context.Context, req modbus_server.Request) (resp []byte, err error) {
+			custom := cfg.isCustom(req.FuncCode)
+			if !protocol.IsWriteFuncCode(req.FuncCode) && !custom {
+				return next(ctx, req)
+			}
+
+			rec := newRecord(ctx, req)
+			var w write
+			var c *capture
+			unit := store.StoreForUnit(st, req.SlaveID)
+			if !custom {
+				w = parseWrite(req)
+				rec.Table = w.table.String()
+				rec.Quantity = uint16(len(w.values))
+				if t != nil && rec.ConnID != 0 {
+					c = t.start(rec.ConnID, req.SlaveID, w.table, req.StartAddress)
+					defer t.stop(rec.ConnID, req.SlaveID)
+				} else {
+					rec.OldValues = readValues(unit, w.table, req.StartAddress, len(w.values))
+				}
+			}
+
+			defer func() {
+				if v := recover(); v != nil {
+					rec.Error = fmt.Sprintf("panic: %v", v)
+					rec.NewValues = w.values
+					if c != nil {
+						rec.OldValues = t.values(c).old
+					}
+					cfg.write(sink, rec)
+					panic(v)
+				}
+			}()
+
+			resp, err = next(ctx, req)
+
+			rec.Accepted = err == nil
+			if c != nil {
+				captured := t.values(c)
+				rec.OldValues = captured.old
+				if err == nil {
+					rec.NewValues = captured.new
+				}
+			}
+			if err != nil {
+				rec.Error = err.Error()
+				var exception *protocol.ModbusError
+				if errors.As(err, &exception) {
+					rec.Exception = exception.Code
+				}
+				rec.NewValues = w.values
+			} else if !custom && c == nil {
+				rec.NewValues = readValues(unit, w.table, req.StartAddress, len(w.values))
+			}
+
+			cfg.write(sink, rec)
+			return resp, err
+		}
+	}
+}
+
+// ParseFailures records the write requests among the frames the server
+// rejects before its middleware chain, such as a write single coil with an
+// invalid value, as rejected without a response. Register it with
+// Server.SetParseFailureHandler.
+func ParseFailures(sink Sink, opts ...Option) modbus_server.ParseFailureFunc {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return func(ctx context.Context, frame []byte, err error) {
+		// 帧太短时连功能码都没有，无法判断是否为写请求
+		if len(frame) < 8 {
+			return
+		}
+		req := modbus_server.Request{Frame: frame, SlaveID: frame[6], FuncCode: frame[7]}
+		custom := cfg.isCustom(req.FuncCode)
+		if !protocol.IsWriteFuncCode(req.FuncCode) && !custom {
+			return
+		}
+		if len(frame) >= 12 {
+			req.StartAddress = uint16(frame[8])<<8 | uint16(frame[9])
+			req.Quantity = uint16(frame[10])<<8 | uint16(frame[11])
+		}
+
+		rec := newRecord(ctx, req)
+		if !custom && len(frame) >= 12 {
+			w := parseWrite(req)
+			rec.Table = w.table.String()
+			rec.Quantity = uint16(len(w.values))
+			rec.NewValues = w.values
+		}
+		rec.Error = err.Error()
+		cfg.write(sink, rec)
+	}
+}
+
+// newRecord starts the record of a request.
+func newRecord(ctx context.Context, req modbus_server.Request) Record {
+	rec := Record{
+		Time:     time.Now(),
+		UnitID:   req.SlaveID,
+		FuncCode: req.FuncCode,
+		Address:  req.StartAddress,
+		Quantity: req.Quantity,
+	}
+	if info, ok := handler.ConnInfoFromContext(ctx); ok {
+		rec.ConnID = info.ID
+		if info.RemoteAddr != nil {
+			rec.RemoteAddr = info.RemoteAddr.String()
+		}
+	}
+	return rec
+}
+
+func (c *config) write(sink Sink, rec Record) {
+	if err := sink.Write(rec); err != nil && c.onError != nil {
+		c.onError(err)
+	}
+}
+
+func (c *config) isCustom(code byte) bool {
+	for _, custom := range c.custom {
+		if custom == code {
+			return true
+		}
+	}
+	return false
+}
+
+// write is the table and values requested by a standard write.
+type write struct {
+	table  store.Table
+	values []uint16
+}
+
+// parseWrite extracts the requested values of FC 05, 06, 0F and 10. The
+// server has already checked the frame lengths.
+func parseWrite(req modbus_server.Request) write {
+	f := req.Frame
+	switch req.FuncCode {
+	case protocol.FuncCodeWriteSingleCoil:
+		value := uint16(0)
+		if len(f) >= 12 && f[10] == 0xFF && f[11] == 0x00 {
+			value = 1
+		}
+		return write{table: store.TableCoils, values: []uint16{value}}
+	case protocol.FuncCodeWriteSingleRegister:
+		if len(f) < 12 {
+			return write{table: store.TableHoldingRegisters}
+		}
+		return write{table: store.TableHoldingRegisters, values: []uint16{uint16(f[10])<<8 | uint16(f[11])}}
+	case protocol.FuncCodeWriteMultipleCoils:
+		if len(f) < 13 {
+			return write{table: store.TableCoils}
+		}
+		bits := protocol.UnpackBits(f[13:], int(req.Quantity))
+		values := make([]uint16, len(bits))
+		for i, b := range bits {
+			values[i] = uint16(b)
+		}
+		return write{table: store.TableCoils, values: values}
+	case protocol.FuncCodeWriteMultipleRegisters:
+		values := make([]uint16, 0, req.Quantity)
+		for i := 13; i+1 < len(f) && len(values) < int(req.Quantity); i += 2 {
+			values = append(values, uint16(f[i])<<8|uint16(f[i+1]))
+		}
+		return write{table: store.TableHoldingRegisters, values: values}
+	}
+	return write{}
+}
+
+// readValues reads n values of a coil or holding register range, or
+// returns nil if the range cannot be read.
+func readValues(r store.Reader, table store.Table, start uint16, n int) []uint16 {
+	if n <= 0 || n > 0xFFFF {
+		return nil
+	}
+	switch table {
+	case store.TableCoils:
+		bits, err := r.GetCoils(start, uint16(n))
+		if err != nil {
+			return nil
+		}
+		values := make([]uint16, len(bits))
+		for i, b := range bits {
+			values[i] = uint16(min(b, 1))
+		}
+		return values
+	case store.TableHoldingRegisters:
+		values, err := r.GetHoldingRegisters(start, uint16(n))
+		if err != nil {
+			return nil
+		}
+		return values
+	}
+	return nil
+}
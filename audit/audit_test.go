@@ -0,0 +1,261 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package audit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+
+	modbus_server "github.com/hootrhino/goodbusserver"
+	"github.com/hootrhino/goodbusserver/handler"
+	"github.com/hootrhino/goodbusserver/protocol"
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+type memorySink struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+func (s *memorySink) Write(r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, r)
+	return nil
+}
+
+// handle runs the built-in handlers against st, as the server does.
+func handle(st store.Store) modbus_server.HandlerFunc {
+	handlers := map[byte]handler.Handler{
+		protocol.FuncCodeWriteSingleCoil:        &handler.SingleCoilHandler{},
+		protocol.FuncCodeWriteSingleRegister:    &handler.SingleRegisterHandler{},
+		protocol.FuncCodeWriteMultipleCoils:     &handler.MultipleCoilsHandler{},
+		protocol.FuncCodeWriteMultipleRegisters: &handler.MultipleRegistersHandler{},
+		protocol.FuncCodeReadHoldingRegisters:   &handler.HoldingRegistersHandler{},
+	}
+	return func(ctx context.Context, req modbus_server.Request) ([]byte, error) {
+		return handlers[req.FuncCode].Handle(ctx, handler.Request(req), st)
+	}
+}
+
+func request(frame []byte) modbus_server.Request {
+	return modbus_server.Request{
+		Frame:        frame,
+		SlaveID:      frame[6],
+		FuncCode:     frame[7],
+		StartAddress: uint16(frame[8])<<8 | uint16(frame[9]),
+		Quantity:     uint16(frame[10])<<8 | uint16(frame[11]),
+	}
+}
+
+func TestMiddleware_AcceptedWrites(t *testing.T) {
+	st := store.NewInMemoryStore()
+	st.SetHoldingRegistersAt(5, []uint16{1, 2})
+	sink := &memorySink{}
+	h := Middleware(sink, st)(handle(st))
+
+	ctx := handler.WithConnInfo(context.Background(), handler.ConnInfo{
+		ID:         4,
+		RemoteAddr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 9), Port: 40000},
+	})
+	// FC 10: write 0x000A, 0x000B to holding registers 5-6 of unit 3.
+	if _, err := h(ctx, request([]byte{0, 1, 0, 0, 0, 11, 3, 0x10, 0, 5, 0, 2, 4, 0, 0x0A, 0, 0x0B})); err != nil {
+		t.Fatalf("FC 10 error = %v", err)
+	}
+	// FC 05: switch coil 2 on.
+	if _, err := h(ctx, request([]byte{0, 2, 0, 0, 0, 6, 3, 0x05, 0, 2, 0xFF, 0})); err != nil {
+		t.Fatalf("FC 05 error = %v", err)
+	}
+	// Reads are not audited.
+	h(ctx, request([]byte{0, 3, 0, 0, 0, 6, 3, 0x03, 0, 5, 0, 2}))
+
+	if len(sink.records) != 2 {
+		t.Fatalf("got %d records, want 2", len(sink.records))
+	}
+	r := sink.records[0]
+	if r.RemoteAddr != "10.0.0.9:40000" || r.ConnID != 4 || r.UnitID != 3 || r.FuncCode != 0x10 {
+		t.Errorf("record identity = %+v", r)
+	}
+	if r.Table != "holding_registers" || r.Address != 5 || r.Quantity != 2 || !r.Accepted {
+		t.Errorf("record = %+v", r)
+	}
+	if !reflect.DeepEqual(r.OldValues, []uint16{1, 2}) || !reflect.DeepEqual(r.NewValues, []uint16{10, 11}) {
+		t.Errorf("values = %v -> %v, want [1 2] -> [10 11]", r.OldValues, r.NewValues)
+	}
+
+	coil := sink.records[1]
+	if coil.Table != "coils" || coil.Quantity != 1 || !reflect.DeepEqual(coil.OldValues, []uint16{0}) || !reflect.DeepEqual(coil.NewValues, []uint16{1}) {
+		t.Errorf("coil record = %+v", coil)
+	}
+}
+
+func TestMiddleware_RejectedWrite(t *testing.T) {
+	st := store.NewInMemoryStore(store.WithTableSize(store.TableHoldingRegisters, 10))
+	sink := &memorySink{}
+	h := Middleware(sink, st)(handle(st))
+
+	// FC 06 beyond the end of the table.
+	_, err := h(context.Background(), request([]byte{0, 1, 0, 0, 0, 6, 1, 0x06, 0, 20, 0x12, 0x34}))
+	if !errors.Is(err, protocol.ErrIllegalDataAddress) {
+		t.Fatalf("error = %v, want ErrIllegalDataAddress", err)
+	}
+
+	r := sink.records[0]
+	if r.Accepted || r.Exception != 0x02 || r.Error == "" {
+		t.Errorf("record = %+v, want a rejection with exception 0x02", r)
+	}
+	if r.OldValues != nil || !reflect.DeepEqual(r.NewValues, []uint16{0x1234}) {
+		t.Errorf("values = %v -> %v, want requested [4660]", r.OldValues, r.NewValues)
+	}
+}
+
+func TestMiddleware_CustomWrites(t *testing.T) {
+	st := store.NewInMemoryStore()
+	sink := &memorySink{}
+	sinkErr := errors.New("sink full")
+	var reported error
+	failing := SinkFunc(func(r Record) error {
+		sink.Write(r)
+		return sinkErr
+	})
+	ok := func(ctx context.Context, req modbus_server.Request) ([]byte, error) { return []byte{1}, nil }
+	h := Middleware(failing, st, WithCustomWrites(0x41), WithErrorHandler(func(err error) { reported = err }))(ok)
+
+	if resp, err := h(context.Background(), request([]byte{0, 1, 0, 0, 0, 6, 1, 0x41, 0, 7, 0, 3})); err != nil || len(resp) != 1 {
+		t.Fatalf("custom request = %v, %v; the sink must not affect the response", resp, err)
+	}
+	h(context.Background(), request([]byte{0, 2, 0, 0, 0, 6, 1, 0x42, 0, 7, 0, 3}))
+
+	if len(sink.records) != 1 {
+		t.Fatalf("got %d records, want only the listed custom code", len(sink.records))
+	}
+	r := sink.records[0]
+	if r.FuncCode != 0x41 || r.Address != 7 || r.Quantity != 3 || r.Table != "" || !r.Accepted {
+		t.Errorf("record = %+v", r)
+	}
+	if reported != sinkErr {
+		t.Errorf("error handler got %v, want %v", reported, sinkErr)
+	}
+}
+
+func TestMiddleware_ObservableStoreCapturesUnderWrite(t *testing.T) {
+	obs := store.NewObservableStore(store.NewInMemoryStore())
+	obs.SetHoldingRegistersAt(5, []uint16{1, 2})
+	sink := &memorySink{}
+	// The server binds the store to the request's origin.
+	next := func(ctx context.Context, req modbus_server.Request) ([]byte, error) {
+		info, _ := handler.ConnInfoFromContext(ctx)
+		ctx = store.WithOrigin(ctx, store.Origin{Source: store.SourceModbus, UnitID: req.SlaveID, ConnID: info.ID})
+		resp, err := handle(store.BindContext(obs, ctx))(ctx, req)
+		// Another writer gets in right after the request.
+		obs.SetHoldingRegistersAt(5, []uint16{99, 99})
+		return resp, err
+	}
+	h := Middleware(sink, obs)(next)
+
+	ctx := handler.WithConnInfo(context.Background(), handler.ConnInfo{ID: 4})
+	if _, err := h(ctx, request([]byte{0, 1, 0, 0, 0, 11, 3, 0x10, 0, 5, 0, 2, 4, 0, 0x0A, 0, 0x0B})); err != nil {
+		t.Fatal(err)
+	}
+	// Writing the values already stored changes nothing.
+	if _, err := h(ctx, request([]byte{0, 2, 0, 0, 0, 6, 3, 0x06, 0, 5, 0, 99})); err != nil {
+		t.Fatal(err)
+	}
+
+	r := sink.records[0]
+	if !reflect.DeepEqual(r.OldValues, []uint16{1, 2}) || !reflect.DeepEqual(r.NewValues, []uint16{10, 11}) {
+		t.Errorf("values = %v -> %v, want [1 2] -> [10 11]", r.OldValues, r.NewValues)
+	}
+	r = sink.records[1]
+	if !reflect.DeepEqual(r.OldValues, []uint16{99}) || !reflect.DeepEqual(r.NewValues, []uint16{99}) {
+		t.Errorf("unchanged write values = %v -> %v, want [99] -> [99]", r.OldValues, r.NewValues)
+	}
+}
+
+func TestMiddleware_ReleasesHooksBetweenWrites(t *testing.T) {
+	obs := store.NewObservableStore(store.NewInMemoryStore())
+	tr := newTracker(obs)
+
+	c := tr.start(4, 3, store.TableHoldingRegisters, 5)
+	if len(tr.remove) == 0 {
+		t.Fatal("no hooks registered while a write is in flight")
+	}
+	ctx := store.WithOrigin(context.Background(), store.Origin{Source: store.SourceModbus, UnitID: 3, ConnID: 4})
+	store.BindContext(obs, ctx).SetHoldingRegistersAt(5, []uint16{7})
+	if got := tr.values(c); !reflect.DeepEqual(got.new, []uint16{7}) {
+		t.Errorf("captured %v, want [7]", got.new)
+	}
+	tr.stop(4, 3)
+	if len(tr.remove) != 0 || tr.inFlight != 0 {
+		t.Fatalf("%d hooks left registered after the write", len(tr.remove))
+	}
+
+	// Middlewares built and dropped over the life of the store leave
+	// nothing behind: a hook still registered would see this write.
+	c = &capture{table: store.TableHoldingRegisters, start: 5}
+	tr.pending[captureKey{4, 3}] = c
+	store.BindContext(obs, ctx).SetHoldingRegistersAt(5, []uint16{8})
+	obs.Sync()
+	if c.seen || c.new != nil {
+		t.Errorf("write captured after the tracker stopped: %+v", *c)
+	}
+}
+
+func TestMiddleware_RecordsPanic(t *testing.T) {
+	sink := &memorySink{}
+	boom := func(ctx context.Context, req modbus_server.Request) ([]byte, error) { panic("boom") }
+	h := Middleware(sink, store.NewInMemoryStore())(boom)
+
+	func() {
+		defer func() {
+			if v := recover(); v != "boom" {
+				t.Errorf("recovered %v, want the handler's panic", v)
+			}
+		}()
+		h(context.Background(), request([]byte{0, 1, 0, 0, 0, 6, 1, 0x06, 0, 2, 0, 7}))
+	}()
+
+	if len(sink.records) != 1 {
+		t.Fatalf("got %d records, want 1", len(sink.records))
+	}
+	if r := sink.records[0]; r.Accepted || r.Error != "panic: boom" || !reflect.DeepEqual(r.NewValues, []uint16{7}) {
+		t.Errorf("record = %+v", r)
+	}
+}
+
+func TestParseFailures(t *testing.T) {
+	sink := &memorySink{}
+	record := ParseFailures(sink)
+	ctx := handler.WithConnInfo(context.Background(), handler.ConnInfo{ID: 2})
+
+	// FC 05 with a value other than 0x0000 and 0xFF00.
+	record(ctx, []byte{0, 1, 0, 0, 0, 6, 1, 0x05, 0, 3, 0x12, 0x34}, errors.New("invalid coil value"))
+	// Reads and runt frames are ignored.
+	record(ctx, []byte{0, 2, 0, 0, 0, 6, 1, 0x03, 0, 0, 0, 0}, errors.New("invalid quantity"))
+	record(ctx, []byte{0, 3, 0}, errors.New("invalid frame length"))
+
+	if len(sink.records) != 1 {
+		t.Fatalf("got %d records, want 1", len(sink.records))
+	}
+	r := sink.records[0]
+	if r.Accepted || r.Exception != 0 || r.ConnID != 2 || r.FuncCode != 0x05 || r.Table != "coils" || r.Address != 3 || r.Error != "invalid coil value" {
+		t.Errorf("record = %+v", r)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package audit
+
+import (
+	"sync"
+
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+// tracker captures the values of the writes in flight on an observable
+// store. The server handles the requests of a connection one at a time, so
+// a write is matched to its request by connection and unit.
+//
+// The hooks and subscriptions stay registered only while a write is in
+// flight, so a middleware that is dropped leaves nothing behind on the store.
+type tracker struct {
+	obs *store.ObservableStore
+
+	// regMu guards the registration and is never taken by the hooks, which
+	// run with the store's locks held.
+	regMu    sync.Mutex
+	inFlight int
+	remove   []func()
+
+	mu      sync.Mutex
+	pending map[captureKey]*capture
+}
+
+type captureKey struct {
+	conn uint64
+	unit byte
+}
+
+type capture struct {
+	table    store.Table
+	start    uint16
+	old, new []uint16
+	seen     bool
+}
+
+func newTracker(obs *store.ObservableStore) *tracker {
+	return &tracker{obs: obs, pending: make(map[captureKey]*capture)}
+}
+
+// register adds the hook and subscription capturing the writes to the coils
+// and holding registers; the caller holds regMu.
+func (t *tracker) register() {
+	for _, table := range []store.Table{store.TableCoils, store.TableHoldingRegisters} {
+		// 写入钩子在写锁内运行，旧值与写入严格对应
+		remove := t.obs.OnWrite(store.AllOf(table), func(req store.WriteRequest) ([]uint16, error) {
+			t.observe(req.Origin, req.Table, req.Address, func(c *capture) {
+				c.old = append([]uint16(nil), req.OldValues...)
+				c.new = append([]uint16(nil), req.OldValues...)
+				c.seen = true
+			})
+			return req.Values, nil
+		})
+		// 变更事件携带最终写入的值，包括其他钩子的转换结果
+		unsubscribe := t.obs.Subscribe(store.AllOf(table), func(ev store.ChangeEvent) {
+			t.observe(ev.Origin, ev.Table, ev.Address, func(c *capture) {
+				c.new = append([]uint16(nil), ev.NewValues...)
+			})
+		})
+		t.remove = append(t.remove, remove, unsubscribe)
+	}
+}
+
+func (t *tracker) observe(origin store.Origin, table store.Table, address uint16, fn func(c *capture)) {
+	if origin.Source != store.SourceModbus {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c, ok := t.pending[captureKey{origin.ConnID, origin.UnitID}]; ok && c.table == table && c.start == address {
+		fn(c)
+	}
+}
+
+// start begins capturing the write of a request; every start is paired
+// with a stop.
+func (t *tracker) start(conn uint64, unit byte, table store.Table, address uint16) *capture {
+	t.regMu.Lock()
+	if t.inFlight == 0 {
+		t.register()
+	}
+	t.inFlight++
+	t.regMu.Unlock()
+
+	c := &capture{table: table, start: address}
+	t.mu.Lock()
+	t.pending[captureKey{conn, unit}] = c
+	t.mu.Unlock()
+	return c
+}
+
+func (t *tracker) stop(conn uint64, unit byte) {
+	t.mu.Lock()
+	delete(t.pending, captureKey{conn, unit})
+	t.mu.Unlock()
+
+	t.regMu.Lock()
+	defer t.regMu.Unlock()
+	if t.inFlight--; t.inFlight == 0 {
+		for _, remove := range t.remove {
+			remove()
+		}
+		t.remove = nil
+	}
+}
+
+// values returns a copy of what was captured for c. Both are nil when the
+// write never reached the store. It waits for the store to deliver the
+// change events of the write first.
+func (t *tracker) values(c *capture) capture {
+	t.obs.Sync()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !c.seen {
+		return capture{}
+	}
+	return *c
+}
@@ -0,0 +1,183 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileOptions configures a FileSink. Zero fields disable the feature.
+type FileOptions struct {
+	// MaxSize rotates the file before a record would take it past MaxSize
+	// bytes.
+	MaxSize int64
+	// MaxBackups keeps only the newest MaxBackups rotated files.
+	MaxBackups int
+	// Sync flushes the file to disk after every record.
+	Sync bool
+}
+
+// FileSink appends records to a file as JSON lines. A rotated file is
+// renamed to the path followed by the time of rotation, for example
+// audit.jsonl.20250301T031400.000000000.
+type FileSink struct {
+	path string
+	opts FileOptions
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+var _ Sink = (*FileSink)(nil)
+
+// rename is os.Rename, replaced in tests.
+var rename = os.Rename
+
+// NewFileSink opens path for appending, creating it if needed.
+func NewFileSink(path string, opts FileOptions) (*FileSink, error) {
+	s := &FileSink{path: path, opts: opts}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	f, size, err := openAppend(s.path)
+	if err != nil {
+		return err
+	}
+	s.file, s.size = f, size
+	return nil
+}
+
+func openAppend(path string) (*os.File, int64, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+// Write implements Sink.
+func (s *FileSink) Write(r Record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	if s.opts.MaxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.opts.MaxSize {
+		if err := s.rotate(); err != nil {
+			// 轮转失败只影响这一条记录：继续写当前文件，写满 MaxSize 后再重试
+			s.size = 0
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if s.opts.Sync {
+		return s.file.Sync()
+	}
+	return nil
+}
+
+// rotate renames the current file and starts a new one; the caller holds
+// the lock. The current file stays open until the new one is, so a failed
+// rotation leaves the sink writing where it was.
+func (s *FileSink) rotate() error {
+	backup := s.path + "." + time.Now().UTC().Format("20060102T150405.000000000")
+	if err := rename(s.path, backup); err != nil {
+		return err
+	}
+	f, size, err := openAppend(s.path)
+	if err != nil {
+		// 新文件打不开时把备份改回原名，继续追加
+		if rename(backup, s.path) != nil {
+			s.size = 0
+		}
+		return err
+	}
+	old := s.file
+	s.file, s.size = f, size
+	if err := old.Close(); err != nil {
+		return err
+	}
+	return s.prune()
+}
+
+// prune removes the oldest rotated files beyond MaxBackups.
+func (s *FileSink) prune() error {
+	if s.opts.MaxBackups <= 0 {
+		return nil
+	}
+	backups, err := s.Backups()
+	if err != nil {
+		return err
+	}
+	for len(backups) > s.opts.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// Backups returns the rotated files, oldest first.
+func (s *FileSink) Backups() ([]string, error) {
+	backups, err := filepath.Glob(s.path + ".*T*")
+	if err != nil {
+		return nil, err
+	}
+	// 时间戳格式固定，字典序即时间顺序
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// Close syncs and closes the file.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Sync()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	s.file = nil
+	return err
+}
@@ -0,0 +1,156 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readLines(t *testing.T, path string) []Record {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestFileSink_AppendsJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewFileSink(path, FileOptions{Sync: true})
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	sink.Write(Record{FuncCode: 0x06, Address: 1, NewValues: []uint16{5}, Accepted: true})
+	sink.Close()
+
+	// Reopening appends.
+	sink, _ = NewFileSink(path, FileOptions{})
+	sink.Write(Record{FuncCode: 0x10, Address: 2, Exception: 0x02})
+	sink.Close()
+
+	records := readLines(t, path)
+	if len(records) != 2 || records[0].NewValues[0] != 5 || records[1].Exception != 0x02 {
+		t.Errorf("records = %+v", records)
+	}
+	if err := sink.Write(Record{}); err == nil {
+		t.Error("Write() after Close succeeded")
+	}
+}
+
+func TestFileSink_Rotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewFileSink(path, FileOptions{MaxSize: 200, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	defer sink.Close()
+
+	for i := 0; i < 20; i++ {
+		if err := sink.Write(Record{Time: time.Now(), Address: uint16(i), Accepted: true}); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		// 保证备份文件名的时间戳不同
+		time.Sleep(time.Millisecond)
+	}
+
+	backups, err := sink.Backups()
+	if err != nil {
+		t.Fatalf("Backups() error = %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("kept %d backups, want 2", len(backups))
+	}
+	info, _ := os.Stat(path)
+	if info.Size() > 200 {
+		t.Errorf("current file is %d bytes, want at most 200", info.Size())
+	}
+	current := readLines(t, path)
+	if last := current[len(current)-1]; last.Address != 19 {
+		t.Errorf("last record address = %d, want 19", last.Address)
+	}
+	older := readLines(t, backups[1])
+	if older[len(older)-1].Address != current[0].Address-1 {
+		t.Errorf("newest backup ends at %d, current file starts at %d", older[len(older)-1].Address, current[0].Address)
+	}
+}
+
+func TestFileSink_FailedRotationCostsOneWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewFileSink(path, FileOptions{MaxSize: 200, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	defer sink.Close()
+
+	failing := errors.New("rename failed")
+	rename = func(string, string) error { return failing }
+	defer func() { rename = os.Rename }()
+
+	// 写到触发轮转为止：失败的轮转只丢这一条
+	i := 0
+	for ; ; i++ {
+		err := sink.Write(Record{Time: time.Now(), Address: uint16(i), Accepted: true})
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, failing) {
+			t.Fatalf("Write() error = %v, want %v", err, failing)
+		}
+		break
+	}
+	i++
+	if err := sink.Write(Record{Time: time.Now(), Address: uint16(i), Accepted: true}); err != nil {
+		t.Fatalf("Write() after failed rotation error = %v", err)
+	}
+	current := readLines(t, path)
+	if last := current[len(current)-1]; last.Address != uint16(i) {
+		t.Errorf("last record address = %d, want %d", last.Address, i)
+	}
+
+	rename = os.Rename
+	for n := 0; n < 6; n++ {
+		i++
+		if err := sink.Write(Record{Time: time.Now(), Address: uint16(i), Accepted: true}); err != nil {
+			t.Fatalf("Write() after recovery error = %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	backups, err := sink.Backups()
+	if err != nil {
+		t.Fatalf("Backups() error = %v", err)
+	}
+	if len(backups) == 0 {
+		t.Error("no rotation after rename recovered")
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// SQLiteSink appends records to an audit_log table of a SQLite database,
+// usually the one of a store.SqliteStore, see SqliteStore.DB. Values are
+// stored as JSON arrays.
+type SQLiteSink struct {
+	db *sql.DB
+}
+
+var _ Sink = (*SQLiteSink)(nil)
+
+const auditSchema = `
+CREATE TABLE IF NOT EXISTS audit_log (
+	seq INTEGER PRIMARY KEY,
+	time INTEGER NOT NULL,
+	remote_addr TEXT NOT NULL,
+	conn_id INTEGER NOT NULL,
+	unit_id INTEGER NOT NULL,
+	func_code INTEGER NOT NULL,
+	table_name TEXT NOT NULL,
+	address INTEGER NOT NULL,
+	quantity INTEGER NOT NULL,
+	old_values TEXT,
+	new_values TEXT,
+	accepted INTEGER NOT NULL,
+	exception INTEGER NOT NULL,
+	error TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_log_time ON audit_log (time);
+`
+
+const auditColumns = "time, remote_addr, conn_id, unit_id, func_code, table_name, address, quantity, old_values, new_values, accepted, exception, error"
+
+// NewSQLiteSink creates the audit_log table in db if needed. The sink does
+// not close db.
+func NewSQLiteSink(db *sql.DB) (*SQLiteSink, error) {
+	if _, err := db.Exec(auditSchema); err != nil {
+		return nil, err
+	}
+	return &SQLiteSink{db: db}, nil
+}
+
+// Write implements Sink.
+func (s *SQLiteSink) Write(r Record) error {
+	oldValues, err := jsonValues(r.OldValues)
+	if err != nil {
+		return err
+	}
+	newValues, err := jsonValues(r.NewValues)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec("INSERT INTO audit_log ("+auditColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		r.Time.UnixNano(), r.RemoteAddr, int64(r.ConnID), r.UnitID, r.FuncCode, r.Table,
+		r.Address, r.Quantity, oldValues, newValues, r.Accepted, r.Exception, r.Error)
+	return err
+}
+
+// Records returns the records written from from to to, both inclusive,
+// oldest first.
+func (s *SQLiteSink) Records(from, to time.Time) ([]Record, error) {
+	rows, err := s.db.Query("SELECT "+auditColumns+" FROM audit_log WHERE time BETWEEN ? AND ? ORDER BY seq",
+		from.UnixNano(), to.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Record
+	for rows.Next() {
+		var (
+			r                    Record
+			ns, connID           int64
+			oldValues, newValues sql.NullString
+		)
+		err := rows.Scan(&ns, &r.RemoteAddr, &connID, &r.UnitID, &r.FuncCode, &r.Table,
+			&r.Address, &r.Quantity, &oldValues, &newValues, &r.Accepted, &r.Exception, &r.Error)
+		if err != nil {
+			return nil, err
+		}
+		r.Time = time.Unix(0, ns).UTC()
+		r.ConnID = uint64(connID)
+		if r.OldValues, err = parseValues(oldValues); err != nil {
+			return nil, err
+		}
+		if r.NewValues, err = parseValues(newValues); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func jsonValues(values []uint16) (sql.NullString, error) {
+	if values == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+func parseValues(s sql.NullString) ([]uint16, error) {
+	if !s.Valid {
+		return nil, nil
+	}
+	var values []uint16
+	err := json.Unmarshal([]byte(s.String), &values)
+	return values, err
+}
@@ -0,0 +1,61 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package audit
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+func TestSQLiteSink(t *testing.T) {
+	st, err := store.NewSqliteStore(":memory:")
+	if err != nil {
+		t.Fatalf("NewSqliteStore() error = %v", err)
+	}
+	defer st.Close()
+
+	sink, err := NewSQLiteSink(st.DB())
+	if err != nil {
+		t.Fatalf("NewSQLiteSink() error = %v", err)
+	}
+
+	t0 := time.Date(2025, 3, 1, 3, 14, 0, 0, time.UTC)
+	want := []Record{
+		{Time: t0, RemoteAddr: "10.0.0.9:40000", ConnID: 4, UnitID: 3, FuncCode: 0x10, Table: "holding_registers",
+			Address: 5, Quantity: 2, OldValues: []uint16{1, 2}, NewValues: []uint16{10, 11}, Accepted: true},
+		{Time: t0.Add(time.Second), UnitID: 3, FuncCode: 0x06, Table: "holding_registers",
+			Address: 20, Quantity: 1, NewValues: []uint16{7}, Exception: 0x02, Error: "Illegal data address"},
+	}
+	for _, r := range want {
+		if err := sink.Write(r); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	got, err := sink.Records(t0, t0.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Records() = %+v, want %+v", got, want)
+	}
+	if got, _ := sink.Records(t0.Add(time.Second), t0.Add(time.Second)); len(got) != 1 {
+		t.Errorf("Records() for one instant = %d records, want 1", len(got))
+	}
+}
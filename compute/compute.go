@@ -0,0 +1,468 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package compute derives registers from expressions over other registers,
+// to model simple device logic such as interlocks, alarms and totalizers
+// declaratively on top of a store.
+package compute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/hootrhino/goodbusserver/protocol"
+	"github.com/hootrhino/goodbusserver/store"
+	"github.com/hootrhino/goodbusserver/tag"
+)
+
+var (
+	// ErrInvalidPoint is returned by New for a point that cannot be computed.
+	ErrInvalidPoint = errors.New("compute: invalid point")
+	// ErrCycle is returned when points depend on each other in a loop.
+	ErrCycle = errors.New("compute: dependency cycle")
+	// ErrSelfReference is returned by Engine.Store for points that read
+	// their own value, which would accumulate on every poll.
+	ErrSelfReference = errors.New("compute: point reads its own value")
+	// ErrOutOfRange is returned when the value of a raw register point does
+	// not fit 16 bits, signed or unsigned.
+	ErrOutOfRange = errors.New("compute: value out of range")
+)
+
+// Point is a computed value written to a raw address, or to a tag when Tag
+// is set. A register receives the rounded value, negative values in two's
+// complement; a coil or discrete input is set while the value is not 0.
+type Point struct {
+	Table   store.Table `json:"table"`
+	Address uint16      `json:"address"`
+	Tag     string      `json:"tag,omitempty"`
+	Expr    string      `json:"expr"`
+}
+
+type point struct {
+	Point
+	expr   *Expr
+	table  store.Table
+	window store.Window
+	// target is the tag the value is written to, nil for raw points.
+	target *tag.Tag
+	// tags holds every tag the point reads or writes.
+	tags []tag.Tag
+	deps []dependency
+	mu   sync.Mutex
+}
+
+type dependency struct {
+	table  store.Table
+	window store.Window
+}
+
+func (p *point) String() string {
+	if p.target != nil {
+		return p.target.Name
+	}
+	return fmt.Sprintf("%s[%d]", p.table, p.Address)
+}
+
+// readsSelf reports whether the point reads its own value.
+func (p *point) readsSelf() bool {
+	for _, d := range p.deps {
+		if p.covers(d.table, d.window) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *point) covers(table store.Table, w store.Window) bool {
+	return table == p.table && w.Start <= p.window.End && w.End >= p.window.Start
+}
+
+// reads reports whether the point reads a value of q other than its own.
+func (p *point) reads(q *point) bool {
+	if p == q {
+		return false
+	}
+	for _, d := range p.deps {
+		if q.covers(d.table, d.window) {
+			return true
+		}
+	}
+	return false
+}
+
+// Engine holds a set of computed points. Use Store to compute them when
+// they are read, or Attach to recompute them when their inputs change.
+type Engine struct {
+	// OnError receives the errors of evaluations triggered by Attach.
+	OnError func(error)
+	points  []*point
+}
+
+// New compiles points. tags resolves the tag names used by expressions and
+// targets; it may be nil when only raw addresses are used. A point may read
+// its own value, for example to accumulate a total, when it is computed by
+// Attach; points may not otherwise depend on each other in a loop.
+func New(tags *tag.DB, points ...Point) (*Engine, error) {
+	e := &Engine{}
+	lookup := func(name string) (tag.Tag, error) {
+		if tags != nil {
+			if t, ok := tags.Tag(name); ok {
+				return t, nil
+			}
+		}
+		return tag.Tag{}, fmt.Errorf("%w: %s", tag.ErrUnknownTag, name)
+	}
+
+	for _, pt := range points {
+		p := &point{Point: pt, table: pt.Table, window: store.Window{Start: pt.Address, End: pt.Address}}
+		if pt.Tag != "" {
+			t, err := lookup(pt.Tag)
+			if err != nil {
+				return nil, fmt.Errorf("%w: target: %w", ErrInvalidPoint, err)
+			}
+			if t.Type == tag.String {
+				return nil, fmt.Errorf("%w: %s is a string tag", ErrInvalidPoint, t.Name)
+			}
+			p.target, p.table, p.window = &t, t.Table, t.Window()
+			p.tags = append(p.tags, t)
+		} else if pt.Table < store.TableCoils || pt.Table > store.TableInputRegisters {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidPoint, store.ErrInvalidTable)
+		}
+
+		expr, err := Compile(pt.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidPoint, p, err)
+		}
+		p.expr = expr
+		for _, ref := range expr.Refs() {
+			if ref.Tag == "" {
+				p.deps = append(p.deps, dependency{ref.Table, store.Window{Start: ref.Address, End: ref.Address}})
+				continue
+			}
+			t, err := lookup(ref.Tag)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", ErrInvalidPoint, p, err)
+			}
+			if t.Type == tag.String {
+				return nil, fmt.Errorf("%w: %s reads string tag %s", ErrInvalidPoint, p, t.Name)
+			}
+			p.deps = append(p.deps, dependency{t.Table, t.Window()})
+			p.tags = append(p.tags, t)
+		}
+		e.points = append(e.points, p)
+	}
+
+	if err := e.checkCycles(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// checkCycles fails when a point depends on itself through other points.
+func (e *Engine) checkCycles() error {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[*point]int)
+	var visit func(p *point) error
+	visit = func(p *point) error {
+		switch state[p] {
+		case visiting:
+			return fmt.Errorf("%w through %s", ErrCycle, p)
+		case done:
+			return nil
+		}
+		state[p] = visiting
+		for _, q := range e.points {
+			if p.reads(q) {
+				if err := visit(q); err != nil {
+					return err
+				}
+			}
+		}
+		state[p] = done
+		return nil
+	}
+	for _, p := range e.points {
+		if err := visit(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AccessRules returns read-only rules for the targets of the points, for
+// use in a store.AccessMap, so that Modbus clients cannot overwrite them.
+// Empty units applies the rules to every unit.
+func (e *Engine) AccessRules(units ...byte) []store.AccessRule {
+	rules := make([]store.AccessRule, 0, len(e.points))
+	for _, p := range e.points {
+		rules = append(rules, store.AccessRule{Units: units, Table: p.table, Window: p.window, Access: store.AccessReadOnly})
+	}
+	return rules
+}
+
+// storeEnv reads the inputs of a point from st, and its own value from
+// self.
+type storeEnv struct {
+	p        *point
+	st, self store.Store
+}
+
+func (e storeEnv) pick(table store.Table, w store.Window) store.Store {
+	if e.p.covers(table, w) {
+		return e.self
+	}
+	return e.st
+}
+
+func (e storeEnv) raw(table store.Table, address uint16) (float64, error) {
+	st := e.pick(table, store.Window{Start: address, End: address})
+	var v uint16
+	switch table {
+	case store.TableCoils, store.TableDiscreteInputs:
+		get := st.GetCoils
+		if table == store.TableDiscreteInputs {
+			get = st.GetDiscreteInputs
+		}
+		bits, err := get(address, 1)
+		if err != nil {
+			return 0, err
+		}
+		v = uint16(bits[0])
+	case store.TableHoldingRegisters:
+		values, err := st.GetHoldingRegisters(address, 1)
+		if err != nil {
+			return 0, err
+		}
+		v = values[0]
+	case store.TableInputRegisters:
+		values, err := st.GetInputRegisters(address, 1)
+		if err != nil {
+			return 0, err
+		}
+		v = values[0]
+	}
+	return float64(v), nil
+}
+
+func (e storeEnv) tag(name string) (float64, error) {
+	for _, t := range e.p.tags {
+		if t.Name == name {
+			db, err := tag.NewDB(e.pick(t.Table, t.Window()), t)
+			if err != nil {
+				return 0, err
+			}
+			return db.Read(name)
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", tag.ErrUnknownTag, name)
+}
+
+// evaluate computes p reading its inputs from st and its own value from
+// self, and writes the result to self.
+func (p *point) evaluate(st, self store.Store) error {
+	v, err := p.expr.eval(storeEnv{p: p, st: st, self: self})
+	if err != nil {
+		return fmt.Errorf("compute: %s: %w", p, err)
+	}
+	if err := p.write(self, v); err != nil {
+		return fmt.Errorf("compute: %s: %w", p, err)
+	}
+	return nil
+}
+
+func (p *point) write(st store.Store, v float64) error {
+	if p.target != nil {
+		db, err := tag.NewDB(st, *p.target)
+		if err != nil {
+			return err
+		}
+		return db.Write(p.target.Name, v)
+	}
+
+	switch p.table {
+	case store.TableCoils:
+		return st.SetCoilsAt(p.Address, []byte{byte(truth(v != 0))})
+	case store.TableDiscreteInputs:
+		return st.SetDiscreteInputsAt(p.Address, []byte{byte(truth(v != 0))})
+	}
+	raw := math.Round(v)
+	if math.IsNaN(raw) || raw < math.MinInt16 || raw > math.MaxUint16 {
+		return fmt.Errorf("%w: %v", ErrOutOfRange, v)
+	}
+	// 负数按补码写入，与 int16 寄存器一致
+	word := uint16(int64(raw))
+	if p.table == store.TableInputRegisters {
+		return st.SetInputRegistersAt(p.Address, []uint16{word})
+	}
+	return st.SetHoldingRegistersAt(p.Address, []uint16{word})
+}
+
+// Store computes the points in any range read through it before the read,
+// writing their values to st. Points read their inputs through the
+// returned store, so points derived from other points are computed in
+// turn. Writes and transactions go to st unchanged; reads inside Update see
+// the values last computed. An expression that fails makes the read fail
+// with exception 0x04. Points that read their own value are only supported
+// by Attach, since every poll would recompute them. When st is a
+// store.UnitStore, each unit computes the points from its own store.
+type Store struct {
+	store.Store
+	engine *Engine
+}
+
+var (
+	_ store.ContextStore = (*Store)(nil)
+	_ store.UnitStore    = (*Store)(nil)
+)
+
+// Store returns st computing the points on read. It fails with
+// ErrSelfReference when a point reads its own value.
+func (e *Engine) Store(st store.Store) (*Store, error) {
+	for _, p := range e.points {
+		if p.readsSelf() {
+			return nil, fmt.Errorf("%w: %s", ErrSelfReference, p)
+		}
+	}
+	return &Store{Store: st, engine: e}, nil
+}
+
+// WithContext implements store.ContextStore, so that writes keep the origin
+// of the request that made them.
+func (s *Store) WithContext(ctx context.Context) store.Store {
+	return &Store{Store: store.BindContext(s.Store, ctx), engine: s.engine}
+}
+
+// Units implements store.UnitStore. It is empty unless the wrapped store is
+// a UnitStore.
+func (s *Store) Units() []byte {
+	if us, ok := s.Store.(store.UnitStore); ok {
+		return us.Units()
+	}
+	return nil
+}
+
+// Unit implements store.UnitStore, returning the store of the unit
+// computing the same points.
+func (s *Store) Unit(id byte) (store.Store, bool) {
+	us, ok := s.Store.(store.UnitStore)
+	if !ok {
+		return nil, false
+	}
+	unit, ok := us.Unit(id)
+	if !ok {
+		return nil, false
+	}
+	return &Store{Store: unit, engine: s.engine}, true
+}
+
+func (s *Store) refresh(table store.Table, start uint16, quantity int) error {
+	if quantity <= 0 {
+		return nil
+	}
+	w := store.Window{Start: start, End: uint16(min(int(start)+quantity-1, 0xFFFF))}
+	for _, p := range s.engine.points {
+		if !p.covers(table, w) {
+			continue
+		}
+		// 串行计算同一点位，避免并发读取时旧结果覆盖新结果
+		p.mu.Lock()
+		err := p.evaluate(s, s.Store)
+		p.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("%w: %w", err, protocol.ErrServerDeviceFailure)
+		}
+	}
+	return nil
+}
+
+// GetCoils implements Store.
+func (s *Store) GetCoils(start, quantity uint16) ([]byte, error) {
+	if err := s.refresh(store.TableCoils, start, int(quantity)); err != nil {
+		return nil, err
+	}
+	return s.Store.GetCoils(start, quantity)
+}
+
+// GetDiscreteInputs implements Store.
+func (s *Store) GetDiscreteInputs(start, quantity uint16) ([]byte, error) {
+	if err := s.refresh(store.TableDiscreteInputs, start, int(quantity)); err != nil {
+		return nil, err
+	}
+	return s.Store.GetDiscreteInputs(start, quantity)
+}
+
+// GetHoldingRegisters implements Store.
+func (s *Store) GetHoldingRegisters(start, quantity uint16) ([]uint16, error) {
+	if err := s.refresh(store.TableHoldingRegisters, start, int(quantity)); err != nil {
+		return nil, err
+	}
+	return s.Store.GetHoldingRegisters(start, quantity)
+}
+
+// GetInputRegisters implements Store.
+func (s *Store) GetInputRegisters(start, quantity uint16) ([]uint16, error) {
+	if err := s.refresh(store.TableInputRegisters, start, int(quantity)); err != nil {
+		return nil, err
+	}
+	return s.Store.GetInputRegisters(start, quantity)
+}
+
+// Attach computes every point now and again whenever one of its inputs in
+// obs changes, writing the values to obs. A change of a point's own value
+// alone does not recompute it, so a point that reads itself accumulates
+// once per change of its other inputs. Errors after the first computation
+// go to OnError. detach stops the recomputation.
+func (e *Engine) Attach(obs *store.ObservableStore) (detach func(), err error) {
+	var unsubscribe []func()
+	detach = func() {
+		for _, fn := range unsubscribe {
+			fn()
+		}
+	}
+
+	for _, p := range e.points {
+		for _, d := range p.deps {
+			if p.covers(d.table, d.window) {
+				continue
+			}
+			unsubscribe = append(unsubscribe, obs.Subscribe(store.Filter{Table: d.table, Start: d.window.Start, End: d.window.End}, func(store.ChangeEvent) {
+				p.mu.Lock()
+				err := p.evaluate(obs, obs)
+				p.mu.Unlock()
+				if err != nil && e.OnError != nil {
+					e.OnError(err)
+				}
+			}))
+		}
+	}
+
+	for _, p := range e.points {
+		p.mu.Lock()
+		err := p.evaluate(obs, obs)
+		p.mu.Unlock()
+		if err != nil {
+			detach()
+			return nil, err
+		}
+	}
+	return detach, nil
+}
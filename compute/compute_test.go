@@ -0,0 +1,354 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package compute
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/hootrhino/goodbusserver/protocol"
+	"github.com/hootrhino/goodbusserver/store"
+	"github.com/hootrhino/goodbusserver/tag"
+)
+
+func newTags(t *testing.T, st store.Store) *tag.DB {
+	t.Helper()
+	db, err := tag.NewDB(st,
+		tag.Tag{Name: "temperature", Table: store.TableInputRegisters, Address: 10, Type: tag.Int16, Scale: 0.1},
+		tag.Tag{Name: "setpoint", Table: store.TableHoldingRegisters, Address: 10, Type: tag.Int16, Scale: 0.1},
+		tag.Tag{Name: "power", Table: store.TableInputRegisters, Address: 20, Type: tag.Float32},
+		tag.Tag{Name: "label", Table: store.TableHoldingRegisters, Address: 30, Type: tag.String, Length: 4},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestStore_ComputesOnRead(t *testing.T) {
+	st := store.NewInMemoryStore()
+	tags := newTags(t, st)
+	e, err := New(tags,
+		Point{Table: store.TableCoils, Address: 0, Expr: "ir[0] > hr[0]"},
+		Point{Table: store.TableDiscreteInputs, Address: 1, Expr: "temperature > setpoint"},
+		// 链式点位：依赖上面两个计算结果
+		Point{Table: store.TableInputRegisters, Address: 5, Expr: "co[0] + di[1] * 2"},
+		Point{Tag: "power", Expr: "ir[0] * 1.5"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, err := e.Store(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st.SetInputRegistersAt(0, []uint16{120})
+	st.SetHoldingRegistersAt(0, []uint16{100})
+	tags.Write("temperature", 85)
+	tags.Write("setpoint", 80)
+
+	if got, _ := cs.GetCoils(0, 1); got[0] != 1 {
+		t.Errorf("co[0] = %d; want 1", got[0])
+	}
+	if got, _ := cs.GetDiscreteInputs(0, 2); got[1] != 1 {
+		t.Errorf("di[1] = %d; want 1", got[1])
+	}
+	if got, _ := cs.GetInputRegisters(5, 1); got[0] != 3 {
+		t.Errorf("ir[5] = %d; want 3", got[0])
+	}
+
+	st.SetHoldingRegistersAt(0, []uint16{200})
+	tags.Write("setpoint", 90)
+	if got, _ := cs.GetInputRegisters(0, 6); got[5] != 0 {
+		t.Errorf("ir[5] = %d after inputs fell; want 0", got[5])
+	}
+
+	// 只读到点位的一部分也会触发计算
+	if _, err := cs.GetInputRegisters(21, 1); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := tags.Read("power"); v != 180 {
+		t.Errorf("power = %v; want 180", v)
+	}
+}
+
+func TestStore_Units(t *testing.T) {
+	def, unit := store.NewInMemoryStore(), store.NewInMemoryStore()
+	units := store.NewUnitMap(def)
+	units.Set(2, unit)
+	e, err := New(nil, Point{Table: store.TableInputRegisters, Address: 1, Expr: "hr[0] * 2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, err := e.Store(units)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def.SetHoldingRegistersAt(0, []uint16{5})
+	unit.SetHoldingRegistersAt(0, []uint16{7})
+
+	if ids := cs.Units(); len(ids) != 1 || ids[0] != 2 {
+		t.Fatalf("Units() = %v; want [2]", ids)
+	}
+	// 服务器按请求的单元取存储，每个单元用自己的寄存器计算
+	if got, _ := store.StoreForUnit(cs, 2).GetInputRegisters(1, 1); got[0] != 14 {
+		t.Errorf("unit 2 ir[1] = %d; want 14", got[0])
+	}
+	if got, _ := def.GetInputRegisters(1, 1); got[0] != 0 {
+		t.Errorf("unit 2 read wrote the default store: ir[1] = %d", got[0])
+	}
+	if got, _ := store.StoreForUnit(cs, 9).GetInputRegisters(1, 1); got[0] != 10 {
+		t.Errorf("default ir[1] = %d; want 10", got[0])
+	}
+}
+
+func TestStore_NegativeAndOutOfRange(t *testing.T) {
+	st := store.NewInMemoryStore()
+	e, err := New(nil,
+		Point{Table: store.TableHoldingRegisters, Address: 1, Expr: "hr[0] - 100"},
+		Point{Table: store.TableHoldingRegisters, Address: 2, Expr: "hr[0] * 2000"},
+		Point{Table: store.TableHoldingRegisters, Address: 3, Expr: "1 / hr[0]"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, err := e.Store(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st.SetHoldingRegistersAt(0, []uint16{40})
+	if got, err := cs.GetHoldingRegisters(1, 1); err != nil || int16(got[0]) != -60 {
+		t.Errorf("hr[1] = %d, %v; want -60", int16(got[0]), err)
+	}
+	_, err = cs.GetHoldingRegisters(2, 1)
+	if !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("hr[2] error = %v; want ErrOutOfRange", err)
+	}
+	var me *protocol.ModbusError
+	if !errors.As(err, &me) || me.Code != 0x04 {
+		t.Errorf("hr[2] error = %v; want exception 0x04", err)
+	}
+
+	st.SetHoldingRegistersAt(0, []uint16{0})
+	if _, err := cs.GetHoldingRegisters(3, 1); !errors.Is(err, ErrDivisionByZero) {
+		t.Errorf("hr[3] error = %v; want ErrDivisionByZero", err)
+	}
+	// 不涉及计算点位的读取不受影响
+	if _, err := cs.GetHoldingRegisters(0, 1); err != nil {
+		t.Errorf("hr[0] error = %v", err)
+	}
+}
+
+func TestStore_ConcurrentReads(t *testing.T) {
+	st := store.NewInMemoryStore()
+	e, err := New(nil,
+		Point{Table: store.TableHoldingRegisters, Address: 1, Expr: "hr[0] * 2"},
+		Point{Table: store.TableHoldingRegisters, Address: 2, Expr: "hr[1] + 1"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, err := e.Store(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.SetHoldingRegistersAt(0, []uint16{10})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if got, err := cs.GetHoldingRegisters(0, 3); err != nil || got[1] != 20 || got[2] != 21 {
+					t.Errorf("read = %v, %v; want [10 20 21]", got, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestStore_RejectsSelfReference(t *testing.T) {
+	st := store.NewInMemoryStore()
+	e, err := New(nil,
+		Point{Table: store.TableHoldingRegisters, Address: 20, Expr: "hr[20] + (di[0] ? 1 : 0)"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Store(st); !errors.Is(err, ErrSelfReference) {
+		t.Fatalf("Store error = %v; want ErrSelfReference", err)
+	}
+
+	// Polled twice and from several connections, an attached totalizer only
+	// counts changes of its input.
+	obs := store.NewObservableStore(st)
+	detach, err := e.Attach(obs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer detach()
+	obs.SetDiscreteInputsAt(0, []byte{1})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 2; j++ {
+				obs.GetHoldingRegisters(20, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got, _ := obs.GetHoldingRegisters(20, 1); got[0] != 1 {
+		t.Errorf("hr[20] = %d after polls; want 1", got[0])
+	}
+}
+
+func TestAttach(t *testing.T) {
+	obs := store.NewObservableStore(store.NewInMemoryStore())
+	tags := newTags(t, obs)
+	e, err := New(tags,
+		Point{Table: store.TableCoils, Address: 0, Expr: "temperature > setpoint"},
+		Point{Table: store.TableCoils, Address: 1, Expr: "!co[0]"},
+		// 脉冲累计：每次 di[0] 变化时累加
+		Point{Table: store.TableHoldingRegisters, Address: 20, Expr: "hr[20] + (di[0] ? 1 : 0)"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []error
+	e.OnError = func(err error) { errs = append(errs, err) }
+
+	tags.Write("setpoint", 50)
+	detach, err := e.Attach(obs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	coils := func() []byte {
+		v, _ := obs.GetCoils(0, 2)
+		return v
+	}
+	if got := coils(); got[0] != 0 || got[1] != 1 {
+		t.Errorf("coils = %v initially; want [0 1]", got)
+	}
+	tags.Write("temperature", 60)
+	if got := coils(); got[0] != 1 || got[1] != 0 {
+		t.Errorf("coils = %v after temperature rose; want [1 0]", got)
+	}
+
+	for _, v := range []byte{1, 0, 1, 0, 1} {
+		obs.SetDiscreteInputsAt(0, []byte{v})
+	}
+	if got, _ := obs.GetHoldingRegisters(20, 1); got[0] != 3 {
+		t.Errorf("hr[20] = %d; want 3 pulses", got[0])
+	}
+
+	detach()
+	tags.Write("temperature", 40)
+	if got := coils(); got[0] != 1 {
+		t.Errorf("coils = %v after detach; want unchanged", got)
+	}
+	if len(errs) != 0 {
+		t.Errorf("OnError got %v", errs)
+	}
+}
+
+func TestAttach_ReportsErrors(t *testing.T) {
+	obs := store.NewObservableStore(store.NewInMemoryStore())
+	e, err := New(nil, Point{Table: store.TableHoldingRegisters, Address: 1, Expr: "100 / hr[0]"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Attach(obs); !errors.Is(err, ErrDivisionByZero) {
+		t.Fatalf("Attach error = %v; want ErrDivisionByZero", err)
+	}
+
+	obs.SetHoldingRegistersAt(0, []uint16{4})
+	var errs []error
+	e.OnError = func(err error) { errs = append(errs, err) }
+	detach, err := e.Attach(obs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer detach()
+	obs.SetHoldingRegistersAt(0, []uint16{0})
+	if len(errs) != 1 || !errors.Is(errs[0], ErrDivisionByZero) {
+		t.Errorf("OnError got %v; want one ErrDivisionByZero", errs)
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	tags := newTags(t, store.NewInMemoryStore())
+	tests := []struct {
+		name   string
+		points []Point
+		want   error
+	}{
+		{"syntax", []Point{{Table: store.TableCoils, Expr: "1 +"}}, ErrSyntax},
+		{"unknown tag", []Point{{Table: store.TableCoils, Expr: "pressure > 1"}}, tag.ErrUnknownTag},
+		{"unknown target", []Point{{Tag: "pressure", Expr: "1"}}, tag.ErrUnknownTag},
+		{"string target", []Point{{Tag: "label", Expr: "1"}}, ErrInvalidPoint},
+		{"string input", []Point{{Table: store.TableCoils, Expr: "label"}}, ErrInvalidPoint},
+		{"bad table", []Point{{Table: 7, Expr: "1"}}, store.ErrInvalidTable},
+		{"cycle", []Point{
+			{Table: store.TableHoldingRegisters, Address: 0, Expr: "hr[1] + 1"},
+			{Table: store.TableHoldingRegisters, Address: 1, Expr: "hr[2]"},
+			{Table: store.TableHoldingRegisters, Address: 2, Expr: "hr[0]"},
+		}, ErrCycle},
+		{"cycle through tag", []Point{
+			{Tag: "setpoint", Expr: "hr[0]"},
+			{Table: store.TableHoldingRegisters, Address: 0, Expr: "setpoint"},
+		}, ErrCycle},
+	}
+	for _, tt := range tests {
+		if _, err := New(tags, tt.points...); !errors.Is(err, tt.want) {
+			t.Errorf("%s: error = %v; want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if _, err := New(tags, Point{Table: store.TableHoldingRegisters, Address: 0, Expr: "hr[0] + 1"}); err != nil {
+		t.Errorf("self reference: error = %v", err)
+	}
+}
+
+func TestEngine_AccessRules(t *testing.T) {
+	tags := newTags(t, store.NewInMemoryStore())
+	e, err := New(tags,
+		Point{Table: store.TableCoils, Address: 3, Expr: "1"},
+		Point{Tag: "setpoint", Expr: "20"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := store.NewAccessMap(e.AccessRules(1)...)
+	if got := m.Access(1, store.TableCoils, 3, 1); got != store.AccessReadOnly {
+		t.Errorf("coil 3 access = %v; want read-only", got)
+	}
+	if got := m.Access(1, store.TableHoldingRegisters, 10, 1); got != store.AccessReadOnly {
+		t.Errorf("setpoint access = %v; want read-only", got)
+	}
+	if got := m.Access(2, store.TableHoldingRegisters, 10, 1); got != store.AccessReadWrite {
+		t.Errorf("setpoint access on unit 2 = %v; want read-write", got)
+	}
+}
@@ -0,0 +1,534 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package compute
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+var (
+	// ErrSyntax is returned by Compile for a malformed expression.
+	ErrSyntax = errors.New("compute: syntax error")
+	// ErrDivisionByZero is returned when an expression divides, or takes
+	// the remainder, by 0.
+	ErrDivisionByZero = errors.New("compute: division by zero")
+)
+
+// tableNames are the prefixes of raw register references, such as hr[100].
+var tableNames = map[string]store.Table{
+	"co": store.TableCoils,
+	"di": store.TableDiscreteInputs,
+	"hr": store.TableHoldingRegisters,
+	"ir": store.TableInputRegisters,
+}
+
+// functions maps the built-in functions to their minimum and maximum
+// number of arguments; -1 means any number.
+var functions = map[string][2]int{
+	"abs":   {1, 1},
+	"round": {1, 1},
+	"min":   {1, -1},
+	"max":   {1, -1},
+	"clamp": {3, 3},
+	"bit":   {2, 2},
+}
+
+// precedence of the binary operators; higher binds tighter.
+var precedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"|":  3,
+	"^":  4,
+	"&":  5,
+	"==": 6, "!=": 6,
+	"<": 7, "<=": 7, ">": 7, ">=": 7,
+	"<<": 8, ">>": 8,
+	"+": 9, "-": 9,
+	"*": 10, "/": 10, "%": 10,
+}
+
+// Ref is a value an expression reads: a raw address, or a tag when Tag is
+// set.
+type Ref struct {
+	Table   store.Table
+	Address uint16
+	Tag     string
+}
+
+// Expr is a compiled expression. Values are float64; comparisons and
+// logical operators yield 1 or 0 and any value other than 0 is true. Bit
+// operators work on the integer part.
+type Expr struct {
+	src  string
+	root node
+	refs []Ref
+}
+
+// Compile parses an expression. The syntax is that of C expressions over
+// numbers, raw references such as hr[100], ir[0], co[3] and di[2], tag names
+// and the functions abs, round, min, max, clamp(x, lo, hi) and bit(x, n).
+func Compile(src string) (*Expr, error) {
+	p := &parser{src: src}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseCond()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+	return &Expr{src: src, root: root, refs: p.refs}, nil
+}
+
+// String returns the source of the expression.
+func (x *Expr) String() string {
+	return x.src
+}
+
+// Refs returns the values the expression reads, in order of appearance.
+func (x *Expr) Refs() []Ref {
+	return append([]Ref(nil), x.refs...)
+}
+
+// env resolves the references of an expression.
+type env interface {
+	raw(table store.Table, address uint16) (float64, error)
+	tag(name string) (float64, error)
+}
+
+func (x *Expr) eval(e env) (float64, error) {
+	return x.root.eval(e)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNum
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	pos  int
+}
+
+type parser struct {
+	src    string
+	tokens []token
+	next   int
+	refs   []Ref
+}
+
+func (p *parser) errorf(tok token, format string, args ...any) error {
+	return fmt.Errorf("%w at %d: %s", ErrSyntax, tok.pos+1, fmt.Sprintf(format, args...))
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func (p *parser) lex() error {
+	src := p.src
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c >= '0' && c <= '9' || c == '.':
+			j := i + 1
+			for j < len(src) && isIdentChar(src[j]) {
+				// 指数部分的符号，如 1e-3
+				if (src[j] == 'e' || src[j] == 'E') && !strings.HasPrefix(src[i:], "0x") &&
+					j+1 < len(src) && (src[j+1] == '+' || src[j+1] == '-') {
+					j++
+				}
+				j++
+			}
+			text := src[i:j]
+			num, err := parseNumber(text)
+			if err != nil {
+				return p.errorf(token{pos: i}, "bad number %q", text)
+			}
+			p.tokens = append(p.tokens, token{kind: tokNum, text: text, num: num, pos: i})
+			i = j
+		case isIdentChar(c):
+			j := i + 1
+			for j < len(src) && isIdentChar(src[j]) {
+				j++
+			}
+			p.tokens = append(p.tokens, token{kind: tokIdent, text: src[i:j], pos: i})
+			i = j
+		default:
+			op := ""
+			for _, candidate := range []string{"<<", ">>", "<=", ">=", "==", "!=", "&&", "||"} {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				if !strings.ContainsRune("+-*/%&|^~<>!?:()[],", rune(c)) {
+					return p.errorf(token{pos: i}, "unexpected character %q", c)
+				}
+				op = string(c)
+			}
+			p.tokens = append(p.tokens, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	p.tokens = append(p.tokens, token{kind: tokEOF, text: "end of expression", pos: len(src)})
+	return nil
+}
+
+func parseNumber(text string) (float64, error) {
+	if n, err := strconv.ParseUint(text, 0, 64); err == nil {
+		return float64(n), nil
+	}
+	return strconv.ParseFloat(text, 64)
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	tok := p.tokens[p.next]
+	if tok.kind != tokEOF {
+		p.next++
+	}
+	return tok
+}
+
+func (p *parser) isOp(text string) bool {
+	tok := p.peek()
+	return tok.kind == tokOp && tok.text == text
+}
+
+func (p *parser) expect(text string) error {
+	if tok := p.advance(); tok.kind != tokOp || tok.text != text {
+		return p.errorf(tok, "expected %q, found %q", text, tok.text)
+	}
+	return nil
+}
+
+// parseCond parses c ? a : b, which binds loosest.
+func (p *parser) parseCond() (node, error) {
+	c, err := p.parseBinary(1)
+	if err != nil || !p.isOp("?") {
+		return c, err
+	}
+	p.advance()
+	a, err := p.parseCond()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	b, err := p.parseCond()
+	if err != nil {
+		return nil, err
+	}
+	return condNode{c, a, b}, nil
+}
+
+func (p *parser) parseBinary(minPrec int) (node, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		prec := precedence[tok.text]
+		if tok.kind != tokOp || prec == 0 || prec < minPrec {
+			return x, nil
+		}
+		p.advance()
+		y, err := p.parseBinary(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = binaryNode{tok.text, x, y}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	tok := p.peek()
+	if tok.kind == tokOp && strings.Contains("-+!~", tok.text) {
+		p.advance()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{tok.text, x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.advance()
+	switch tok.kind {
+	case tokNum:
+		return numNode(tok.num), nil
+	case tokOp:
+		if tok.text != "(" {
+			break
+		}
+		x, err := p.parseCond()
+		if err != nil {
+			return nil, err
+		}
+		return x, p.expect(")")
+	case tokIdent:
+		if table, ok := tableNames[tok.text]; ok && p.isOp("[") {
+			return p.parseRef(table)
+		}
+		if p.isOp("(") {
+			return p.parseCall(tok)
+		}
+		switch tok.text {
+		case "true":
+			return numNode(1), nil
+		case "false":
+			return numNode(0), nil
+		}
+		p.refs = append(p.refs, Ref{Tag: tok.text})
+		return tagNode(tok.text), nil
+	}
+	return nil, p.errorf(tok, "unexpected %q", tok.text)
+}
+
+func (p *parser) parseRef(table store.Table) (node, error) {
+	p.advance() // [
+	tok := p.advance()
+	if tok.kind != tokNum || tok.num != math.Trunc(tok.num) || tok.num < 0 || tok.num > 0xFFFF {
+		return nil, p.errorf(tok, "address must be an integer from 0 to 65535")
+	}
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+	ref := Ref{Table: table, Address: uint16(tok.num)}
+	p.refs = append(p.refs, ref)
+	return refNode(ref), nil
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	arity, ok := functions[name.text]
+	if !ok {
+		return nil, p.errorf(name, "unknown function %q", name.text)
+	}
+	p.advance() // (
+	var args []node
+	for !p.isOp(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseCond()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.advance() // )
+	if len(args) < arity[0] || arity[1] >= 0 && len(args) > arity[1] {
+		return nil, p.errorf(name, "wrong number of arguments to %s", name.text)
+	}
+	return callNode{name.text, args}, nil
+}
+
+type node interface {
+	eval(e env) (float64, error)
+}
+
+type numNode float64
+
+func (n numNode) eval(env) (float64, error) { return float64(n), nil }
+
+type refNode Ref
+
+func (n refNode) eval(e env) (float64, error) { return e.raw(n.Table, n.Address) }
+
+type tagNode string
+
+func (n tagNode) eval(e env) (float64, error) { return e.tag(string(n)) }
+
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type unaryNode struct {
+	op string
+	x  node
+}
+
+func (n unaryNode) eval(e env) (float64, error) {
+	x, err := n.x.eval(e)
+	if err != nil {
+		return 0, err
+	}
+	switch n.op {
+	case "-":
+		return -x, nil
+	case "!":
+		return truth(x == 0), nil
+	case "~":
+		return float64(^int64(x)), nil
+	}
+	return x, nil
+}
+
+type binaryNode struct {
+	op   string
+	x, y node
+}
+
+func (n binaryNode) eval(e env) (float64, error) {
+	x, err := n.x.eval(e)
+	if err != nil {
+		return 0, err
+	}
+	// 逻辑运算短路求值
+	switch {
+	case n.op == "&&" && x == 0:
+		return 0, nil
+	case n.op == "||" && x != 0:
+		return 1, nil
+	}
+	y, err := n.y.eval(e)
+	if err != nil {
+		return 0, err
+	}
+
+	switch n.op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/":
+		if y == 0 {
+			return 0, ErrDivisionByZero
+		}
+		return x / y, nil
+	case "%":
+		if y == 0 {
+			return 0, ErrDivisionByZero
+		}
+		return math.Mod(x, y), nil
+	case "&&", "||":
+		return truth(y != 0), nil
+	case "==":
+		return truth(x == y), nil
+	case "!=":
+		return truth(x != y), nil
+	case "<":
+		return truth(x < y), nil
+	case "<=":
+		return truth(x <= y), nil
+	case ">":
+		return truth(x > y), nil
+	case ">=":
+		return truth(x >= y), nil
+	}
+
+	a, b := int64(x), int64(y)
+	switch n.op {
+	case "&":
+		return float64(a & b), nil
+	case "|":
+		return float64(a | b), nil
+	case "^":
+		return float64(a ^ b), nil
+	case "<<":
+		return float64(a << min(max(b, 0), 63)), nil
+	case ">>":
+		return float64(a >> min(max(b, 0), 63)), nil
+	}
+	return 0, fmt.Errorf("%w: unknown operator %q", ErrSyntax, n.op)
+}
+
+type condNode struct {
+	c, a, b node
+}
+
+func (n condNode) eval(e env) (float64, error) {
+	c, err := n.c.eval(e)
+	if err != nil {
+		return 0, err
+	}
+	if c != 0 {
+		return n.a.eval(e)
+	}
+	return n.b.eval(e)
+}
+
+type callNode struct {
+	fn   string
+	args []node
+}
+
+func (n callNode) eval(e env) (float64, error) {
+	args := make([]float64, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(e)
+		if err != nil {
+			return 0, err
+		}
+		args[i] = v
+	}
+
+	switch n.fn {
+	case "abs":
+		return math.Abs(args[0]), nil
+	case "round":
+		return math.Round(args[0]), nil
+	case "min":
+		v := args[0]
+		for _, a := range args[1:] {
+			v = math.Min(v, a)
+		}
+		return v, nil
+	case "max":
+		v := args[0]
+		for _, a := range args[1:] {
+			v = math.Max(v, a)
+		}
+		return v, nil
+	case "clamp":
+		return math.Min(math.Max(args[0], args[1]), args[2]), nil
+	case "bit":
+		return float64(int64(args[0]) >> min(max(int64(args[1]), 0), 63) & 1), nil
+	}
+	return 0, fmt.Errorf("%w: unknown function %q", ErrSyntax, n.fn)
+}
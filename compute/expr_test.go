@@ -0,0 +1,140 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package compute
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/hootrhino/goodbusserver/store"
+	"github.com/hootrhino/goodbusserver/tag"
+)
+
+// mapEnv resolves raw references from a map keyed by table and address.
+type mapEnv struct {
+	raws map[Ref]float64
+	tags map[string]float64
+}
+
+func (e mapEnv) raw(table store.Table, address uint16) (float64, error) {
+	return e.raws[Ref{Table: table, Address: address}], nil
+}
+
+func (e mapEnv) tag(name string) (float64, error) {
+	v, ok := e.tags[name]
+	if !ok {
+		return 0, tag.ErrUnknownTag
+	}
+	return v, nil
+}
+
+func TestExpr_Eval(t *testing.T) {
+	env := mapEnv{
+		raws: map[Ref]float64{
+			{Table: store.TableHoldingRegisters, Address: 1}: 250,
+			{Table: store.TableHoldingRegisters, Address: 2}: 0x00F0,
+			{Table: store.TableInputRegisters, Address: 100}: 7,
+			{Table: store.TableCoils, Address: 3}:            1,
+		},
+		tags: map[string]float64{"temperature": 82.5, "setpoint": 80, "pump.speed": 1450},
+	}
+	tests := []struct {
+		src  string
+		want float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"2.5e1 / 5", 5},
+		{"-hr[1] + 0x10", -234},
+		{"7 % 3", 1},
+		{"hr[2] & 0x0F0 | 1", 0xF1},
+		{"hr[2] >> 4 ^ 0xF", 0},
+		{"1 << 3", 8},
+		{"~0 & 0xFFFF", 0xFFFF},
+		{"temperature > setpoint", 1},
+		{"temperature > setpoint && !co[3]", 0},
+		{"temperature >= 90 || co[3] == 1", 1},
+		{"ir[100] != 7", 0},
+		{"co[3] ? pump.speed : 0", 1450},
+		{"false ? 1 : ir[100] < 5 ? 2 : 3", 3},
+		{"min(hr[1], 100, ir[100])", 7},
+		{"max(1, temperature)", 82.5},
+		{"clamp(temperature, 0, 80)", 80},
+		{"abs(-3) + round(2.5)", 6},
+		{"bit(hr[2], 4) + bit(hr[2], 3)", 1},
+		{"1 || 1 / 0", 1},
+	}
+	for _, tt := range tests {
+		x, err := Compile(tt.src)
+		if err != nil {
+			t.Errorf("Compile(%q) error = %v", tt.src, err)
+			continue
+		}
+		got, err := x.eval(env)
+		if err != nil || got != tt.want {
+			t.Errorf("%q = %v, %v; want %v", tt.src, got, err, tt.want)
+		}
+	}
+}
+
+func TestExpr_Refs(t *testing.T) {
+	x, err := Compile("hr[10] > setpoint ? di[2] : ir[0x10]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Ref{
+		{Table: store.TableHoldingRegisters, Address: 10},
+		{Tag: "setpoint"},
+		{Table: store.TableDiscreteInputs, Address: 2},
+		{Table: store.TableInputRegisters, Address: 16},
+	}
+	if got := x.Refs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Refs() = %+v; want %+v", got, want)
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"1 +",
+		"(1 + 2",
+		"hr[70000]",
+		"hr[1.5]",
+		"hr[x]",
+		"sqrt(4)",
+		"min()",
+		"bit(1)",
+		"1 ? 2",
+		"1 $ 2",
+		"1 2",
+		"0x",
+	} {
+		if _, err := Compile(src); !errors.Is(err, ErrSyntax) {
+			t.Errorf("Compile(%q) error = %v; want ErrSyntax", src, err)
+		}
+	}
+}
+
+func TestExpr_DivisionByZero(t *testing.T) {
+	for _, src := range []string{"1 / hr[0]", "5 % 0"} {
+		x, _ := Compile(src)
+		if _, err := x.eval(mapEnv{}); !errors.Is(err, ErrDivisionByZero) {
+			t.Errorf("%q error = %v; want ErrDivisionByZero", src, err)
+		}
+	}
+}
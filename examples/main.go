@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	modbus_server "github.com/hootrhino/goodbusserver"
+	"github.com/hootrhino/goodbusserver/logger"
 	"github.com/hootrhino/goodbusserver/protocol"
 	"github.com/hootrhino/goodbusserver/store"
 	"log"
+	"log/slog"
 	"os"
 )
 
@@ -41,8 +43,8 @@ func main() {
 		log.Printf("Modbus server error: %v", err)
 	})
 
-	// Set up logger
-	server.SetLogger(os.Stdout)
+	// Set up a JSON logger; per-request records are logged at Debug
+	server.SetLogger(logger.New(os.Stdout, slog.LevelDebug))
 
 	// Set more sample holding register data
 	sampleHoldingRegisters := make([]uint16, 12)
@@ -67,7 +69,7 @@ func main() {
 
 	// Register a custom function code handler
 	customCode := byte(0x81)
-	server.RegisterCustomHandler(customCode, func(request modbus_server.Request, store store.Store) ([]byte, error) {
+	server.RegisterCustomHandler(customCode, func(ctx context.Context, request modbus_server.Request, store store.Store) ([]byte, error) {
 		transactionID := protocol.ExtractTransactionID(request.Frame)
 		pdu := []byte{customCode, 0x01, 0x02}
 		header := protocol.BuildResponseHeader(transactionID, 0, uint16(len(pdu)+1), request.SlaveID)
@@ -0,0 +1,94 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handler
+
+import (
+	"context"
+
+	"github.com/hootrhino/goodbusserver/protocol"
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+// AccessPolicy makes the built-in handlers enforce the access modes reported
+// by Checker. It applies to Modbus clients only; the application still
+// writes read-only registers through the store.
+type AccessPolicy struct {
+	Checker store.AccessChecker
+	// Exception is returned for a denied access. Nil means
+	// ErrIllegalDataAddress; ErrIllegalDataValue is the other usual choice.
+	Exception *protocol.ModbusError
+	// ZeroWriteOnly answers reads of write-only addresses with zeros
+	// instead of the exception.
+	ZeroWriteOnly bool
+}
+
+type accessPolicyKey struct{}
+
+// WithAccessPolicy returns a copy of ctx carrying p.
+func WithAccessPolicy(ctx context.Context, p *AccessPolicy) context.Context {
+	return context.WithValue(ctx, accessPolicyKey{}, p)
+}
+
+// AccessPolicyFromContext returns the access policy stored in ctx, or nil.
+func AccessPolicyFromContext(ctx context.Context) *AccessPolicy {
+	p, _ := ctx.Value(accessPolicyKey{}).(*AccessPolicy)
+	return p
+}
+
+func (p *AccessPolicy) exception() *protocol.ModbusError {
+	if p.Exception != nil {
+		return p.Exception
+	}
+	return protocol.ErrIllegalDataAddress
+}
+
+// checkRead checks a read of quantity addresses from start. zero reports
+// that the read is allowed but must return zeros.
+func checkRead(ctx context.Context, request Request, table store.Table) (zero bool, err error) {
+	p := AccessPolicyFromContext(ctx)
+	if p == nil || p.Checker == nil {
+		return false, nil
+	}
+	access := p.Checker.Access(request.SlaveID, table, request.StartAddress, int(request.Quantity))
+	switch {
+	case access.CanRead():
+		return false, nil
+	case access == store.AccessWriteOnly && p.ZeroWriteOnly:
+		return true, nil
+	}
+	return false, p.exception()
+}
+
+// checkWrite checks a write of quantity addresses from start.
+func checkWrite(ctx context.Context, request Request, table store.Table, quantity int) error {
+	p := AccessPolicyFromContext(ctx)
+	if p == nil || p.Checker == nil {
+		return nil
+	}
+	if !p.Checker.Access(request.SlaveID, table, request.StartAddress, quantity).CanWrite() {
+		return p.exception()
+	}
+	return nil
+}
+
+// Table aliases for use inside Handle methods, where the store parameter
+// shadows the package name.
+const (
+	tableCoils            = store.TableCoils
+	tableDiscreteInputs   = store.TableDiscreteInputs
+	tableHoldingRegisters = store.TableHoldingRegisters
+	tableInputRegisters   = store.TableInputRegisters
+)
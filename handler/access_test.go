@@ -0,0 +1,76 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hootrhino/goodbusserver/protocol"
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+func TestAccessPolicy_WriteOnlyReads(t *testing.T) {
+	memStore := store.NewInMemoryStore()
+	memStore.SetHoldingRegistersAt(0, []uint16{0x1234, 0x5678})
+	checker := store.NewAccessMap(store.AccessRule{
+		Table:  store.TableHoldingRegisters,
+		Window: store.Window{Start: 1, End: 1},
+		Access: store.AccessWriteOnly,
+	})
+
+	request := Request{
+		Frame:        []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x01, 0x03, 0x00, 0x00, 0x00, 0x02},
+		SlaveID:      0x01,
+		FuncCode:     protocol.FuncCodeReadHoldingRegisters,
+		StartAddress: 0,
+		Quantity:     2,
+	}
+
+	ctx := WithAccessPolicy(context.Background(), &AccessPolicy{Checker: checker})
+	if _, err := (&HoldingRegistersHandler{}).Handle(ctx, request, memStore); err != protocol.ErrIllegalDataAddress {
+		t.Errorf("Expected ErrIllegalDataAddress, got %v", err)
+	}
+
+	ctx = WithAccessPolicy(context.Background(), &AccessPolicy{Checker: checker, ZeroWriteOnly: true})
+	response, err := (&HoldingRegistersHandler{}).Handle(ctx, request, memStore)
+	if err != nil {
+		t.Fatalf("Failed to handle request: %v", err)
+	}
+	if data := response[9:]; string(data) != string([]byte{0, 0, 0, 0}) {
+		t.Errorf("Expected zeros for a write-only read, got % X", data)
+	}
+}
+
+func TestAccessPolicy_ReadOnlyWrites(t *testing.T) {
+	memStore := store.NewInMemoryStore()
+	sparse, _ := store.NewSparseStore(store.Region{Table: store.TableCoils, Start: 0, Length: 8, Access: store.AccessReadOnly})
+	ctx := WithAccessPolicy(context.Background(), &AccessPolicy{Checker: sparse, Exception: protocol.ErrIllegalDataValue})
+
+	request := Request{
+		Frame:        []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x01, 0x05, 0x00, 0x03, 0xFF, 0x00},
+		SlaveID:      0x01,
+		FuncCode:     protocol.FuncCodeWriteSingleCoil,
+		StartAddress: 3,
+	}
+
+	if _, err := (&SingleCoilHandler{}).Handle(ctx, request, memStore); err != protocol.ErrIllegalDataValue {
+		t.Errorf("Expected ErrIllegalDataValue, got %v", err)
+	}
+	if on, _ := memStore.(*store.InMemoryStore).GetBit(store.TableCoils, 3); on {
+		t.Error("Denied write reached the store")
+	}
+}
@@ -16,26 +16,37 @@
 package handler
 
 import (
+	"context"
+
 	"github.com/hootrhino/goodbusserver/protocol"
 	"github.com/hootrhino/goodbusserver/store"
 )
 
 type CoilsHandler struct{}
 
-func (h *CoilsHandler) Handle(request Request, store store.Store) ([]byte, error) {
+func (h *CoilsHandler) Handle(ctx context.Context, request Request, store store.Store) ([]byte, error) {
+	// 检查访问权限
+	zero, err := checkRead(ctx, request, tableCoils)
+	if err != nil {
+		return nil, err
+	}
+
 	values, err := store.GetCoils(request.StartAddress, request.Quantity)
 	if err != nil {
-		return nil, protocol.ErrIllegalDataAddress
+		return nil, storeError(err)
+	}
+	if zero {
+		clear(values)
 	}
 
 	// 验证数据长度
-	expectedLength := (int(request.Quantity) + 7) / 8
-	if len(values) < expectedLength {
+	if len(values) < int(request.Quantity) {
 		return nil, protocol.ErrIllegalDataAddress
 	}
 
-	// 计算实际需要返回的字节数
-	byteCount := expectedLength
+	// 按 LSB 优先打包为位
+	packed := protocol.PackBits(values[:request.Quantity])
+	byteCount := len(packed)
 
 	// Extract transaction ID from the request frame
 	transactionID := protocol.ExtractTransactionID(request.Frame)
@@ -44,7 +55,7 @@ func (h *CoilsHandler) Handle(request Request, store store.Store) ([]byte, error
 	pdu := make([]byte, 0, 2+byteCount)
 	pdu = append(pdu, request.FuncCode)
 	pdu = append(pdu, byte(byteCount))
-	pdu = append(pdu, values[:byteCount]...)
+	pdu = append(pdu, packed...)
 
 	// Build MBAP header
 	header := protocol.BuildResponseHeader(transactionID, 0, uint16(len(pdu)+1), request.SlaveID)
@@ -16,6 +16,7 @@
 package handler
 
 import (
+	"context"
 	"testing"
 
 	"github.com/hootrhino/goodbusserver/protocol"
@@ -36,7 +37,7 @@ func TestCoilsHandler_Handle(t *testing.T) {
 		Quantity:     3,
 	}
 
-	response, err := handler.Handle(request, memStore)
+	response, err := handler.Handle(context.Background(), request, memStore)
 	if err != nil {
 		t.Fatalf("Failed to handle request: %v", err)
 	}
@@ -45,3 +46,27 @@ func TestCoilsHandler_Handle(t *testing.T) {
 		t.Errorf("Response function code mismatch: got %d, want %d", response[7], request.FuncCode)
 	}
 }
+
+func TestCoilsHandler_PacksBits(t *testing.T) {
+	handler := &CoilsHandler{}
+	memStore := store.NewInMemoryStore().(*store.InMemoryStore)
+	memStore.SetCoilsAt(0, []byte{1, 0, 1, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 1})
+
+	request := Request{
+		Frame:        []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x01, 0x01, 0x00, 0x00, 0x00, 0x10},
+		SlaveID:      0x01,
+		FuncCode:     protocol.FuncCodeReadCoils,
+		StartAddress: 0,
+		Quantity:     16,
+	}
+
+	response, err := handler.Handle(context.Background(), request, memStore)
+	if err != nil {
+		t.Fatalf("Failed to handle request: %v", err)
+	}
+
+	expected := []byte{0x02, 0x0D, 0x81}
+	if got := response[8:]; string(got) != string(expected) {
+		t.Errorf("Response data mismatch: got % X, want % X", got, expected)
+	}
+}
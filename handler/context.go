@@ -0,0 +1,61 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+)
+
+// Transport types reported in ConnInfo.
+const (
+	TransportTCP = "tcp"
+	TransportTLS = "tls"
+)
+
+// ConnInfo describes the client connection a request arrived on.
+type ConnInfo struct {
+	ID         uint64
+	RemoteAddr net.Addr
+	LocalAddr  net.Addr
+	Transport  string
+	// TLS is the negotiated TLS state, nil for plain TCP connections.
+	TLS *tls.ConnectionState
+}
+
+// PeerCertificate returns the certificate presented by the client, or nil
+// when the connection is not TLS or the client sent no certificate.
+func (c ConnInfo) PeerCertificate() *x509.Certificate {
+	if c.TLS == nil || len(c.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return c.TLS.PeerCertificates[0]
+}
+
+type connInfoKey struct{}
+
+// WithConnInfo returns a copy of ctx carrying info.
+func WithConnInfo(ctx context.Context, info ConnInfo) context.Context {
+	return context.WithValue(ctx, connInfoKey{}, info)
+}
+
+// ConnInfoFromContext returns the connection metadata stored in ctx.
+func ConnInfoFromContext(ctx context.Context) (ConnInfo, bool) {
+	info, ok := ctx.Value(connInfoKey{}).(ConnInfo)
+	return info, ok
+}
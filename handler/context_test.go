@@ -0,0 +1,52 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"testing"
+)
+
+func TestConnInfoFromContext(t *testing.T) {
+	if _, ok := ConnInfoFromContext(context.Background()); ok {
+		t.Fatal("expected no ConnInfo in empty context")
+	}
+
+	remote := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 50200}
+	ctx := WithConnInfo(context.Background(), ConnInfo{ID: 7, RemoteAddr: remote, Transport: TransportTCP})
+	info, ok := ConnInfoFromContext(ctx)
+	if !ok {
+		t.Fatal("expected ConnInfo in context")
+	}
+	if info.ID != 7 || info.RemoteAddr.String() != remote.String() {
+		t.Errorf("unexpected ConnInfo: %+v", info)
+	}
+}
+
+func TestConnInfo_PeerCertificate(t *testing.T) {
+	if (ConnInfo{}).PeerCertificate() != nil {
+		t.Fatal("expected nil certificate for plain connection")
+	}
+
+	cert := &x509.Certificate{}
+	info := ConnInfo{Transport: TransportTLS, TLS: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}}
+	if info.PeerCertificate() != cert {
+		t.Fatal("expected peer certificate")
+	}
+}
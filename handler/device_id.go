@@ -0,0 +1,171 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handler
+
+import (
+	"context"
+	"sort"
+
+	"github.com/hootrhino/goodbusserver/protocol"
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+// Read device ID codes of a Read Device Identification request.
+const (
+	ReadDeviceIDBasic    = 0x01
+	ReadDeviceIDRegular  = 0x02
+	ReadDeviceIDExtended = 0x03
+	ReadDeviceIDSpecific = 0x04
+)
+
+// maxObjectsLength is the room left for objects in a response PDU after
+// the seven bytes of function code, MEI type, read device ID code,
+// conformity level, more follows, next object ID and number of objects.
+const maxObjectsLength = 253 - 7
+
+// DeviceIdentification holds the objects served by Read Device
+// Identification (function code 0x2B, MEI type 0x0E).
+type DeviceIdentification struct {
+	// Basic objects 0x00-0x02, always sent.
+	VendorName         string `json:"vendor_name"`
+	ProductCode        string `json:"product_code"`
+	MajorMinorRevision string `json:"major_minor_revision"`
+	// Regular objects 0x03-0x06, sent when not empty.
+	VendorURL           string `json:"vendor_url,omitempty"`
+	ProductName         string `json:"product_name,omitempty"`
+	ModelName           string `json:"model_name,omitempty"`
+	UserApplicationName string `json:"user_application_name,omitempty"`
+	// Extended holds private objects 0x80-0xFF.
+	Extended map[byte]string `json:"extended,omitempty"`
+}
+
+type deviceObject struct {
+	id    byte
+	value string
+}
+
+// objects returns the objects of the identification in ID order.
+func (d DeviceIdentification) objects() []deviceObject {
+	objects := []deviceObject{
+		{0x00, d.VendorName},
+		{0x01, d.ProductCode},
+		{0x02, d.MajorMinorRevision},
+	}
+	for i, value := range []string{d.VendorURL, d.ProductName, d.ModelName, d.UserApplicationName} {
+		if value != "" {
+			objects = append(objects, deviceObject{byte(0x03 + i), value})
+		}
+	}
+	extended := make([]deviceObject, 0, len(d.Extended))
+	for id, value := range d.Extended {
+		if id >= 0x80 {
+			extended = append(extended, deviceObject{id, value})
+		}
+	}
+	sort.Slice(extended, func(i, j int) bool { return extended[i].id < extended[j].id })
+	return append(objects, extended...)
+}
+
+// conformity returns the conformity level of the identification. Every
+// level supports individual access.
+func (d DeviceIdentification) conformity() byte {
+	objects := d.objects()
+	switch last := objects[len(objects)-1].id; {
+	case last >= 0x80:
+		return 0x83
+	case last >= 0x03:
+		return 0x82
+	}
+	return 0x81
+}
+
+// DeviceIdentificationHandler answers Read Device Identification requests
+// with the identification Lookup returns for the request's unit.
+type DeviceIdentificationHandler struct {
+	Lookup func(unitID byte) (DeviceIdentification, bool)
+}
+
+func (h *DeviceIdentificationHandler) Handle(ctx context.Context, request Request, store store.Store) ([]byte, error) {
+	// 验证帧长度：MEI类型、读取码、对象ID
+	if len(request.Frame) < 11 {
+		return nil, protocol.ErrIllegalDataValue
+	}
+	// 只支持读取设备标识，其他MEI类型（如CANopen）不支持
+	if request.Frame[8] != protocol.MEITypeReadDeviceIdentification {
+		return nil, protocol.ErrIllegalFunction
+	}
+	code, objectID := request.Frame[9], request.Frame[10]
+	if code < ReadDeviceIDBasic || code > ReadDeviceIDSpecific {
+		return nil, protocol.ErrIllegalDataValue
+	}
+
+	var id DeviceIdentification
+	ok := false
+	if h.Lookup != nil {
+		id, ok = h.Lookup(request.SlaveID)
+	}
+	if !ok {
+		return nil, protocol.ErrIllegalDataAddress
+	}
+
+	var objects []deviceObject
+	for _, object := range id.objects() {
+		switch {
+		case code == ReadDeviceIDSpecific && object.id == objectID,
+			code == ReadDeviceIDBasic && object.id <= 0x02,
+			code == ReadDeviceIDRegular && object.id <= 0x7F,
+			code == ReadDeviceIDExtended:
+			objects = append(objects, object)
+		}
+	}
+	if code == ReadDeviceIDSpecific && len(objects) == 0 {
+		return nil, protocol.ErrIllegalDataAddress
+	}
+
+	// 流式访问从请求的对象开始，对象不存在时从头开始
+	if code != ReadDeviceIDSpecific {
+		start := 0
+		for i, object := range objects {
+			if object.id == objectID {
+				start = i
+				break
+			}
+		}
+		objects = objects[start:]
+	}
+
+	pdu := []byte{request.FuncCode, protocol.MEITypeReadDeviceIdentification, code, id.conformity(), 0x00, 0x00, 0}
+	size := 0
+	for i, object := range objects {
+		value := object.value
+		if len(value) > maxObjectsLength-2 {
+			value = value[:maxObjectsLength-2]
+		}
+		// 超出一个响应的长度时，告知客户端从下一个对象继续读取
+		if size+2+len(value) > maxObjectsLength {
+			pdu[4], pdu[5] = 0xFF, object.id
+			break
+		}
+		size += 2 + len(value)
+		pdu = append(pdu, object.id, byte(len(value)))
+		pdu = append(pdu, value...)
+		pdu[6] = byte(i + 1)
+	}
+
+	transactionID := protocol.ExtractTransactionID(request.Frame)
+	header := protocol.BuildResponseHeader(transactionID, 0, uint16(len(pdu)+1), request.SlaveID)
+	return append(header, pdu...), nil
+}
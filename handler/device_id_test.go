@@ -0,0 +1,132 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hootrhino/goodbusserver/protocol"
+)
+
+func deviceIDRequest(code, objectID byte) Request {
+	return Request{
+		Frame:    []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x05, 0x01, 0x2B, 0x0E, code, objectID},
+		SlaveID:  0x01,
+		FuncCode: protocol.FuncCodeEncapsulatedInterface,
+	}
+}
+
+func TestDeviceIdentificationHandler_Handle(t *testing.T) {
+	h := &DeviceIdentificationHandler{Lookup: func(unitID byte) (DeviceIdentification, bool) {
+		return DeviceIdentification{
+			VendorName:         "Acme",
+			ProductCode:        "PM-200",
+			MajorMinorRevision: "1.2",
+			ModelName:          "Power Meter",
+			Extended:           map[byte]string{0x80: "X"},
+		}, unitID == 1
+	}}
+
+	tests := []struct {
+		name     string
+		code, id byte
+		want     []byte
+	}{
+		{"basic", ReadDeviceIDBasic, 0x00, []byte{
+			0x2B, 0x0E, 0x01, 0x83, 0x00, 0x00, 0x03,
+			0x00, 0x04, 'A', 'c', 'm', 'e',
+			0x01, 0x06, 'P', 'M', '-', '2', '0', '0',
+			0x02, 0x03, '1', '.', '2',
+		}},
+		{"regular from object 2", ReadDeviceIDRegular, 0x02, []byte{
+			0x2B, 0x0E, 0x02, 0x83, 0x00, 0x00, 0x02,
+			0x02, 0x03, '1', '.', '2',
+			0x05, 0x0B, 'P', 'o', 'w', 'e', 'r', ' ', 'M', 'e', 't', 'e', 'r',
+		}},
+		{"extended from unknown object", ReadDeviceIDExtended, 0x90, []byte{
+			0x2B, 0x0E, 0x03, 0x83, 0x00, 0x00, 0x05,
+			0x00, 0x04, 'A', 'c', 'm', 'e',
+			0x01, 0x06, 'P', 'M', '-', '2', '0', '0',
+			0x02, 0x03, '1', '.', '2',
+			0x05, 0x0B, 'P', 'o', 'w', 'e', 'r', ' ', 'M', 'e', 't', 'e', 'r',
+			0x80, 0x01, 'X',
+		}},
+		{"specific", ReadDeviceIDSpecific, 0x80, []byte{
+			0x2B, 0x0E, 0x04, 0x83, 0x00, 0x00, 0x01,
+			0x80, 0x01, 'X',
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := h.Handle(context.Background(), deviceIDRequest(tt.code, tt.id), nil)
+			if err != nil {
+				t.Fatalf("Handle() error = %v", err)
+			}
+			if string(resp[7:]) != string(tt.want) {
+				t.Errorf("PDU = % X; want % X", resp[7:], tt.want)
+			}
+			if length := int(resp[4])<<8 | int(resp[5]); length != len(resp)-6 {
+				t.Errorf("MBAP length = %d; want %d", length, len(resp)-6)
+			}
+		})
+	}
+}
+
+func TestDeviceIdentificationHandler_Errors(t *testing.T) {
+	h := &DeviceIdentificationHandler{Lookup: func(unitID byte) (DeviceIdentification, bool) {
+		return DeviceIdentification{VendorName: "Acme"}, unitID == 1
+	}}
+
+	tests := []struct {
+		name string
+		req  Request
+		want error
+	}{
+		{"bad read code", deviceIDRequest(0x05, 0x00), protocol.ErrIllegalDataValue},
+		{"unknown object", deviceIDRequest(ReadDeviceIDSpecific, 0x04), protocol.ErrIllegalDataAddress},
+		{"unknown unit", func() Request { r := deviceIDRequest(ReadDeviceIDBasic, 0); r.SlaveID = 2; return r }(), protocol.ErrIllegalDataAddress},
+		{"other MEI type", func() Request { r := deviceIDRequest(ReadDeviceIDBasic, 0); r.Frame[8] = 0x0D; return r }(), protocol.ErrIllegalFunction},
+		{"short frame", Request{Frame: []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x03, 0x01, 0x2B, 0x0E}}, protocol.ErrIllegalDataValue},
+	}
+	for _, tt := range tests {
+		if _, err := h.Handle(context.Background(), tt.req, nil); !errors.Is(err, tt.want) {
+			t.Errorf("%s: error = %v; want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestDeviceIdentificationHandler_MoreFollows(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	h := &DeviceIdentificationHandler{Lookup: func(byte) (DeviceIdentification, bool) {
+		return DeviceIdentification{VendorName: long, ProductCode: long, MajorMinorRevision: long}, true
+	}}
+
+	resp, err := h.Handle(context.Background(), deviceIDRequest(ReadDeviceIDBasic, 0x00), nil)
+	if err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+	if more, next, count := resp[11], resp[12], resp[13]; more != 0xFF || next != 0x02 || count != 2 {
+		t.Fatalf("more follows = %02X, next = %02X, count = %d; want FF, 02, 2", more, next, count)
+	}
+
+	resp, _ = h.Handle(context.Background(), deviceIDRequest(ReadDeviceIDBasic, 0x02), nil)
+	if more, count := resp[11], resp[13]; more != 0x00 || count != 1 || resp[14] != 0x02 {
+		t.Fatalf("continuation = % X", resp[7:16])
+	}
+}
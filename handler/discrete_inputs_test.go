@@ -16,6 +16,7 @@
 package handler
 
 import (
+	"context"
 	"testing"
 
 	"github.com/hootrhino/goodbusserver/protocol"
@@ -36,7 +37,7 @@ func TestDiscreteInputsHandler_Handle(t *testing.T) {
 		Quantity:     3,
 	}
 
-	response, err := handler.Handle(request, memStore)
+	response, err := handler.Handle(context.Background(), request, memStore)
 	if err != nil {
 		t.Fatalf("Failed to handle request: %v", err)
 	}
@@ -58,7 +59,7 @@ func TestDiscreteInputsHandler_Handle_Error(t *testing.T) {
 		Quantity:     3,
 	}
 
-	response, err := handler.Handle(request, memStore)
+	response, err := handler.Handle(context.Background(), request, memStore)
 	if err == nil {
 		t.Fatalf("Expected an error, but got nil")
 	}
@@ -83,7 +84,7 @@ func TestDiscreteInputsHandler_Handle_DifferentQuantity(t *testing.T) {
 		Quantity:     5,
 	}
 
-	response, err := handler.Handle(request, memStore)
+	response, err := handler.Handle(context.Background(), request, memStore)
 	if err != nil {
 		t.Fatalf("Failed to handle request: %v", err)
 	}
@@ -1,9 +1,15 @@
 package handler
 
-import "github.com/hootrhino/goodbusserver/store"
+import (
+	"context"
+	"errors"
+
+	"github.com/hootrhino/goodbusserver/protocol"
+	"github.com/hootrhino/goodbusserver/store"
+)
 
 type Handler interface {
-	Handle(request Request, store store.Store) ([]byte, error)
+	Handle(ctx context.Context, request Request, store store.Store) ([]byte, error)
 }
 
 type Request struct {
@@ -13,3 +19,14 @@ type Request struct {
 	StartAddress uint16
 	Quantity     uint16
 }
+
+// storeError converts a store error into the exception sent to the client.
+// Exceptions chosen by the store, such as a write rejected by a hook, are
+// passed through; anything else is reported as an illegal data address.
+func storeError(err error) error {
+	var exception *protocol.ModbusError
+	if errors.As(err, &exception) {
+		return exception
+	}
+	return protocol.ErrIllegalDataAddress
+}
@@ -16,16 +16,27 @@
 package handler
 
 import (
+	"context"
+
 	"github.com/hootrhino/goodbusserver/protocol"
 	"github.com/hootrhino/goodbusserver/store"
 )
 
 type HoldingRegistersHandler struct{}
 
-func (h *HoldingRegistersHandler) Handle(request Request, store store.Store) ([]byte, error) {
+func (h *HoldingRegistersHandler) Handle(ctx context.Context, request Request, store store.Store) ([]byte, error) {
+	// 检查访问权限
+	zero, err := checkRead(ctx, request, tableHoldingRegisters)
+	if err != nil {
+		return nil, err
+	}
+
 	values, err := store.GetHoldingRegisters(request.StartAddress, request.Quantity)
 	if err != nil {
-		return nil, protocol.ErrIllegalDataAddress
+		return nil, storeError(err)
+	}
+	if zero {
+		clear(values)
 	}
 
 	// 验证数据长度
@@ -16,6 +16,7 @@
 package handler
 
 import (
+	"context"
 	"testing"
 
 	"github.com/hootrhino/goodbusserver/protocol"
@@ -37,7 +38,7 @@ func TestHoldingRegistersHandler_Handle(t *testing.T) {
 		Quantity:     2,
 	}
 
-	response, err := handler.Handle(request, memStore)
+	response, err := handler.Handle(context.Background(), request, memStore)
 	if err != nil {
 		t.Fatalf("Failed to handle request: %v", err)
 	}
@@ -59,7 +60,7 @@ func TestHoldingRegistersHandler_Handle_Error(t *testing.T) {
 		Quantity:     2,
 	}
 
-	response, err := handler.Handle(request, memStore)
+	response, err := handler.Handle(context.Background(), request, memStore)
 	if err == nil {
 		t.Fatalf("Expected an error, but got nil")
 	}
@@ -68,3 +69,23 @@ func TestHoldingRegistersHandler_Handle_Error(t *testing.T) {
 		t.Errorf("Expected response to be nil, but got %v", response)
 	}
 }
+
+// TestHoldingRegistersHandler_Handle_Hole tests that a read touching an undefined address returns exception 0x02
+func TestHoldingRegistersHandler_Handle_Hole(t *testing.T) {
+	handler := &HoldingRegistersHandler{}
+	memStore := store.NewInMemoryStore(store.WithWindows(store.TableHoldingRegisters,
+		store.Window{Start: 0, End: 9}, store.Window{Start: 20, End: 29}))
+
+	request := Request{
+		Frame:        []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x01, 0x03, 0x00, 0x08, 0x00, 0x04},
+		SlaveID:      0x01,
+		FuncCode:     protocol.FuncCodeReadHoldingRegisters,
+		StartAddress: 8,
+		Quantity:     4,
+	}
+
+	_, err := handler.Handle(context.Background(), request, memStore)
+	if err != protocol.ErrIllegalDataAddress {
+		t.Errorf("Expected ErrIllegalDataAddress, got %v", err)
+	}
+}
@@ -16,16 +16,27 @@
 package handler
 
 import (
+	"context"
+
 	"github.com/hootrhino/goodbusserver/protocol"
 	"github.com/hootrhino/goodbusserver/store"
 )
 
 type InputRegistersHandler struct{}
 
-func (h *InputRegistersHandler) Handle(request Request, store store.Store) ([]byte, error) {
+func (h *InputRegistersHandler) Handle(ctx context.Context, request Request, store store.Store) ([]byte, error) {
+	// 检查访问权限
+	zero, err := checkRead(ctx, request, tableInputRegisters)
+	if err != nil {
+		return nil, err
+	}
+
 	values, err := store.GetInputRegisters(request.StartAddress, request.Quantity)
 	if err != nil {
-		return nil, protocol.ErrIllegalDataAddress
+		return nil, storeError(err)
+	}
+	if zero {
+		clear(values)
 	}
 
 	// 验证数据长度
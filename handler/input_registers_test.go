@@ -16,6 +16,7 @@
 package handler
 
 import (
+	"context"
 	"testing"
 
 	"github.com/hootrhino/goodbusserver/protocol"
@@ -37,7 +38,7 @@ func TestInputRegistersHandler_Handle(t *testing.T) {
 		Quantity:     2,
 	}
 
-	response, err := handler.Handle(request, memStore)
+	response, err := handler.Handle(context.Background(), request, memStore)
 	if err != nil {
 		t.Fatalf("Failed to handle request: %v", err)
 	}
@@ -59,7 +60,7 @@ func TestInputRegistersHandler_Handle_Error(t *testing.T) {
 		Quantity:     2,
 	}
 
-	response, err := handler.Handle(request, memStore)
+	response, err := handler.Handle(context.Background(), request, memStore)
 	if err == nil {
 		t.Fatalf("Expected an error, but got nil")
 	}
@@ -16,23 +16,24 @@
 package handler
 
 import (
+	"context"
+
 	"github.com/hootrhino/goodbusserver/protocol"
 	"github.com/hootrhino/goodbusserver/store"
 )
 
 type MultipleCoilsHandler struct{}
 
-func (h *MultipleCoilsHandler) Handle(request Request, store store.Store) ([]byte, error) {
+func (h *MultipleCoilsHandler) Handle(ctx context.Context, request Request, store store.Store) ([]byte, error) {
 	if len(request.Frame) < 12 {
 		return nil, protocol.ErrIllegalDataValue
 	}
 
-	byteCount := (int(request.Quantity) + 7) / 8
-	values := make([]byte, byteCount)
+	values := make([]byte, request.Quantity)
 
 	if len(request.Frame) >= 14 {
 		expectedByteCount := (int(request.Quantity) + 7) / 8
-		byteCount = int(request.Frame[12])
+		byteCount := int(request.Frame[12])
 		if byteCount != expectedByteCount {
 			return nil, protocol.ErrIllegalDataValue
 		}
@@ -42,12 +43,18 @@ func (h *MultipleCoilsHandler) Handle(request Request, store store.Store) ([]byt
 			return nil, protocol.ErrIllegalDataValue
 		}
 
-		copy(values, request.Frame[13:13+byteCount])
+		// 帧内线圈按 LSB 优先打包，解包为每个线圈一个字节
+		values = protocol.UnpackBits(request.Frame[13:13+byteCount], int(request.Quantity))
+	}
+
+	// 检查访问权限
+	if err := checkWrite(ctx, request, tableCoils, len(values)); err != nil {
+		return nil, err
 	}
 
 	err := store.SetCoilsAt(request.StartAddress, values)
 	if err != nil {
-		return nil, protocol.ErrIllegalDataAddress
+		return nil, storeError(err)
 	}
 
 	// Construct the response PDU
@@ -16,6 +16,7 @@
 package handler
 
 import (
+	"context"
 	"testing"
 
 	"github.com/hootrhino/goodbusserver/protocol"
@@ -36,7 +37,7 @@ func TestMultipleCoilsHandler_Handle(t *testing.T) {
 		Quantity:     3,
 	}
 
-	response, err := handler.Handle(request, memStore)
+	response, err := handler.Handle(context.Background(), request, memStore)
 	if err != nil {
 		t.Fatalf("Failed to handle request: %v", err)
 	}
@@ -45,3 +46,29 @@ func TestMultipleCoilsHandler_Handle(t *testing.T) {
 		t.Errorf("Response function code mismatch: got %d, want %d", response[7], request.FuncCode)
 	}
 }
+
+func TestMultipleCoilsHandler_UnpacksBits(t *testing.T) {
+	handler := &MultipleCoilsHandler{}
+	memStore := store.NewInMemoryStore().(*store.InMemoryStore)
+
+	request := Request{
+		Frame:        []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x09, 0x01, 0x0F, 0x00, 0x04, 0x00, 0x0A, 0x02, 0xCD, 0x01},
+		SlaveID:      0x01,
+		FuncCode:     protocol.FuncCodeWriteMultipleCoils,
+		StartAddress: 4,
+		Quantity:     10,
+	}
+
+	if _, err := handler.Handle(context.Background(), request, memStore); err != nil {
+		t.Fatalf("Failed to handle request: %v", err)
+	}
+
+	coils, err := memStore.GetCoils(4, 10)
+	if err != nil {
+		t.Fatalf("GetCoils() error = %v", err)
+	}
+	expected := []byte{1, 0, 1, 1, 0, 0, 1, 1, 1, 0}
+	if string(coils) != string(expected) {
+		t.Errorf("Coils = %v, want %v", coils, expected)
+	}
+}
@@ -16,13 +16,15 @@
 package handler
 
 import (
+	"context"
+
 	"github.com/hootrhino/goodbusserver/protocol"
 	"github.com/hootrhino/goodbusserver/store"
 )
 
 type MultipleRegistersHandler struct{}
 
-func (h *MultipleRegistersHandler) Handle(request Request, store store.Store) ([]byte, error) {
+func (h *MultipleRegistersHandler) Handle(ctx context.Context, request Request, store store.Store) ([]byte, error) {
 	if len(request.Frame) < 12 {
 		return nil, protocol.ErrIllegalDataValue
 	}
@@ -63,9 +65,14 @@ func (h *MultipleRegistersHandler) Handle(request Request, store store.Store) ([
 		}
 	}
 
+	// 检查访问权限
+	if err := checkWrite(ctx, request, tableHoldingRegisters, len(values)); err != nil {
+		return nil, err
+	}
+
 	err := store.SetHoldingRegistersAt(request.StartAddress, values)
 	if err != nil {
-		return nil, protocol.ErrIllegalDataAddress
+		return nil, storeError(err)
 	}
 
 	// Construct the response PDU
@@ -16,6 +16,7 @@
 package handler
 
 import (
+	"context"
 	"testing"
 
 	"github.com/hootrhino/goodbusserver/protocol"
@@ -32,7 +33,7 @@ func TestMultipleRegistersHandler_Handle(t *testing.T) {
 		StartAddress: 0,
 	}
 
-	response, err := handler.Handle(request, memStore)
+	response, err := handler.Handle(context.Background(), request, memStore)
 	if err != nil {
 		t.Fatalf("Failed to handle request: %v", err)
 	}
@@ -52,7 +53,7 @@ func TestMultipleRegistersHandler_Handle_Error(t *testing.T) {
 		StartAddress: 0,
 	}
 
-	response, err := handler.Handle(request, memStore)
+	response, err := handler.Handle(context.Background(), request, memStore)
 	if err == nil {
 		t.Fatalf("Expected an error, but got nil")
 	}
@@ -61,3 +62,28 @@ func TestMultipleRegistersHandler_Handle_Error(t *testing.T) {
 		t.Errorf("Expected response to be nil, but got %v", response)
 	}
 }
+
+func TestMultipleRegistersHandler_Handle_HookRejected(t *testing.T) {
+	handler := &MultipleRegistersHandler{}
+	obs := store.NewObservableStore(store.NewInMemoryStore())
+	obs.OnWrite(store.Range(store.TableHoldingRegisters, 1, 1), func(req store.WriteRequest) ([]uint16, error) {
+		return nil, protocol.ErrIllegalDataValue
+	})
+	request := Request{
+		Frame:        []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x0B, 0x01, 0x10, 0x00, 0x00, 0x00, 0x02, 0x04, 0x00, 0x0A, 0x00, 0x0B},
+		SlaveID:      0x01,
+		FuncCode:     protocol.FuncCodeWriteMultipleRegisters,
+		StartAddress: 0,
+		Quantity:     2,
+	}
+
+	_, err := handler.Handle(context.Background(), request, obs)
+	if err != protocol.ErrIllegalDataValue {
+		t.Fatalf("Expected ErrIllegalDataValue, but got %v", err)
+	}
+
+	values, _ := obs.GetHoldingRegisters(0, 2)
+	if values[0] != 0 || values[1] != 0 {
+		t.Errorf("Rejected write was partially applied: %v", values)
+	}
+}
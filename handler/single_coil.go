@@ -16,13 +16,15 @@
 package handler
 
 import (
+	"context"
+
 	"github.com/hootrhino/goodbusserver/protocol"
 	"github.com/hootrhino/goodbusserver/store"
 )
 
 type SingleCoilHandler struct{}
 
-func (h *SingleCoilHandler) Handle(request Request, store store.Store) ([]byte, error) {
+func (h *SingleCoilHandler) Handle(ctx context.Context, request Request, store store.Store) ([]byte, error) {
 	// 验证帧长度
 	if len(request.Frame) < 12 {
 		return nil, protocol.ErrIllegalDataValue
@@ -40,10 +42,15 @@ func (h *SingleCoilHandler) Handle(request Request, store store.Store) ([]byte,
 		return nil, protocol.ErrIllegalDataValue
 	}
 
+	// 检查访问权限
+	if err := checkWrite(ctx, request, tableCoils, 1); err != nil {
+		return nil, err
+	}
+
 	// Write the coil value to the store
 	err := store.SetCoilsAt(request.StartAddress, []byte{value})
 	if err != nil {
-		return nil, protocol.ErrIllegalDataAddress
+		return nil, storeError(err)
 	}
 
 	// Construct the response PDU
@@ -16,6 +16,7 @@
 package handler
 
 import (
+	"context"
 	"testing"
 
 	"github.com/hootrhino/goodbusserver/protocol"
@@ -32,7 +33,7 @@ func TestSingleCoilHandler_Handle(t *testing.T) {
 		StartAddress: 0,
 	}
 
-	response, err := handler.Handle(request, memStore)
+	response, err := handler.Handle(context.Background(), request, memStore)
 	if err != nil {
 		t.Fatalf("Failed to handle request: %v", err)
 	}
@@ -52,7 +53,7 @@ func TestSingleCoilHandler_Handle_Error(t *testing.T) {
 		StartAddress: 0,
 	}
 
-	response, err := handler.Handle(request, memStore)
+	response, err := handler.Handle(context.Background(), request, memStore)
 	if err == nil {
 		t.Fatalf("Expected an error, but got nil")
 	}
@@ -16,13 +16,15 @@
 package handler
 
 import (
+	"context"
+
 	"github.com/hootrhino/goodbusserver/protocol"
 	"github.com/hootrhino/goodbusserver/store"
 )
 
 type SingleRegisterHandler struct{}
 
-func (h *SingleRegisterHandler) Handle(request Request, store store.Store) ([]byte, error) {
+func (h *SingleRegisterHandler) Handle(ctx context.Context, request Request, store store.Store) ([]byte, error) {
 	// 验证帧长度
 	if len(request.Frame) < 12 {
 		return nil, protocol.ErrIllegalDataValue
@@ -31,10 +33,15 @@ func (h *SingleRegisterHandler) Handle(request Request, store store.Store) ([]by
 	// Extract the register value from the request frame
 	registerValue := uint16(request.Frame[10])<<8 | uint16(request.Frame[11])
 
+	// 检查访问权限
+	if err := checkWrite(ctx, request, tableHoldingRegisters, 1); err != nil {
+		return nil, err
+	}
+
 	// Write the register value to the store
 	err := store.SetHoldingRegistersAt(request.StartAddress, []uint16{registerValue})
 	if err != nil {
-		return nil, protocol.ErrIllegalDataAddress
+		return nil, storeError(err)
 	}
 
 	// Construct the response PDU
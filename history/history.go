@@ -0,0 +1,89 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package history records every value change of a store with its time,
+// unit and source, and answers "value at time T" and "changes between T1
+// and T2" queries.
+package history
+
+import (
+	"time"
+
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+// Entry is the change of one address. Coil and discrete input values are 0
+// or 1.
+type Entry struct {
+	Time     time.Time    `json:"time"`
+	UnitID   byte         `json:"unit_id"`
+	Table    store.Table  `json:"table"`
+	Address  uint16       `json:"address"`
+	OldValue uint16       `json:"old_value"`
+	NewValue uint16       `json:"new_value"`
+	Source   store.Source `json:"source"`
+	// Client is the remote address of the Modbus client, empty for
+	// application writes.
+	Client string `json:"client,omitempty"`
+}
+
+// Query selects the changes of an address range of one table. End is
+// inclusive. A zero From or To leaves that end of the time range open.
+type Query struct {
+	UnitID byte
+	Table  store.Table
+	Start  uint16
+	End    uint16
+	From   time.Time
+	To     time.Time
+}
+
+// Address returns a query for a single address.
+func Address(unitID byte, table store.Table, address uint16) Query {
+	return Query{UnitID: unitID, Table: table, Start: address, End: address}
+}
+
+// Between returns a copy of q limited to changes from from to to, both
+// inclusive.
+func (q Query) Between(from, to time.Time) Query {
+	q.From, q.To = from, to
+	return q
+}
+
+func (q Query) matches(e Entry) bool {
+	return e.UnitID == q.UnitID && e.Table == q.Table &&
+		e.Address >= q.Start && e.Address <= q.End &&
+		(q.From.IsZero() || !e.Time.Before(q.From)) &&
+		(q.To.IsZero() || !e.Time.After(q.To))
+}
+
+// Retention limits how much history a backend keeps. Zero fields are
+// unlimited.
+type Retention struct {
+	// MaxAge drops changes older than MaxAge before the newest one.
+	MaxAge time.Duration
+	// MaxEntries keeps only the newest MaxEntries changes.
+	MaxEntries int
+}
+
+// Backend stores entries. Entries are appended in time order.
+type Backend interface {
+	Append(entries []Entry) error
+	// Changes returns the entries matching q in the order they were
+	// appended.
+	Changes(q Query) ([]Entry, error)
+	// Last returns the latest change of an address at or before t.
+	Last(unitID byte, table store.Table, address uint16, t time.Time) (Entry, bool, error)
+}
@@ -0,0 +1,102 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package history
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+// MemoryBackend keeps entries in memory.
+type MemoryBackend struct {
+	retention Retention
+	mu        sync.RWMutex
+	entries   []Entry
+}
+
+var _ Backend = (*MemoryBackend)(nil)
+
+// NewMemoryBackend returns an empty backend that applies retention on every
+// append.
+func NewMemoryBackend(retention Retention) *MemoryBackend {
+	return &MemoryBackend{retention: retention}
+}
+
+// Append implements Backend.
+func (b *MemoryBackend) Append(entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.entries = append(b.entries, entries...)
+
+	drop := 0
+	if b.retention.MaxAge > 0 {
+		cutoff := b.entries[len(b.entries)-1].Time.Add(-b.retention.MaxAge)
+		drop = sort.Search(len(b.entries), func(i int) bool {
+			return !b.entries[i].Time.Before(cutoff)
+		})
+	}
+	if n := b.retention.MaxEntries; n > 0 && len(b.entries)-drop > n {
+		drop = len(b.entries) - n
+	}
+	if drop > 0 {
+		// 复制到新切片，释放被丢弃的记录
+		b.entries = append([]Entry(nil), b.entries[drop:]...)
+	}
+	return nil
+}
+
+// Changes implements Backend.
+func (b *MemoryBackend) Changes(q Query) ([]Entry, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var out []Entry
+	for _, e := range b.entries {
+		if q.matches(e) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// Last implements Backend.
+func (b *MemoryBackend) Last(unitID byte, table store.Table, address uint16, t time.Time) (Entry, bool, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	q := Address(unitID, table, address)
+	for i := len(b.entries) - 1; i >= 0; i-- {
+		e := b.entries[i]
+		if !e.Time.After(t) && q.matches(e) {
+			return e, true, nil
+		}
+	}
+	return Entry{}, false, nil
+}
+
+// Len returns the number of entries kept.
+func (b *MemoryBackend) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.entries)
+}
@@ -0,0 +1,53 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+func entriesAt(t0 time.Time, n int) []Entry {
+	entries := make([]Entry, n)
+	for i := range entries {
+		entries[i] = Entry{
+			Time:     t0.Add(time.Duration(i) * time.Minute),
+			Table:    store.TableHoldingRegisters,
+			NewValue: uint16(i),
+		}
+	}
+	return entries
+}
+
+func TestMemoryBackend_Retention(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	byAge := NewMemoryBackend(Retention{MaxAge: 5 * time.Minute})
+	byAge.Append(entriesAt(t0, 10))
+	changes, _ := byAge.Changes(Address(0, store.TableHoldingRegisters, 0))
+	if len(changes) != 6 || changes[0].NewValue != 4 {
+		t.Errorf("MaxAge kept %d entries from %d, want 6 from 4", len(changes), changes[0].NewValue)
+	}
+
+	byCount := NewMemoryBackend(Retention{MaxEntries: 3})
+	byCount.Append(entriesAt(t0, 10))
+	changes, _ = byCount.Changes(Address(0, store.TableHoldingRegisters, 0))
+	if len(changes) != 3 || changes[0].NewValue != 7 {
+		t.Errorf("MaxEntries kept %d entries from %d, want 3 from 7", len(changes), changes[0].NewValue)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package history
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+// Recorder turns the change events of observable stores into history
+// entries. Entries are buffered and written to the backend by Flush, which
+// Run calls periodically, so recording never waits on the backend.
+type Recorder struct {
+	// OnError is called when a periodic flush fails; nil ignores failures.
+	OnError func(error)
+
+	backend Backend
+	mu      sync.Mutex
+	pending []Entry
+	flushMu sync.Mutex
+}
+
+// NewRecorder returns a recorder writing to backend.
+func NewRecorder(backend Backend) *Recorder {
+	return &Recorder{backend: backend}
+}
+
+// Backend returns the backend the recorder writes to.
+func (r *Recorder) Backend() Backend {
+	return r.backend
+}
+
+// Attach records every change made through obs, for all four tables.
+// Changes made through the store of a unit, see store.ObservableStore.Unit,
+// are recorded under that unit, so one recorder covers an observable store
+// wrapping several units; changes to the wrapped store itself are recorded
+// under unitID. The returned function stops recording.
+func (r *Recorder) Attach(obs *store.ObservableStore, unitID byte) (detach func()) {
+	var unsubscribe []func()
+	for t := store.TableCoils; t <= store.TableInputRegisters; t++ {
+		unsubscribe = append(unsubscribe, obs.Subscribe(store.AllOf(t), func(ev store.ChangeEvent) {
+			unit := unitID
+			if ev.InUnit {
+				unit = ev.UnitID
+			}
+			r.Record(unit, ev)
+		}))
+	}
+	return func() {
+		for _, fn := range unsubscribe {
+			fn()
+		}
+	}
+}
+
+// Record buffers one entry for every address whose value ev changed.
+func (r *Recorder) Record(unitID byte, ev store.ChangeEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range ev.NewValues {
+		if i < len(ev.OldValues) && ev.OldValues[i] == ev.NewValues[i] {
+			continue
+		}
+		e := Entry{
+			Time:     ev.Time,
+			UnitID:   unitID,
+			Table:    ev.Table,
+			Address:  ev.Address + uint16(i),
+			NewValue: ev.NewValues[i],
+			Source:   ev.Origin.Source,
+			Client:   ev.Origin.Client,
+		}
+		if i < len(ev.OldValues) {
+			e.OldValue = ev.OldValues[i]
+		}
+		r.pending = append(r.pending, e)
+	}
+}
+
+// Flush writes the buffered entries to the backend. If the backend fails
+// they stay buffered, ahead of any recorded since.
+func (r *Recorder) Flush() error {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	r.mu.Lock()
+	batch := r.pending[:len(r.pending):len(r.pending)]
+	r.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	if err := r.backend.Append(batch); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.pending = r.pending[len(batch):]
+	r.mu.Unlock()
+	return nil
+}
+
+// Run flushes every interval until ctx is done, then flushes once more and
+// returns the error of that final flush.
+func (r *Recorder) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return r.Flush()
+		case <-ticker.C:
+			if err := r.Flush(); err != nil && r.OnError != nil {
+				r.OnError(err)
+			}
+		}
+	}
+}
+
+// ValueAt returns the value an address held at t: the new value of its
+// latest change at or before t. ok is false when no such change was
+// recorded, or it has been dropped by retention.
+func (r *Recorder) ValueAt(unitID byte, table store.Table, address uint16, t time.Time) (value uint16, ok bool, err error) {
+	if err := r.Flush(); err != nil {
+		return 0, false, err
+	}
+	e, ok, err := r.backend.Last(unitID, table, address, t)
+	return e.NewValue, ok, err
+}
+
+// Changes returns the recorded changes matching q, oldest first.
+func (r *Recorder) Changes(q Query) ([]Entry, error) {
+	if err := r.Flush(); err != nil {
+		return nil, err
+	}
+	return r.backend.Changes(q)
+}
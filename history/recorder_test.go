@@ -0,0 +1,173 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package history
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+func TestRecorder_RecordsChanges(t *testing.T) {
+	obs := store.NewObservableStore(store.NewInMemoryStore())
+	rec := NewRecorder(NewMemoryBackend(Retention{}))
+	detach := rec.Attach(obs, 3)
+
+	obs.SetHoldingRegistersAt(10, []uint16{1, 2})
+	ctx := store.WithOrigin(context.Background(), store.Origin{Source: store.SourceModbus, UnitID: 3, Client: "10.0.0.5:502"})
+	store.BindContext(obs, ctx).SetHoldingRegistersAt(10, []uint16{1, 7})
+	obs.SetCoilsAt(0, []byte{1})
+
+	changes, err := rec.Changes(Query{UnitID: 3, Table: store.TableHoldingRegisters, Start: 0, End: 100})
+	if err != nil {
+		t.Fatalf("Changes() error = %v", err)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("Changes() = %+v, want 3 entries", changes)
+	}
+	last := changes[2]
+	if last.Address != 11 || last.OldValue != 2 || last.NewValue != 7 {
+		t.Errorf("last change = %+v, want address 11 from 2 to 7", last)
+	}
+	if last.Source != store.SourceModbus || last.Client != "10.0.0.5:502" || last.UnitID != 3 {
+		t.Errorf("last change origin = %+v", last)
+	}
+
+	coils, _ := rec.Changes(Address(3, store.TableCoils, 0))
+	if len(coils) != 1 || coils[0].NewValue != 1 {
+		t.Errorf("coil changes = %+v, want one change to 1", coils)
+	}
+
+	detach()
+	obs.SetHoldingRegistersAt(10, []uint16{9})
+	if changes, _ := rec.Changes(Address(3, store.TableHoldingRegisters, 10)); len(changes) != 1 {
+		t.Errorf("changes after detach = %+v, want 1", changes)
+	}
+}
+
+func TestRecorder_ValueAt(t *testing.T) {
+	rec := NewRecorder(NewMemoryBackend(Retention{}))
+	t0 := time.Date(2025, 3, 1, 3, 0, 0, 0, time.UTC)
+	for i, v := range []uint16{200, 215, 230} {
+		rec.Record(1, store.ChangeEvent{
+			Table:     store.TableHoldingRegisters,
+			Address:   100,
+			OldValues: []uint16{0},
+			NewValues: []uint16{v},
+			Time:      t0.Add(time.Duration(i) * 10 * time.Minute),
+		})
+	}
+
+	tests := []struct {
+		at     time.Time
+		want   uint16
+		wantOK bool
+	}{
+		{t0.Add(-time.Minute), 0, false},
+		{t0, 200, true},
+		{t0.Add(14 * time.Minute), 215, true},
+		{t0.Add(time.Hour), 230, true},
+	}
+	for _, tt := range tests {
+		got, ok, err := rec.ValueAt(1, store.TableHoldingRegisters, 100, tt.at)
+		if err != nil || got != tt.want || ok != tt.wantOK {
+			t.Errorf("ValueAt(%v) = %d, %v, %v, want %d, %v", tt.at, got, ok, err, tt.want, tt.wantOK)
+		}
+	}
+
+	between, _ := rec.Changes(Address(1, store.TableHoldingRegisters, 100).Between(t0.Add(5*time.Minute), t0.Add(20*time.Minute)))
+	if len(between) != 2 || between[0].NewValue != 215 || between[1].NewValue != 230 {
+		t.Errorf("Changes between = %+v, want 215 and 230", between)
+	}
+}
+
+type failingBackend struct {
+	Backend
+	fail bool
+}
+
+func (b *failingBackend) Append(entries []Entry) error {
+	if b.fail {
+		return errors.New("backend down")
+	}
+	return b.Backend.Append(entries)
+}
+
+func TestRecorder_FlushFailureKeepsEntries(t *testing.T) {
+	backend := &failingBackend{Backend: NewMemoryBackend(Retention{}), fail: true}
+	rec := NewRecorder(backend)
+	rec.Record(0, store.ChangeEvent{Table: store.TableInputRegisters, NewValues: []uint16{1}, OldValues: []uint16{0}, Time: time.Now()})
+
+	if err := rec.Flush(); err == nil {
+		t.Fatal("Flush() error = nil, want backend error")
+	}
+	backend.fail = false
+	changes, err := rec.Changes(Address(0, store.TableInputRegisters, 0))
+	if err != nil || len(changes) != 1 {
+		t.Errorf("Changes() = %+v, %v, want the buffered entry", changes, err)
+	}
+}
+
+func TestRecorder_RunFlushesOnCancel(t *testing.T) {
+	backend := NewMemoryBackend(Retention{})
+	rec := NewRecorder(backend)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- rec.Run(ctx, time.Hour) }()
+
+	rec.Record(0, store.ChangeEvent{Table: store.TableCoils, NewValues: []uint16{1}, OldValues: []uint16{0}, Time: time.Now()})
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if backend.Len() != 1 {
+		t.Errorf("backend holds %d entries, want 1", backend.Len())
+	}
+}
+
+func TestRecorder_AttachUsesStoreUnit(t *testing.T) {
+	units := store.NewUnitMap(store.NewInMemoryStore())
+	units.Set(9, store.NewInMemoryStore())
+	obs := store.NewObservableStore(units)
+	rec := NewRecorder(NewMemoryBackend(Retention{}))
+	defer rec.Attach(obs, 1)()
+
+	modbus := func(unit byte) context.Context {
+		return store.WithOrigin(context.Background(), store.Origin{Source: store.SourceModbus, UnitID: unit})
+	}
+	// A Modbus write to unit 9 and an application write to its store.
+	store.BindContext(store.StoreForUnit(obs, 9), modbus(9)).SetHoldingRegistersAt(0, []uint16{5})
+	unit9, _ := obs.Unit(9)
+	unit9.SetHoldingRegistersAt(1, []uint16{6})
+	// Unit 4 has no store of its own, so its write changes the default store.
+	store.BindContext(store.StoreForUnit(obs, 4), modbus(4)).SetHoldingRegistersAt(0, []uint16{7})
+	obs.SetHoldingRegistersAt(1, []uint16{8})
+
+	changes, _ := rec.Changes(Query{UnitID: 9, Table: store.TableHoldingRegisters, Start: 0, End: 1})
+	if len(changes) != 2 || changes[0].NewValue != 5 || changes[1].NewValue != 6 {
+		t.Errorf("unit 9 changes = %+v, want 5 and 6", changes)
+	}
+	changes, _ = rec.Changes(Query{UnitID: 1, Table: store.TableHoldingRegisters, Start: 0, End: 1})
+	if len(changes) != 2 || changes[0].NewValue != 7 || changes[1].NewValue != 8 {
+		t.Errorf("default store changes = %+v, want 7 and 8", changes)
+	}
+	if changes, _ := rec.Changes(Query{UnitID: 4, Table: store.TableHoldingRegisters, Start: 0, End: 1}); len(changes) != 0 {
+		t.Errorf("unit 4 changes = %+v, want none", changes)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package history
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+// SQLiteBackend keeps entries in a history table of a SQLite database,
+// usually the one of a store.SqliteStore, see SqliteStore.DB.
+type SQLiteBackend struct {
+	db        *sql.DB
+	retention Retention
+}
+
+var _ Backend = (*SQLiteBackend)(nil)
+
+const historySchema = `
+CREATE TABLE IF NOT EXISTS history (
+	seq INTEGER PRIMARY KEY,
+	time INTEGER NOT NULL,
+	unit_id INTEGER NOT NULL,
+	table_id INTEGER NOT NULL,
+	address INTEGER NOT NULL,
+	old_value INTEGER NOT NULL,
+	new_value INTEGER NOT NULL,
+	source INTEGER NOT NULL,
+	client TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS history_address ON history (unit_id, table_id, address, time);
+CREATE INDEX IF NOT EXISTS history_time ON history (time);
+`
+
+const historyColumns = "time, unit_id, table_id, address, old_value, new_value, source, client"
+
+// NewSQLiteBackend creates the history table in db if needed. Retention is
+// applied on every append. The backend does not close db.
+func NewSQLiteBackend(db *sql.DB, retention Retention) (*SQLiteBackend, error) {
+	if _, err := db.Exec(historySchema); err != nil {
+		return nil, err
+	}
+	return &SQLiteBackend{db: db, retention: retention}, nil
+}
+
+// Append implements Backend. The entries and the retention cleanup are
+// written in one transaction.
+func (b *SQLiteBackend) Append(entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("INSERT INTO history (" + historyColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, e := range entries {
+		_, err := stmt.Exec(e.Time.UnixNano(), e.UnitID, int(e.Table), e.Address, e.OldValue, e.NewValue, int(e.Source), e.Client)
+		if err != nil {
+			return err
+		}
+	}
+
+	if b.retention.MaxAge > 0 {
+		cutoff := entries[len(entries)-1].Time.Add(-b.retention.MaxAge).UnixNano()
+		if _, err := tx.Exec("DELETE FROM history WHERE time < ?", cutoff); err != nil {
+			return err
+		}
+	}
+	if b.retention.MaxEntries > 0 {
+		_, err := tx.Exec("DELETE FROM history WHERE seq <= (SELECT MAX(seq) FROM history) - ?", b.retention.MaxEntries)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Changes implements Backend.
+func (b *SQLiteBackend) Changes(q Query) ([]Entry, error) {
+	from, to := int64(math.MinInt64), int64(math.MaxInt64)
+	if !q.From.IsZero() {
+		from = q.From.UnixNano()
+	}
+	if !q.To.IsZero() {
+		to = q.To.UnixNano()
+	}
+
+	rows, err := b.db.Query(
+		"SELECT "+historyColumns+" FROM history"+
+			" WHERE unit_id = ? AND table_id = ? AND address BETWEEN ? AND ? AND time BETWEEN ? AND ?"+
+			" ORDER BY seq",
+		q.UnitID, int(q.Table), q.Start, q.End, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Entry
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// Last implements Backend.
+func (b *SQLiteBackend) Last(unitID byte, table store.Table, address uint16, t time.Time) (Entry, bool, error) {
+	row := b.db.QueryRow(
+		"SELECT "+historyColumns+" FROM history"+
+			" WHERE unit_id = ? AND table_id = ? AND address = ? AND time <= ?"+
+			" ORDER BY time DESC, seq DESC LIMIT 1",
+		unitID, int(table), address, t.UnixNano())
+	e, err := scanEntry(row)
+	if err == sql.ErrNoRows {
+		return Entry{}, false, nil
+	}
+	if err != nil {
+		return Entry{}, false, err
+	}
+	return e, true, nil
+}
+
+func scanEntry(row interface{ Scan(...any) error }) (Entry, error) {
+	var (
+		e             Entry
+		ns            int64
+		table, source int
+	)
+	err := row.Scan(&ns, &e.UnitID, &table, &e.Address, &e.OldValue, &e.NewValue, &source, &e.Client)
+	if err != nil {
+		return Entry{}, err
+	}
+	e.Time = time.Unix(0, ns).UTC()
+	e.Table = store.Table(table)
+	e.Source = store.Source(source)
+	return e, nil
+}
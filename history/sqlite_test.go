@@ -0,0 +1,90 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+func newSQLiteBackend(t *testing.T, retention Retention) *SQLiteBackend {
+	t.Helper()
+	st, err := store.NewSqliteStore(":memory:")
+	if err != nil {
+		t.Fatalf("NewSqliteStore() error = %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	b, err := NewSQLiteBackend(st.DB(), retention)
+	if err != nil {
+		t.Fatalf("NewSQLiteBackend() error = %v", err)
+	}
+	return b
+}
+
+func TestSQLiteBackend_Queries(t *testing.T) {
+	b := newSQLiteBackend(t, Retention{})
+	t0 := time.Date(2025, 3, 1, 3, 14, 0, 0, time.UTC)
+	err := b.Append([]Entry{
+		{Time: t0, UnitID: 1, Table: store.TableHoldingRegisters, Address: 5, OldValue: 0, NewValue: 10, Source: store.SourceModbus, Client: "hmi:502"},
+		{Time: t0.Add(time.Minute), UnitID: 1, Table: store.TableHoldingRegisters, Address: 6, NewValue: 20},
+		{Time: t0.Add(2 * time.Minute), UnitID: 1, Table: store.TableHoldingRegisters, Address: 5, OldValue: 10, NewValue: 11},
+		{Time: t0.Add(2 * time.Minute), UnitID: 2, Table: store.TableHoldingRegisters, Address: 5, NewValue: 99},
+	})
+	if err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	e, ok, err := b.Last(1, store.TableHoldingRegisters, 5, t0.Add(90*time.Second))
+	if err != nil || !ok {
+		t.Fatalf("Last() = %v, %v", ok, err)
+	}
+	if !e.Time.Equal(t0) || e.NewValue != 10 || e.Source != store.SourceModbus || e.Client != "hmi:502" {
+		t.Errorf("Last() = %+v", e)
+	}
+	if _, ok, _ := b.Last(1, store.TableHoldingRegisters, 5, t0.Add(-time.Second)); ok {
+		t.Error("Last() before the first change reported a value")
+	}
+
+	changes, err := b.Changes(Query{UnitID: 1, Table: store.TableHoldingRegisters, Start: 0, End: 10}.Between(t0.Add(time.Minute), time.Time{}))
+	if err != nil {
+		t.Fatalf("Changes() error = %v", err)
+	}
+	if len(changes) != 2 || changes[0].Address != 6 || changes[1].NewValue != 11 {
+		t.Errorf("Changes() = %+v", changes)
+	}
+}
+
+func TestSQLiteBackend_Retention(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	byAge := newSQLiteBackend(t, Retention{MaxAge: 5 * time.Minute})
+	byAge.Append(entriesAt(t0, 10))
+	changes, _ := byAge.Changes(Address(0, store.TableHoldingRegisters, 0))
+	if len(changes) != 6 || changes[0].NewValue != 4 {
+		t.Errorf("MaxAge kept %+v, want 6 entries from 4", changes)
+	}
+
+	byCount := newSQLiteBackend(t, Retention{MaxEntries: 3})
+	byCount.Append(entriesAt(t0, 5))
+	byCount.Append(entriesAt(t0.Add(time.Hour), 5))
+	changes, _ = byCount.Changes(Address(0, store.TableHoldingRegisters, 0))
+	if len(changes) != 3 || changes[0].NewValue != 2 {
+		t.Errorf("MaxEntries kept %+v, want 3 entries from 2", changes)
+	}
+}
@@ -13,23 +13,70 @@
 // You should have received a copy of the GNU Affero General Public License
 // along with this program.  If not, see <https://www.gnu.org/licenses/>.
 
+// Package logger defines the structured log attributes emitted by the
+// server and a JSON log/slog constructor.
 package logger
 
 import (
+	"encoding/hex"
+	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"time"
 )
 
-type Logger struct {
-	writer io.Writer
+// Attribute keys used in every record emitted by the server.
+const (
+	KeyRemoteAddr    = "remote_addr"
+	KeyConnID        = "conn_id"
+	KeyUnitID        = "unit_id"
+	KeyFuncCode      = "function_code"
+	KeyAddress       = "address"
+	KeyQuantity      = "quantity"
+	KeyTransactionID = "transaction_id"
+	KeyLatency       = "latency"
+	KeyError         = "error"
+	KeyExceptionCode = "exception_code"
+	KeyFrame         = "frame"
+)
+
+// New returns a logger writing JSON records at or above level to w.
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// Discard returns a logger that drops every record.
+func Discard() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
 }
 
-func NewLogger(w io.Writer) *Logger {
-	return &Logger{writer: w}
+func RemoteAddr(addr fmt.Stringer) slog.Attr {
+	if addr == nil {
+		return slog.String(KeyRemoteAddr, "")
+	}
+	return slog.String(KeyRemoteAddr, addr.String())
 }
 
-func (l *Logger) Log(message string) {
-	logger := log.New(l.writer, "[MODBUS] ", log.Ldate|log.Ltime)
-	logger.Println(message)
+func ConnID(id uint64) slog.Attr { return slog.Uint64(KeyConnID, id) }
+
+func UnitID(id byte) slog.Attr { return slog.Int(KeyUnitID, int(id)) }
+
+// FuncCode formats the function code as hex, as in the Modbus specification.
+func FuncCode(code byte) slog.Attr { return slog.String(KeyFuncCode, fmt.Sprintf("0x%02X", code)) }
+
+func Address(addr uint16) slog.Attr { return slog.Int(KeyAddress, int(addr)) }
+
+func Quantity(n uint16) slog.Attr { return slog.Int(KeyQuantity, int(n)) }
+
+func TransactionID(id uint16) slog.Attr { return slog.Int(KeyTransactionID, int(id)) }
+
+func Latency(d time.Duration) slog.Attr { return slog.Duration(KeyLatency, d) }
+
+func Err(err error) slog.Attr { return slog.String(KeyError, err.Error()) }
+
+func ExceptionCode(code byte) slog.Attr {
+	return slog.String(KeyExceptionCode, fmt.Sprintf("0x%02X", code))
 }
 
+// Frame hex-encodes a raw frame.
+func Frame(frame []byte) slog.Attr { return slog.String(KeyFrame, hex.EncodeToString(frame)) }
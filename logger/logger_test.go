@@ -0,0 +1,63 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"testing"
+)
+
+func TestNew_JSONAndLevel(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, slog.LevelInfo)
+
+	l.Debug("dropped")
+	l.LogAttrs(context.Background(), slog.LevelInfo, "kept",
+		RemoteAddr(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 502}),
+		FuncCode(0x03),
+		UnitID(1),
+		Err(errors.New("boom")),
+		Frame([]byte{0x00, 0x01, 0xFF}))
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected a single JSON record, got %q: %v", buf.String(), err)
+	}
+	expected := map[string]any{
+		"msg":         "kept",
+		KeyRemoteAddr: "127.0.0.1:502",
+		KeyFuncCode:   "0x03",
+		KeyUnitID:     float64(1),
+		KeyError:      "boom",
+		KeyFrame:      "0001ff",
+	}
+	for key, want := range expected {
+		if record[key] != want {
+			t.Errorf("record[%q] = %v; want %v", key, record[key], want)
+		}
+	}
+}
+
+func TestRemoteAddr_Nil(t *testing.T) {
+	if got := RemoteAddr(nil).Value.String(); got != "" {
+		t.Errorf("RemoteAddr(nil) = %q; want empty", got)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package metrics collects server and store metrics and exposes them in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Metrics holds the counters and histograms of one Modbus server. Attach it
+// with Server.SetMetrics and serve Handler on the scrape endpoint.
+type Metrics struct {
+	registry        registry
+	requests        *counterVec
+	exceptions      *counterVec
+	parseFailures   *counterVec
+	bytesIn         *counterVec
+	bytesOut        *counterVec
+	requestDuration *histogramVec
+	storeDuration   *histogramVec
+	connections     gaugeFunc
+	connectionsOnce sync.Once
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		requests:        newCounterVec("modbus_requests_total", "Requests handled, by function code and unit ID.", "function_code", "unit_id"),
+		exceptions:      newCounterVec("modbus_exceptions_total", "Exception responses sent, by exception code.", "exception_code"),
+		parseFailures:   newCounterVec("modbus_parse_failures_total", "Frames that could not be parsed."),
+		bytesIn:         newCounterVec("modbus_received_bytes_total", "Bytes read from clients."),
+		bytesOut:        newCounterVec("modbus_sent_bytes_total", "Bytes written to clients."),
+		requestDuration: newHistogramVec("modbus_request_duration_seconds", "Request handling latency, by function code.", DefaultBuckets, "function_code"),
+		storeDuration:   newHistogramVec("modbus_store_operation_duration_seconds", "Store operation latency, by backend and operation.", DefaultBuckets, "backend", "operation"),
+		connections:     gaugeFunc{name: "modbus_active_connections", help: "Client connections currently open."},
+	}
+	m.registry.register(m.requests)
+	m.registry.register(m.exceptions)
+	m.registry.register(m.parseFailures)
+	m.registry.register(m.bytesIn)
+	m.registry.register(m.bytesOut)
+	m.registry.register(m.requestDuration)
+	m.registry.register(m.storeDuration)
+	return m
+}
+
+// SetActiveConnections sets the function reporting open connections. The
+// server calls it when the metrics are attached; a later call replaces the
+// function, so the gauge is exposed once.
+func (m *Metrics) SetActiveConnections(fn func() float64) {
+	m.connections.set(fn)
+	m.connectionsOnce.Do(func() { m.registry.register(&m.connections) })
+}
+
+// ObserveRequest records a handled request and its latency.
+func (m *Metrics) ObserveRequest(funcCode, unitID byte, d time.Duration) {
+	fc := formatFuncCode(funcCode)
+	m.requests.add(1, fc, strconv.Itoa(int(unitID)))
+	m.requestDuration.observe(d.Seconds(), fc)
+}
+
+// ObserveException records an exception response.
+func (m *Metrics) ObserveException(code byte) {
+	m.exceptions.add(1, formatFuncCode(code))
+}
+
+// ObserveParseFailure records a frame that could not be parsed.
+func (m *Metrics) ObserveParseFailure() {
+	m.parseFailures.add(1)
+}
+
+// AddBytesIn records bytes read from a client.
+func (m *Metrics) AddBytesIn(n int) {
+	m.bytesIn.add(float64(n))
+}
+
+// AddBytesOut records bytes written to a client.
+func (m *Metrics) AddBytesOut(n int) {
+	m.bytesOut.add(float64(n))
+}
+
+// ObserveStoreOperation records the latency of a store operation.
+func (m *Metrics) ObserveStoreOperation(backend, operation string, d time.Duration) {
+	m.storeDuration.observe(d.Seconds(), backend, operation)
+}
+
+// WriteTo writes all metrics in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	if err := m.registry.write(&buf); err != nil {
+		return 0, err
+	}
+	return buf.WriteTo(w)
+}
+
+// Handler returns an http.Handler serving the metrics for scraping.
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.WriteTo(w)
+	})
+}
+
+func formatFuncCode(code byte) string {
+	return fmt.Sprintf("0x%02X", code)
+}
@@ -0,0 +1,72 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics_Handler(t *testing.T) {
+	m := New()
+	m.SetActiveConnections(func() float64 { return 3 })
+	m.ObserveRequest(0x03, 1, 2*time.Millisecond)
+	m.ObserveException(0x02)
+	m.ObserveParseFailure()
+	m.AddBytesIn(12)
+	m.AddBytesOut(9)
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	body := rec.Body.String()
+	for _, line := range []string{
+		"modbus_requests_total{function_code=\"0x03\",unit_id=\"1\"} 1",
+		"modbus_exceptions_total{exception_code=\"0x02\"} 1",
+		"modbus_parse_failures_total 1",
+		"modbus_received_bytes_total 12",
+		"modbus_sent_bytes_total 9",
+		"modbus_request_duration_seconds_count{function_code=\"0x03\"} 1",
+		"modbus_active_connections 3",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing line %q in:\n%s", line, body)
+		}
+	}
+}
+
+func TestMetrics_SetActiveConnectionsTwice(t *testing.T) {
+	m := New()
+	m.SetActiveConnections(func() float64 { return 1 })
+	m.SetActiveConnections(func() float64 { return 2 })
+
+	var buf strings.Builder
+	if err := m.registry.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	body := buf.String()
+	if n := strings.Count(body, "# TYPE modbus_active_connections gauge"); n != 1 {
+		t.Errorf("gauge exposed %d times in:\n%s", n, body)
+	}
+	if !strings.Contains(body, "modbus_active_connections 2\n") {
+		t.Errorf("gauge does not report the last function:\n%s", body)
+	}
+}
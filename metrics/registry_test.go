@@ -0,0 +1,77 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCounterVec_Write(t *testing.T) {
+	c := newCounterVec("test_total", "Test counter.", "code")
+	c.add(1, "a")
+	c.add(2, "b")
+	c.add(1, "a")
+
+	var buf bytes.Buffer
+	if err := c.write(&buf); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+	expected := "# HELP test_total Test counter.\n# TYPE test_total counter\ntest_total{code=\"a\"} 2\ntest_total{code=\"b\"} 2\n"
+	if buf.String() != expected {
+		t.Errorf("write() = %q; want %q", buf.String(), expected)
+	}
+}
+
+func TestCounterVec_WriteUnlabelledZero(t *testing.T) {
+	c := newCounterVec("test_total", "Test counter.")
+
+	var buf bytes.Buffer
+	c.write(&buf)
+	if !strings.HasSuffix(buf.String(), "test_total 0\n") {
+		t.Errorf("expected zero sample, got %q", buf.String())
+	}
+}
+
+func TestHistogramVec_Write(t *testing.T) {
+	h := newHistogramVec("test_seconds", "Test histogram.", []float64{0.1, 1}, "op")
+	h.observe(0.05, "read")
+	h.observe(0.5, "read")
+	h.observe(5, "read")
+
+	var buf bytes.Buffer
+	if err := h.write(&buf); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+	for _, line := range []string{
+		"test_seconds_bucket{op=\"read\",le=\"0.1\"} 1",
+		"test_seconds_bucket{op=\"read\",le=\"1\"} 2",
+		"test_seconds_bucket{op=\"read\",le=\"+Inf\"} 3",
+		"test_seconds_sum{op=\"read\"} 5.55",
+		"test_seconds_count{op=\"read\"} 3",
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("missing line %q in:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got := escapeLabel("a\"b\\c\n"); got != "a\\\"b\\\\c\\n" {
+		t.Errorf("escapeLabel() = %q", got)
+	}
+}
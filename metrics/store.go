@@ -0,0 +1,211 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+// InstrumentedStore times every operation of the wrapped store and reports it
+// under the given backend label. The optional methods of the wrapped store,
+// such as the units of a store.UnitStore, View and bit access, are forwarded.
+type InstrumentedStore struct {
+	store.Store
+	backend string
+	metrics *Metrics
+}
+
+// InstrumentStore wraps st so that its operation latency is recorded in m.
+func InstrumentStore(st store.Store, backend string, m *Metrics) *InstrumentedStore {
+	return &InstrumentedStore{Store: st, backend: backend, metrics: m}
+}
+
+var _ store.UnitStore = (*InstrumentedStore)(nil)
+
+// WithContext binds the wrapped store to ctx, see store.ContextStore.
+func (s *InstrumentedStore) WithContext(ctx context.Context) store.Store {
+	return &InstrumentedStore{Store: store.BindContext(s.Store, ctx), backend: s.backend, metrics: s.metrics}
+}
+
+func (s *InstrumentedStore) observe(operation string, start time.Time) {
+	s.metrics.ObserveStoreOperation(s.backend, operation, time.Since(start))
+}
+
+func (s *InstrumentedStore) GetCoils(start, quantity uint16) ([]byte, error) {
+	defer s.observe("get_coils", time.Now())
+	return s.Store.GetCoils(start, quantity)
+}
+
+func (s *InstrumentedStore) GetDiscreteInputs(start, quantity uint16) ([]byte, error) {
+	defer s.observe("get_discrete_inputs", time.Now())
+	return s.Store.GetDiscreteInputs(start, quantity)
+}
+
+func (s *InstrumentedStore) GetHoldingRegisters(start, quantity uint16) ([]uint16, error) {
+	defer s.observe("get_holding_registers", time.Now())
+	return s.Store.GetHoldingRegisters(start, quantity)
+}
+
+func (s *InstrumentedStore) GetInputRegisters(start, quantity uint16) ([]uint16, error) {
+	defer s.observe("get_input_registers", time.Now())
+	return s.Store.GetInputRegisters(start, quantity)
+}
+
+func (s *InstrumentedStore) SetCoils(values []byte) error {
+	defer s.observe("set_coils", time.Now())
+	return s.Store.SetCoils(values)
+}
+
+func (s *InstrumentedStore) SetDiscreteInputs(values []byte) error {
+	defer s.observe("set_discrete_inputs", time.Now())
+	return s.Store.SetDiscreteInputs(values)
+}
+
+func (s *InstrumentedStore) SetHoldingRegisters(values []uint16) error {
+	defer s.observe("set_holding_registers", time.Now())
+	return s.Store.SetHoldingRegisters(values)
+}
+
+func (s *InstrumentedStore) SetInputRegisters(values []uint16) error {
+	defer s.observe("set_input_registers", time.Now())
+	return s.Store.SetInputRegisters(values)
+}
+
+func (s *InstrumentedStore) SetCoilsAt(start uint16, values []byte) error {
+	defer s.observe("set_coils_at", time.Now())
+	return s.Store.SetCoilsAt(start, values)
+}
+
+func (s *InstrumentedStore) SetDiscreteInputsAt(start uint16, values []byte) error {
+	defer s.observe("set_discrete_inputs_at", time.Now())
+	return s.Store.SetDiscreteInputsAt(start, values)
+}
+
+func (s *InstrumentedStore) SetHoldingRegistersAt(start uint16, values []uint16) error {
+	defer s.observe("set_holding_registers_at", time.Now())
+	return s.Store.SetHoldingRegistersAt(start, values)
+}
+
+func (s *InstrumentedStore) SetInputRegistersAt(start uint16, values []uint16) error {
+	defer s.observe("set_input_registers_at", time.Now())
+	return s.Store.SetInputRegistersAt(start, values)
+}
+
+func (s *InstrumentedStore) Update(fn func(tx store.Transaction) error) error {
+	defer s.observe("update", time.Now())
+	return s.Store.Update(fn)
+}
+
+// Units implements store.UnitStore. It is empty unless the wrapped store is
+// a UnitStore.
+func (s *InstrumentedStore) Units() []byte {
+	if us, ok := s.Store.(store.UnitStore); ok {
+		return us.Units()
+	}
+	return nil
+}
+
+// Unit implements store.UnitStore, returning the store of the unit
+// instrumented under the same backend label.
+func (s *InstrumentedStore) Unit(id byte) (store.Store, bool) {
+	us, ok := s.Store.(store.UnitStore)
+	if !ok {
+		return nil, false
+	}
+	unit, ok := us.Unit(id)
+	if !ok {
+		return nil, false
+	}
+	return &InstrumentedStore{Store: unit, backend: s.backend, metrics: s.metrics}, true
+}
+
+// Windows returns the defined addresses of a table when the wrapped store
+// has windows, nil otherwise.
+func (s *InstrumentedStore) Windows(table store.Table) []store.Window {
+	if w, ok := s.Store.(interface {
+		Windows(store.Table) []store.Window
+	}); ok {
+		return w.Windows(table)
+	}
+	return nil
+}
+
+// View calls fn with a consistent snapshot of the wrapped store. It fails
+// with errors.ErrUnsupported when the wrapped store has no View.
+func (s *InstrumentedStore) View(fn func(r store.Reader) error) error {
+	v, ok := s.Store.(interface {
+		View(fn func(r store.Reader) error) error
+	})
+	if !ok {
+		return fmt.Errorf("metrics: %T has no View: %w", s.Store, errors.ErrUnsupported)
+	}
+	defer s.observe("view", time.Now())
+	return v.View(fn)
+}
+
+// GetBit returns a single coil or discrete input.
+func (s *InstrumentedStore) GetBit(table store.Table, address uint16) (bool, error) {
+	defer s.observe("get_bit", time.Now())
+	if b, ok := s.Store.(interface {
+		GetBit(table store.Table, address uint16) (bool, error)
+	}); ok {
+		return b.GetBit(table, address)
+	}
+
+	var bits []byte
+	var err error
+	switch table {
+	case store.TableCoils:
+		bits, err = s.Store.GetCoils(address, 1)
+	case store.TableDiscreteInputs:
+		bits, err = s.Store.GetDiscreteInputs(address, 1)
+	default:
+		return false, store.ErrInvalidTable
+	}
+	if err != nil {
+		return false, err
+	}
+	return bits[0] != 0, nil
+}
+
+// SetBits writes coils or discrete inputs from start.
+func (s *InstrumentedStore) SetBits(table store.Table, start uint16, values []bool) error {
+	defer s.observe("set_bits", time.Now())
+	if b, ok := s.Store.(interface {
+		SetBits(table store.Table, start uint16, values []bool) error
+	}); ok {
+		return b.SetBits(table, start, values)
+	}
+
+	bits := make([]byte, len(values))
+	for i, v := range values {
+		if v {
+			bits[i] = 1
+		}
+	}
+	switch table {
+	case store.TableCoils:
+		return s.Store.SetCoilsAt(start, bits)
+	case store.TableDiscreteInputs:
+		return s.Store.SetDiscreteInputsAt(start, bits)
+	}
+	return store.ErrInvalidTable
+}
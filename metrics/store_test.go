@@ -0,0 +1,105 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+func TestInstrumentStore(t *testing.T) {
+	m := New()
+	st := InstrumentStore(store.NewInMemoryStore(), "memory", m)
+
+	if err := st.SetHoldingRegistersAt(0, []uint16{1, 2}); err != nil {
+		t.Fatalf("SetHoldingRegistersAt() error = %v", err)
+	}
+	values, err := st.GetHoldingRegisters(0, 2)
+	if err != nil {
+		t.Fatalf("GetHoldingRegisters() error = %v", err)
+	}
+	if values[1] != 2 {
+		t.Errorf("GetHoldingRegisters() = %v", values)
+	}
+
+	for _, op := range []string{"set_holding_registers_at", "get_holding_registers"} {
+		m.storeDuration.mu.Lock()
+		hist, ok := m.storeDuration.values[labelKey([]string{"memory", op})]
+		m.storeDuration.mu.Unlock()
+		if !ok || hist.count != 1 {
+			t.Errorf("operation %s not recorded", op)
+		}
+	}
+}
+
+func TestInstrumentStore_Units(t *testing.T) {
+	def, unit := store.NewInMemoryStore(), store.NewInMemoryStore()
+	units := store.NewUnitMap(def)
+	units.Set(9, unit)
+	m := New()
+	st := InstrumentStore(units, "memory", m)
+
+	if err := store.StoreForUnit(st, 9).SetHoldingRegistersAt(1, []uint16{9}); err != nil {
+		t.Fatal(err)
+	}
+	if values, _ := unit.GetHoldingRegisters(1, 1); values[0] != 9 {
+		t.Errorf("unit 9 store = %v, want [9]", values)
+	}
+	if values, _ := def.GetHoldingRegisters(1, 1); values[0] != 0 {
+		t.Errorf("default store = %v, want [0]", values)
+	}
+	m.storeDuration.mu.Lock()
+	_, ok := m.storeDuration.values[labelKey([]string{"memory", "set_holding_registers_at"})]
+	m.storeDuration.mu.Unlock()
+	if !ok {
+		t.Error("unit write not recorded")
+	}
+}
+
+func TestInstrumentStore_OptionalMethods(t *testing.T) {
+	mem := store.NewInMemoryStore(store.WithWindows(store.TableHoldingRegisters, store.Window{Start: 100, End: 109}))
+	st := InstrumentStore(mem, "memory", New())
+
+	if w := st.Windows(store.TableHoldingRegisters); len(w) != 1 || w[0].Start != 100 {
+		t.Errorf("Windows() = %v", w)
+	}
+	if err := st.SetBits(store.TableCoils, 3, []bool{true}); err != nil {
+		t.Fatal(err)
+	}
+	if on, err := st.GetBit(store.TableCoils, 3); err != nil || !on {
+		t.Errorf("GetBit() = %v, %v", on, err)
+	}
+	if err := st.View(func(r store.Reader) error {
+		_, err := r.GetHoldingRegisters(100, 10)
+		return err
+	}); err != nil {
+		t.Errorf("View() error = %v", err)
+	}
+
+	// Stores without bit access or View fall back or report it.
+	plain := InstrumentStore(struct{ store.Store }{store.NewInMemoryStore()}, "plain", New())
+	if err := plain.SetBits(store.TableDiscreteInputs, 0, []bool{false, true}); err != nil {
+		t.Fatal(err)
+	}
+	if on, err := plain.GetBit(store.TableDiscreteInputs, 1); err != nil || !on {
+		t.Errorf("GetBit() fallback = %v, %v", on, err)
+	}
+	if err := plain.View(func(store.Reader) error { return nil }); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("View() error = %v, want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package mbserver
+
+import "context"
+
+// HandlerFunc processes a parsed request and returns the complete response
+// frame. Returning a *protocol.ModbusError makes the server answer with the
+// matching exception response. ctx carries the connection metadata, see
+// ConnInfoFromContext.
+type HandlerFunc func(ctx context.Context, req Request) ([]byte, error)
+
+// Middleware wraps a HandlerFunc with cross-cutting behaviour such as
+// logging, rate limiting or access policy.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Use appends middlewares to the dispatch chain. The first middleware
+// registered is the outermost one. Middlewares wrap built-in and custom
+// handlers alike. Use must be called before Start.
+func (s *Server) Use(mw ...Middleware) {
+	s.middlewares = append(s.middlewares, mw...)
+	chain := HandlerFunc(s.route)
+	for i := len(s.middlewares) - 1; i >= 0; i-- {
+		chain = s.middlewares[i](chain)
+	}
+	s.chain = chain
+}
@@ -0,0 +1,52 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	modbus_server "github.com/hootrhino/goodbusserver"
+	"github.com/hootrhino/goodbusserver/protocol"
+)
+
+// MetricsRecorder receives the outcome and duration of every request.
+// *metrics.Metrics implements it.
+type MetricsRecorder interface {
+	ObserveRequest(funcCode, unitID byte, d time.Duration)
+	ObserveException(code byte)
+}
+
+// Metrics times every request passing this point of the chain and reports
+// it to r, with the exception code of failed requests. Server.SetMetrics
+// already records every request; use this middleware instead when only the
+// requests that get past earlier middlewares should count, not both with
+// the same recorder.
+func Metrics(r MetricsRecorder) modbus_server.Middleware {
+	return func(next modbus_server.HandlerFunc) modbus_server.HandlerFunc {
+		return func(ctx context.Context, req modbus_server.Request) ([]byte, error) {
+			start := time.Now()
+			resp, err := next(ctx, req)
+			r.ObserveRequest(req.FuncCode, req.SlaveID, time.Since(start))
+			var exception *protocol.ModbusError
+			if errors.As(err, &exception) {
+				r.ObserveException(exception.Code)
+			}
+			return resp, err
+		}
+	}
+}
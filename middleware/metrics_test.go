@@ -0,0 +1,58 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	modbus_server "github.com/hootrhino/goodbusserver"
+	"github.com/hootrhino/goodbusserver/metrics"
+	"github.com/hootrhino/goodbusserver/protocol"
+)
+
+var _ MetricsRecorder = (*metrics.Metrics)(nil)
+
+func TestMetrics(t *testing.T) {
+	m := metrics.New()
+	fail := Metrics(m)(func(ctx context.Context, req modbus_server.Request) ([]byte, error) {
+		return nil, protocol.ErrIllegalDataAddress
+	})
+	dropped := Metrics(m)(func(ctx context.Context, req modbus_server.Request) ([]byte, error) {
+		return nil, errors.New("dropped")
+	})
+	ok := Metrics(m)(okHandler)
+
+	ok(context.Background(), modbus_server.Request{FuncCode: 0x03, SlaveID: 1})
+	ok(context.Background(), modbus_server.Request{FuncCode: 0x03, SlaveID: 1})
+	fail(context.Background(), modbus_server.Request{FuncCode: 0x03, SlaveID: 1})
+	dropped(context.Background(), modbus_server.Request{FuncCode: 0x03, SlaveID: 1})
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, line := range []string{
+		`modbus_requests_total{function_code="0x03",unit_id="1"} 4`,
+		`modbus_exceptions_total{exception_code="0x02"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing line %q in:\n%s", line, body)
+		}
+	}
+}
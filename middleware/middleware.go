@@ -13,19 +13,29 @@
 // You should have received a copy of the GNU Affero General Public License
 // along with this program.  If not, see <https://www.gnu.org/licenses/>.
 
+// Package middleware provides standard middlewares for modbus_server.Server.
+// Register them with Server.Use.
 package middleware
 
 import (
+	"context"
+
 	modbus_server "github.com/hootrhino/goodbusserver"
 )
 
-// Since modbus_server.Handler is undefined, we'll create a placeholder type for it.
-// This should be replaced with the actual definition once it's available.
-type MockHandler func(request interface{}) ([]byte, error)
-
-type Middleware func(next MockHandler) MockHandler
-
 type Logger interface {
 	LogRequest(request modbus_server.Request)
 	LogResponse(response []byte, err error)
 }
+
+// Logging reports every request and its outcome to l.
+func Logging(l Logger) modbus_server.Middleware {
+	return func(next modbus_server.HandlerFunc) modbus_server.HandlerFunc {
+		return func(ctx context.Context, req modbus_server.Request) ([]byte, error) {
+			l.LogRequest(req)
+			resp, err := next(ctx, req)
+			l.LogResponse(resp, err)
+			return resp, err
+		}
+	}
+}
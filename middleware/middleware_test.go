@@ -0,0 +1,55 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	modbus_server "github.com/hootrhino/goodbusserver"
+)
+
+type recordingLogger struct {
+	requests  []modbus_server.Request
+	responses [][]byte
+}
+
+func (l *recordingLogger) LogRequest(request modbus_server.Request) {
+	l.requests = append(l.requests, request)
+}
+
+func (l *recordingLogger) LogResponse(response []byte, err error) {
+	l.responses = append(l.responses, response)
+}
+
+func okHandler(ctx context.Context, req modbus_server.Request) ([]byte, error) {
+	return []byte{req.FuncCode}, nil
+}
+
+func TestLogging(t *testing.T) {
+	l := &recordingLogger{}
+	h := Logging(l)(okHandler)
+
+	if _, err := h(context.Background(), modbus_server.Request{FuncCode: 0x03}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(l.requests) != 1 || l.requests[0].FuncCode != 0x03 {
+		t.Errorf("LogRequest not called with request: %v", l.requests)
+	}
+	if len(l.responses) != 1 || l.responses[0][0] != 0x03 {
+		t.Errorf("LogResponse not called with response: %v", l.responses)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	modbus_server "github.com/hootrhino/goodbusserver"
+	"github.com/hootrhino/goodbusserver/protocol"
+)
+
+func TestRateLimit(t *testing.T) {
+	h := RateLimit(0.001, 2)(okHandler)
+
+	for i := 0; i < 2; i++ {
+		if _, err := h(context.Background(), modbus_server.Request{FuncCode: 0x03}); err != nil {
+			t.Fatalf("request %d: unexpected error: %v", i, err)
+		}
+	}
+	if _, err := h(context.Background(), modbus_server.Request{FuncCode: 0x03}); err != protocol.ErrServerDeviceBusy {
+		t.Fatalf("expected ErrServerDeviceBusy, got %v", err)
+	}
+}
+
+func TestTokenBucket_Refill(t *testing.T) {
+	now := time.Now()
+	b := &tokenBucket{rate: 10, burst: 1, tokens: 0, last: now}
+
+	if b.allow(now) {
+		t.Fatal("expected empty bucket to reject")
+	}
+	if !b.allow(now.Add(100 * time.Millisecond)) {
+		t.Fatal("expected bucket to refill after 100ms")
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package middleware
+
+import (
+	"context"
+
+	modbus_server "github.com/hootrhino/goodbusserver"
+	"github.com/hootrhino/goodbusserver/protocol"
+)
+
+// ReadOnly rejects every standard write function code, plus any custom codes
+// listed in extra, with exception 0x01 Illegal Function.
+func ReadOnly(extra ...byte) modbus_server.Middleware {
+	return func(next modbus_server.HandlerFunc) modbus_server.HandlerFunc {
+		return func(ctx context.Context, req modbus_server.Request) ([]byte, error) {
+			if protocol.IsWriteFuncCode(req.FuncCode) {
+				return nil, protocol.ErrIllegalFunction
+			}
+			for _, code := range extra {
+				if req.FuncCode == code {
+					return nil, protocol.ErrIllegalFunction
+				}
+			}
+			return next(ctx, req)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	modbus_server "github.com/hootrhino/goodbusserver"
+	"github.com/hootrhino/goodbusserver/protocol"
+)
+
+func TestReadOnly(t *testing.T) {
+	h := ReadOnly(0x41)(okHandler)
+
+	if _, err := h(context.Background(), modbus_server.Request{FuncCode: protocol.FuncCodeReadHoldingRegisters}); err != nil {
+		t.Errorf("read rejected: %v", err)
+	}
+	for _, code := range []byte{protocol.FuncCodeWriteSingleRegister, protocol.FuncCodeWriteMultipleCoils, 0x41} {
+		if _, err := h(context.Background(), modbus_server.Request{FuncCode: code}); err != protocol.ErrIllegalFunction {
+			t.Errorf("FuncCode 0x%02X: expected ErrIllegalFunction, got %v", code, err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package middleware
+
+import (
+	"context"
+	"runtime/debug"
+
+	modbus_server "github.com/hootrhino/goodbusserver"
+)
+
+// Recovery converts a panic in the wrapped handler into a
+// *modbus_server.PanicError, answered with exception 0x04 Server Device
+// Failure. The server already recovers around the whole chain; Recovery is
+// useful to contain panics below a middleware that must still see the
+// result. onPanic, if not nil, is called with the request and the recovered
+// value.
+func Recovery(onPanic func(req modbus_server.Request, v any)) modbus_server.Middleware {
+	return func(next modbus_server.HandlerFunc) modbus_server.HandlerFunc {
+		return func(ctx context.Context, req modbus_server.Request) (resp []byte, err error) {
+			defer func() {
+				if v := recover(); v != nil {
+					if onPanic != nil {
+						onPanic(req, v)
+					}
+					resp, err = nil, &modbus_server.PanicError{Request: req, Value: v, Stack: debug.Stack()}
+				}
+			}()
+			return next(ctx, req)
+		}
+	}
+}
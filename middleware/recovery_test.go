@@ -0,0 +1,43 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	modbus_server "github.com/hootrhino/goodbusserver"
+	"github.com/hootrhino/goodbusserver/protocol"
+)
+
+func TestRecovery(t *testing.T) {
+	var recovered any
+	h := Recovery(func(req modbus_server.Request, v any) { recovered = v })(func(ctx context.Context, req modbus_server.Request) ([]byte, error) {
+		panic("boom")
+	})
+
+	resp, err := h(context.Background(), modbus_server.Request{FuncCode: 0x03})
+	if !errors.Is(err, protocol.ErrServerDeviceFailure) {
+		t.Fatalf("expected ErrServerDeviceFailure, got %v", err)
+	}
+	if resp != nil {
+		t.Errorf("expected nil response, got %v", resp)
+	}
+	if recovered != "boom" {
+		t.Errorf("onPanic got %v, want boom", recovered)
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package profile
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	modbus_server "github.com/hootrhino/goodbusserver"
+	"github.com/hootrhino/goodbusserver/store"
+	"github.com/hootrhino/goodbusserver/tag"
+)
+
+// Device is a profile built into stores, ready to serve.
+type Device struct {
+	// Store routes each unit ID to the store of its unit. Unit IDs without a
+	// unit get the default unit's store or, when there is none, a store with
+	// no addresses, which answers every request with exception 0x02.
+	Store *store.UnitMap
+	units map[byte]*builtUnit
+	def   *builtUnit
+}
+
+var _ store.AccessChecker = (*Device)(nil)
+
+type builtUnit struct {
+	st     store.Store
+	tags   *tag.DB
+	access *store.AccessMap
+	id     *DeviceIdentification
+}
+
+// Build creates the store, tags and access rules of every unit of p and
+// applies the initial values.
+func Build(p *Profile) (*Device, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	d := &Device{units: make(map[byte]*builtUnit)}
+	for _, u := range p.Units {
+		b, err := buildUnit(u)
+		if err != nil {
+			for _, built := range d.units {
+				built.st.Close()
+			}
+			return nil, fmt.Errorf("%w: unit %d: %w", ErrInvalidProfile, u.ID, err)
+		}
+		d.units[u.ID] = b
+		if u.Default {
+			d.def = b
+		}
+	}
+
+	var def store.Store
+	if d.def != nil {
+		def = d.def.st
+	} else {
+		def, _ = store.NewSparseStore()
+	}
+	d.Store = store.NewUnitMap(def)
+	for id, b := range d.units {
+		d.Store.Set(id, b.st)
+	}
+	return d, nil
+}
+
+func buildUnit(u Unit) (*builtUnit, error) {
+	b := &builtUnit{access: store.NewAccessMap(), id: u.Identification}
+
+	switch {
+	case len(u.Regions) > 0:
+		st, err := store.NewSparseStore(u.Regions...)
+		if err != nil {
+			return nil, err
+		}
+		b.st = st
+	case len(u.Sizes) > 0:
+		var opts []store.InMemoryOption
+		for table := store.TableCoils; table <= store.TableInputRegisters; table++ {
+			opts = append(opts, store.WithTableSize(table, u.Sizes[table]))
+		}
+		b.st = store.NewInMemoryStore(opts...)
+	default:
+		// 未声明区域和大小时，只保留各个点位占用的地址
+		st, err := store.NewSparseStore(tagRegions(u.Tags)...)
+		if err != nil {
+			return nil, err
+		}
+		b.st = st
+	}
+
+	for _, r := range u.Regions {
+		if r.Access != store.AccessReadWrite {
+			b.access.Add(store.AccessRule{Table: r.Table, Window: store.Window{Start: r.Start, End: r.End()}, Access: r.Access})
+		}
+	}
+
+	tags := make([]tag.Tag, len(u.Tags))
+	for i, pt := range u.Tags {
+		if err := checkAddresses(b.st, pt.Table, pt.Address, pt.Words()); err != nil {
+			return nil, fmt.Errorf("tag %s: %w", pt.Name, err)
+		}
+		tags[i] = pt.Tag
+	}
+	db, err := tag.NewDB(b.st, tags...)
+	if err != nil {
+		return nil, err
+	}
+	b.tags = db
+	for _, rule := range db.AccessRules() {
+		b.access.Add(rule)
+	}
+
+	for _, block := range u.Values {
+		if err := writeBlock(b.st, block); err != nil {
+			return nil, fmt.Errorf("values of %s at %d: %w", block.Table, block.Start, err)
+		}
+	}
+	for _, pt := range u.Tags {
+		if pt.Value == nil {
+			continue
+		}
+		if err := setValue(db, pt); err != nil {
+			return nil, fmt.Errorf("value of tag %s: %w", pt.Name, err)
+		}
+	}
+	return b, nil
+}
+
+// tagRegions returns regions covering the addresses of tags, merging those
+// that overlap or touch.
+func tagRegions(points []Point) []store.Region {
+	var regions []store.Region
+	for table := store.TableCoils; table <= store.TableInputRegisters; table++ {
+		var windows []store.Window
+		for _, pt := range points {
+			if pt.Table == table {
+				windows = append(windows, pt.Window())
+			}
+		}
+		sort.Slice(windows, func(i, j int) bool { return windows[i].Start < windows[j].Start })
+
+		for i := 0; i < len(windows); {
+			w := windows[i]
+			for i++; i < len(windows) && int(windows[i].Start) <= int(w.End)+1; i++ {
+				w.End = max(w.End, windows[i].End)
+			}
+			regions = append(regions, store.Region{Table: table, Start: w.Start, Length: int(w.End-w.Start) + 1})
+		}
+	}
+	return regions
+}
+
+// checkAddresses reports whether quantity addresses from start exist in st.
+func checkAddresses(st store.Store, table store.Table, start uint16, quantity int) error {
+	var err error
+	switch table {
+	case store.TableCoils:
+		_, err = st.GetCoils(start, uint16(quantity))
+	case store.TableDiscreteInputs:
+		_, err = st.GetDiscreteInputs(start, uint16(quantity))
+	case store.TableHoldingRegisters:
+		_, err = st.GetHoldingRegisters(start, uint16(quantity))
+	case store.TableInputRegisters:
+		_, err = st.GetInputRegisters(start, uint16(quantity))
+	}
+	return err
+}
+
+func writeBlock(st store.Store, b Block) error {
+	switch b.Table {
+	case store.TableCoils, store.TableDiscreteInputs:
+		bits := make([]byte, len(b.Values))
+		for i, v := range b.Values {
+			bits[i] = byte(min(v, 1))
+		}
+		if b.Table == store.TableCoils {
+			return st.SetCoilsAt(b.Start, bits)
+		}
+		return st.SetDiscreteInputsAt(b.Start, bits)
+	case store.TableHoldingRegisters:
+		return st.SetHoldingRegistersAt(b.Start, b.Values)
+	case store.TableInputRegisters:
+		return st.SetInputRegistersAt(b.Start, b.Values)
+	}
+	return store.ErrInvalidTable
+}
+
+func setValue(db *tag.DB, pt Point) error {
+	switch v := pt.Value.(type) {
+	case bool:
+		return db.WriteBool(pt.Name, v)
+	case float64:
+		return db.Write(pt.Name, v)
+	case string:
+		switch pt.Type {
+		case tag.String:
+			return db.WriteString(pt.Name, v)
+		case tag.Bool:
+			on, err := strconv.ParseBool(v)
+			if err != nil {
+				return err
+			}
+			return db.WriteBool(pt.Name, on)
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		return db.Write(pt.Name, f)
+	}
+	return fmt.Errorf("unsupported value %v (%T)", pt.Value, pt.Value)
+}
+
+func (d *Device) unit(unitID byte) *builtUnit {
+	if b, ok := d.units[unitID]; ok {
+		return b
+	}
+	return d.def
+}
+
+// Tags returns the tags of the unit serving unitID.
+func (d *Device) Tags(unitID byte) (*tag.DB, bool) {
+	b := d.unit(unitID)
+	if b == nil {
+		return nil, false
+	}
+	return b.tags, true
+}
+
+// Access implements store.AccessChecker with the region and tag access
+// modes of the unit serving unitID.
+func (d *Device) Access(unitID byte, table store.Table, start uint16, quantity int) store.Access {
+	b := d.unit(unitID)
+	if b == nil {
+		return store.AccessReadWrite
+	}
+	return b.access.Access(unitID, table, start, quantity)
+}
+
+// Configure applies the access modes and device identifications of the
+// profile to s, which must serve d.Store.
+func (d *Device) Configure(s *modbus_server.Server) {
+	s.SetAccessPolicy(&modbus_server.AccessPolicy{Checker: d})
+	for id, b := range d.units {
+		if b.id != nil {
+			s.SetUnitDeviceIdentification(id, *b.id)
+		}
+	}
+	if d.def != nil && d.def.id != nil {
+		s.SetDeviceIdentification(d.def.id)
+	}
+}
+
+// NewServer returns a server for d.Store configured by Configure.
+func (d *Device) NewServer(ctx context.Context, maxConns int) *modbus_server.Server {
+	s := modbus_server.NewServer(ctx, d.Store, maxConns)
+	d.Configure(s)
+	return s
+}
+
+// Close closes the stores of every unit.
+func (d *Device) Close() error {
+	return d.Store.Close()
+}
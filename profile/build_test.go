@@ -0,0 +1,228 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package profile
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+func buildMeter(t *testing.T) *Device {
+	t.Helper()
+	p, err := ParseJSON(strings.NewReader(meterJSON))
+	if err != nil {
+		t.Fatalf("ParseJSON() error = %v", err)
+	}
+	d, err := Build(p)
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+func TestBuild_InitialValues(t *testing.T) {
+	d := buildMeter(t)
+	unit1, _ := d.Store.Unit(1)
+
+	if values, _ := unit1.GetHoldingRegisters(0, 3); !reflect.DeepEqual(values, []uint16{7, 8, 215}) {
+		t.Errorf("holding registers 0-2 = %v; want [7 8 215]", values)
+	}
+	if values, _ := unit1.GetInputRegisters(100, 2); !reflect.DeepEqual(values, []uint16{1, 2}) {
+		t.Errorf("region values = %v; want [1 2]", values)
+	}
+
+	tags, _ := d.Tags(1)
+	if v, err := tags.Read("voltage"); err != nil || v != 230.5 {
+		t.Errorf("voltage = %v, %v; want 230.5", v, err)
+	}
+	if on, _ := tags.ReadBool("relay"); !on {
+		t.Error("relay is off; want on")
+	}
+	if s, _ := tags.ReadString("serial"); s != "SN42" {
+		t.Errorf("serial = %q; want SN42", s)
+	}
+
+	tags2, _ := d.Tags(2)
+	if v, _ := tags2.Read("mode"); v != 3 {
+		t.Errorf("unit 2 mode = %v; want 3", v)
+	}
+	unit2, _ := d.Store.Unit(2)
+	if unit2.Size(store.TableHoldingRegisters) != 10 || unit2.Size(store.TableCoils) != 0 {
+		t.Errorf("unit 2 sizes = %d, %d; want 10, 0", unit2.Size(store.TableHoldingRegisters), unit2.Size(store.TableCoils))
+	}
+
+	// Unit IDs without a unit are served by the default unit.
+	if d.Store.Store != unit1 {
+		t.Error("unit 9 is not served by the default unit")
+	}
+}
+
+func TestBuild_Access(t *testing.T) {
+	d := buildMeter(t)
+
+	tests := []struct {
+		unit  byte
+		table store.Table
+		start uint16
+		n     int
+		want  store.Access
+	}{
+		{1, store.TableInputRegisters, 104, 2, store.AccessReadOnly},
+		{1, store.TableCoils, 3, 1, store.AccessWriteOnly},
+		{1, store.TableHoldingRegisters, 0, 2, store.AccessReadWrite},
+		{1, store.TableHoldingRegisters, 9, 1, store.AccessReadOnly},
+		{9, store.TableCoils, 3, 1, store.AccessWriteOnly},
+		{2, store.TableCoils, 3, 1, store.AccessReadWrite},
+	}
+	for _, tt := range tests {
+		if got := d.Access(tt.unit, tt.table, tt.start, tt.n); got != tt.want {
+			t.Errorf("Access(%d, %s, %d, %d) = %s; want %s", tt.unit, tt.table, tt.start, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestBuild_TagRegions(t *testing.T) {
+	p, err := ParseCSV(strings.NewReader(`name,table,address,type,length
+a,holding_registers,10,float32,
+b,holding_registers,12,uint16,
+c,holding_registers,20,string,4
+`))
+	if err != nil {
+		t.Fatalf("ParseCSV() error = %v", err)
+	}
+	d, err := Build(p)
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	defer d.Close()
+
+	st, _ := d.Store.Unit(1)
+	windows := st.(interface {
+		Windows(store.Table) []store.Window
+	}).Windows(store.TableHoldingRegisters)
+	want := []store.Window{{Start: 10, End: 12}, {Start: 20, End: 23}}
+	if !reflect.DeepEqual(windows, want) {
+		t.Errorf("windows = %+v; want %+v", windows, want)
+	}
+
+	// Unit IDs without a unit get exception 0x02 when there is no default.
+	if _, err := store.StoreForUnit(d.Store, 5).GetHoldingRegisters(10, 1); !errors.Is(err, store.ErrInvalidAddress) {
+		t.Errorf("unit 5 read error = %v; want ErrInvalidAddress", err)
+	}
+}
+
+func TestBuild_Errors(t *testing.T) {
+	tests := map[string]string{
+		"tag outside regions": `{"units": [{"id": 1,
+			"regions": [{"table": "coils", "start": 0, "length": 8, "access": "read-write"}],
+			"tags": [{"name": "x", "table": "coils", "address": 8, "type": "bool", "access": "read-write"}]}]}`,
+		"tag outside size": `{"units": [{"id": 1, "sizes": {"holding_registers": 4},
+			"tags": [{"name": "x", "table": "holding_registers", "address": 3, "type": "uint32", "access": "read-write"}]}]}`,
+		"bad value": `{"units": [{"id": 1,
+			"tags": [{"name": "x", "table": "holding_registers", "type": "uint16", "access": "read-write", "value": "high"}]}]}`,
+		"value out of range": `{"units": [{"id": 1,
+			"tags": [{"name": "x", "table": "holding_registers", "type": "int16", "access": "read-write", "value": 40000}]}]}`,
+		"overlapping regions": `{"units": [{"id": 1, "regions": [
+			{"table": "coils", "start": 0, "length": 8, "access": "read-write"},
+			{"table": "coils", "start": 4, "length": 8, "access": "read-write"}]}]}`,
+	}
+	for name, doc := range tests {
+		p, err := ParseJSON(strings.NewReader(doc))
+		if err != nil {
+			t.Fatalf("%s: ParseJSON() error = %v", name, err)
+		}
+		if _, err := Build(p); !errors.Is(err, ErrInvalidProfile) {
+			t.Errorf("%s: Build() error = %v; want ErrInvalidProfile", name, err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	for name, doc := range map[string]string{"meter.json": meterJSON, "meter.CSV": meterCSV} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(doc), 0o644)
+		if _, err := Load(path); err != nil {
+			t.Errorf("Load(%s) error = %v", name, err)
+		}
+	}
+	path := filepath.Join(dir, "meter.xml")
+	os.WriteFile(path, []byte("<units/>"), 0o644)
+	if _, err := Load(path); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Load(xml) error = %v; want ErrUnknownFormat", err)
+	}
+}
+
+func TestDevice_NewServer(t *testing.T) {
+	d := buildMeter(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	s := d.NewServer(context.Background(), 2)
+	if err := s.Start(addr); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer s.Stop()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	exchange := func(req []byte) []byte {
+		if _, err := conn.Write(req); err != nil {
+			t.Fatal(err)
+		}
+		head := make([]byte, 7)
+		if _, err := io.ReadFull(conn, head); err != nil {
+			t.Fatal(err)
+		}
+		pdu := make([]byte, int(head[4])<<8|int(head[5])-1)
+		if _, err := io.ReadFull(conn, pdu); err != nil {
+			t.Fatal(err)
+		}
+		return pdu
+	}
+
+	// Read device identification of unit 5, served by the default unit.
+	pdu := exchange([]byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x05, 0x05, 0x2B, 0x0E, 0x04, 0x00})
+	if want := "\x2B\x0E\x04\x81\x00\x00\x01\x00\x04Acme"; string(pdu) != want {
+		t.Errorf("identification = % X; want % X", pdu, want)
+	}
+
+	// The serial number is read-only for clients.
+	pdu = exchange([]byte{0x00, 0x02, 0x00, 0x00, 0x00, 0x06, 0x01, 0x06, 0x00, 0x08, 0x00, 0x00})
+	if !reflect.DeepEqual(pdu, []byte{0x86, 0x02}) {
+		t.Errorf("write to read-only tag = % X; want 86 02", pdu)
+	}
+}
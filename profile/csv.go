@@ -0,0 +1,319 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package profile
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hootrhino/goodbusserver/protocol"
+	"github.com/hootrhino/goodbusserver/store"
+	"github.com/hootrhino/goodbusserver/tag"
+)
+
+// CSVColumns lists the columns ParseCSV understands. A file may use any
+// subset in any order. The reference column holds a Modicon reference such
+// as 40001, as written by tag.DB.WriteCSV; it stands in for the table and
+// address columns where they are empty and must agree with them otherwise.
+var CSVColumns = []string{
+	"kind", "unit", "name", "table", "address", "reference", "length", "type", "order",
+	"scale", "offset", "units", "access", "value", "description",
+}
+
+// ParseCSV reads a profile from a CSV register map with a header row naming
+// the columns, see CSVColumns. Lines starting with # are comments. The kind
+// column says what a row declares:
+//
+//   - tag, or empty: a point with name, table, address, type (uint16 or
+//     bool when empty), order, length, scale, offset, units, access,
+//     description and an initial value
+//   - region: a region of table from address with length addresses,
+//     access and space-separated raw values
+//   - size: the size of table, given in length, once per table
+//   - value: space-separated raw values written to table from address
+//   - identification: the device identification object name, such as
+//     vendor_name or a private object ID from 0x80, set to value
+//   - default: makes the unit the default unit
+//
+// The unit column defaults to 1. Numbers may be written in decimal or with
+// a 0x prefix in hexadecimal.
+func ParseCSV(r io.Reader) (*Profile, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidProfile, err)
+	}
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(CSVColumns, name) {
+			return nil, fmt.Errorf("%w: unknown column %q", ErrInvalidProfile, name)
+		}
+		index[name] = i
+	}
+
+	p := &Profile{}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+		}
+		line, _ := cr.FieldPos(0)
+		if err := p.addRow(&csvRow{record: record, index: index}); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidProfile, line, err)
+		}
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Profile) addRow(r *csvRow) error {
+	unitID := byte(1)
+	if r.get("unit") != "" {
+		unitID = r.byte("unit")
+	}
+	if r.err != nil {
+		return r.err
+	}
+	u := p.unit(unitID)
+
+	switch kind := strings.ToLower(r.get("kind")); kind {
+	case "", "tag":
+		table, address := r.location()
+		pt := Point{Tag: tag.Tag{
+			Name:        r.get("name"),
+			Table:       table,
+			Address:     address,
+			Units:       r.get("units"),
+			Description: r.get("description"),
+		}}
+		pt.Type = r.dataType("type", pt.Table)
+		pt.Order = r.order("order")
+		pt.Length = r.int("length")
+		pt.Scale = r.float("scale")
+		pt.Offset = r.float("offset")
+		pt.Access = r.access("access")
+		if v := r.get("value"); v != "" {
+			pt.Value = v
+		}
+		u.Tags = append(u.Tags, pt)
+	case "region":
+		table, address := r.location()
+		u.Regions = append(u.Regions, store.Region{
+			Table:  table,
+			Start:  address,
+			Length: r.int("length"),
+			Values: r.values("value"),
+			Access: r.access("access"),
+		})
+	case "size":
+		if u.Sizes == nil {
+			u.Sizes = make(map[store.Table]int)
+		}
+		table := r.table("table")
+		if _, ok := u.Sizes[table]; ok && r.err == nil {
+			return fmt.Errorf("size of %s repeated", table)
+		}
+		u.Sizes[table] = r.int("length")
+	case "value":
+		table, address := r.location()
+		u.Values = append(u.Values, Block{
+			Table:  table,
+			Start:  address,
+			Values: r.values("value"),
+		})
+	case "identification":
+		if u.Identification == nil {
+			u.Identification = &DeviceIdentification{}
+		}
+		r.identification(u.Identification)
+	case "default":
+		u.Default = true
+	default:
+		return fmt.Errorf("unknown kind %q", kind)
+	}
+	return r.err
+}
+
+// csvRow reads typed columns of a record, keeping the first error.
+type csvRow struct {
+	record []string
+	index  map[string]int
+	err    error
+}
+
+func (r *csvRow) get(column string) string {
+	i, ok := r.index[column]
+	if !ok || i >= len(r.record) {
+		return ""
+	}
+	return strings.TrimSpace(r.record[i])
+}
+
+func (r *csvRow) fail(column string, err error) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%s: %v", column, err)
+	}
+}
+
+func (r *csvRow) uint(column string, bits int) uint64 {
+	s := r.get(column)
+	if s == "" {
+		return 0
+	}
+	n, err := strconv.ParseUint(s, 0, bits)
+	if err != nil {
+		r.fail(column, err)
+	}
+	return n
+}
+
+func (r *csvRow) byte(column string) byte     { return byte(r.uint(column, 8)) }
+func (r *csvRow) uint16(column string) uint16 { return uint16(r.uint(column, 16)) }
+func (r *csvRow) int(column string) int       { return int(r.uint(column, 17)) }
+
+func (r *csvRow) float(column string) float64 {
+	s := r.get(column)
+	if s == "" {
+		return 0
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		r.fail(column, err)
+	}
+	return f
+}
+
+func (r *csvRow) values(column string) []uint16 {
+	var values []uint16
+	for _, s := range strings.Fields(r.get(column)) {
+		n, err := strconv.ParseUint(s, 0, 16)
+		if err != nil {
+			r.fail(column, err)
+			return nil
+		}
+		values = append(values, uint16(n))
+	}
+	return values
+}
+
+func (r *csvRow) table(column string) store.Table {
+	table, err := store.ParseTable(strings.ToLower(r.get(column)))
+	if err != nil {
+		r.fail(column, fmt.Errorf("unknown table %q", r.get(column)))
+	}
+	return table
+}
+
+// location returns the table and address of a row, taken from the
+// reference column where the table or address column is empty.
+func (r *csvRow) location() (store.Table, uint16) {
+	ref := r.get("reference")
+	if ref == "" {
+		return r.table("table"), r.uint16("address")
+	}
+	table, address, err := tag.ParseReference(ref)
+	if err != nil {
+		r.fail("reference", err)
+		return 0, 0
+	}
+	if r.get("table") != "" {
+		if t := r.table("table"); r.err == nil && t != table {
+			r.fail("reference", fmt.Errorf("%s is not in table %s", ref, t))
+		}
+	}
+	if r.get("address") != "" {
+		if a := r.uint16("address"); r.err == nil && a != address {
+			r.fail("reference", fmt.Errorf("%s is not address %d", ref, a))
+		}
+	}
+	return table, address
+}
+
+func (r *csvRow) dataType(column string, table store.Table) tag.DataType {
+	s := r.get(column)
+	if s == "" {
+		return defaultType(table)
+	}
+	t, err := tag.ParseDataType(s)
+	if err != nil {
+		r.fail(column, err)
+	}
+	return t
+}
+
+func (r *csvRow) order(column string) protocol.WordOrder {
+	s := r.get(column)
+	if s == "" {
+		return protocol.ABCD
+	}
+	o, err := protocol.ParseWordOrder(s)
+	if err != nil {
+		r.fail(column, err)
+	}
+	return o
+}
+
+func (r *csvRow) access(column string) store.Access {
+	s := r.get(column)
+	if s == "" {
+		return store.AccessReadWrite
+	}
+	a, err := store.ParseAccess(strings.ToLower(s))
+	if err != nil {
+		r.fail(column, err)
+	}
+	return a
+}
+
+func (r *csvRow) identification(id *DeviceIdentification) {
+	name, value := strings.ToLower(r.get("name")), r.get("value")
+	fields := map[string]*string{
+		"vendor_name":           &id.VendorName,
+		"product_code":          &id.ProductCode,
+		"major_minor_revision":  &id.MajorMinorRevision,
+		"vendor_url":            &id.VendorURL,
+		"product_name":          &id.ProductName,
+		"model_name":            &id.ModelName,
+		"user_application_name": &id.UserApplicationName,
+	}
+	if field, ok := fields[name]; ok {
+		*field = value
+		return
+	}
+	object, err := strconv.ParseUint(name, 0, 8)
+	if err != nil || object < 0x80 {
+		r.fail("name", fmt.Errorf("unknown identification object %q", name))
+		return
+	}
+	if id.Extended == nil {
+		id.Extended = make(map[byte]string)
+	}
+	id.Extended[byte(object)] = value
+}
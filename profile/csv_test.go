@@ -0,0 +1,159 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package profile
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hootrhino/goodbusserver/protocol"
+	"github.com/hootrhino/goodbusserver/store"
+	"github.com/hootrhino/goodbusserver/tag"
+)
+
+const meterCSV = `# PM-200 register map
+kind,unit,name,table,address,length,type,order,scale,units,access,value,description
+,,voltage,input_registers,0x0004,,float32,cdab,,V,read-only,230.5,Phase voltage
+tag,,status,holding_registers,10,,,,,,read-only,,
+,,pump,coils,3,,,,,,write-only,1,
+region,2,,holding_registers,0,4,,,,,read-only,1 2 0x10,
+size,3,,coils,,16,,,,,,,
+value,3,,coils,0,,,,,,,1 0 1,
+identification,,vendor_name,,,,,,,,,Acme,
+identification,,0x80,,,,,,,,,private,
+default,,,,,,,,,,,,
+`
+
+func TestParseCSV(t *testing.T) {
+	p, err := ParseCSV(strings.NewReader(meterCSV))
+	if err != nil {
+		t.Fatalf("ParseCSV() error = %v", err)
+	}
+	if len(p.Units) != 3 {
+		t.Fatalf("units = %+v", p.Units)
+	}
+
+	u := p.Units[0]
+	if u.ID != 1 || !u.Default || len(u.Tags) != 3 {
+		t.Fatalf("unit 1 = %+v", u)
+	}
+	want := Point{Tag: tag.Tag{
+		Name: "voltage", Table: store.TableInputRegisters, Address: 4, Type: tag.Float32,
+		Order: protocol.CDAB, Units: "V", Access: store.AccessReadOnly, Description: "Phase voltage",
+	}, Value: "230.5"}
+	if !reflect.DeepEqual(u.Tags[0], want) {
+		t.Errorf("voltage = %+v; want %+v", u.Tags[0], want)
+	}
+	if status := u.Tags[1]; status.Type != tag.Uint16 || status.Value != nil {
+		t.Errorf("status = %+v; want uint16 without a value", status)
+	}
+	if pump := u.Tags[2]; pump.Type != tag.Bool || pump.Access != store.AccessWriteOnly {
+		t.Errorf("pump = %+v", pump)
+	}
+	if id := u.Identification; id == nil || id.VendorName != "Acme" || id.Extended[0x80] != "private" {
+		t.Errorf("identification = %+v", id)
+	}
+
+	region := store.Region{Table: store.TableHoldingRegisters, Length: 4, Values: []uint16{1, 2, 0x10}, Access: store.AccessReadOnly}
+	if got := p.Units[1].Regions; !reflect.DeepEqual(got, []store.Region{region}) {
+		t.Errorf("unit 2 regions = %+v", got)
+	}
+	u3 := p.Units[2]
+	if u3.Sizes[store.TableCoils] != 16 || !reflect.DeepEqual(u3.Values, []Block{{Table: store.TableCoils, Values: []uint16{1, 0, 1}}}) {
+		t.Errorf("unit 3 = %+v", u3)
+	}
+}
+
+func TestParseCSV_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown column": "name,table,colour\n",
+		"unknown kind":   "kind,name\nblock,x\n",
+		"bad table":      "name,table,address\nx,registers,0\n",
+		"bad address":    "name,table,address\nx,coils,70000\n",
+		"bad type":       "name,table,type\nx,holding_registers,float16\n",
+		"bad object":     "kind,name,value\nidentification,0x10,x\n",
+		"bad values":     "kind,table,value\nvalue,coils,1 x\n",
+		"bad reference":  "name,reference\nx,20001\n",
+		"table mismatch": "name,table,reference\nx,input_registers,40001\n",
+		"address clash":  "name,address,reference\nx,1,40001\n",
+		"repeated size":  "kind,table,length\nsize,coils,10\nsize,coils,20\n",
+	}
+	for name, doc := range tests {
+		if _, err := ParseCSV(strings.NewReader(doc)); !errors.Is(err, ErrInvalidProfile) {
+			t.Errorf("%s: error = %v; want ErrInvalidProfile", name, err)
+		}
+	}
+
+	_, err := ParseCSV(strings.NewReader("name,table,address\nok,coils,0\nx,coils,-1\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("error = %v; want it to name line 3", err)
+	}
+}
+
+func TestParseCSV_References(t *testing.T) {
+	doc := `name,reference,type,table,address
+voltage,30005,float32,,
+setpoint,410000,int16,holding_registers,
+alarm,00003,,coils,2
+`
+	p, err := ParseCSV(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("ParseCSV() error = %v", err)
+	}
+	want := []struct {
+		table   store.Table
+		address uint16
+	}{
+		{store.TableInputRegisters, 4},
+		{store.TableHoldingRegisters, 9999},
+		{store.TableCoils, 2},
+	}
+	for i, pt := range p.Units[0].Tags {
+		if pt.Table != want[i].table || pt.Address != want[i].address {
+			t.Errorf("tag %s at %s %d; want %s %d", pt.Name, pt.Table, pt.Address, want[i].table, want[i].address)
+		}
+	}
+}
+
+func TestParseCSV_ExportedRegisterMap(t *testing.T) {
+	d := buildMeter(t)
+	tags, _ := d.Tags(1)
+
+	var buf bytes.Buffer
+	if err := tags.WriteCSV(&buf); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+	p, err := ParseCSV(&buf)
+	if err != nil {
+		t.Fatalf("ParseCSV() error = %v", err)
+	}
+
+	got := make(map[string]tag.Tag)
+	for _, pt := range p.Units[0].Tags {
+		got[pt.Name] = pt.Tag
+	}
+	for _, want := range tags.Tags() {
+		if want.Scale == 0 && want.Type != tag.Bool && want.Type != tag.String {
+			want.Scale = 1
+		}
+		if got[want.Name] != want {
+			t.Errorf("tag %s = %+v; want %+v", want.Name, got[want.Name], want)
+		}
+	}
+}
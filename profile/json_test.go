@@ -0,0 +1,118 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package profile
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hootrhino/goodbusserver/protocol"
+	"github.com/hootrhino/goodbusserver/store"
+	"github.com/hootrhino/goodbusserver/tag"
+)
+
+const meterJSON = `{
+  "name": "PM-200",
+  "units": [
+    {
+      "id": 1,
+      "default": true,
+      "regions": [
+        {"table": "holding_registers", "start": 0, "length": 16, "access": "read-write"},
+        {"table": "input_registers", "start": 100, "length": 10, "access": "read-only", "values": [1, 2]},
+        {"table": "coils", "start": 0, "length": 8, "access": "read-write"}
+      ],
+      "tags": [
+        {"name": "voltage", "table": "input_registers", "address": 104, "type": "float32", "order": "CDAB", "units": "V", "access": "read-only", "value": 230.5},
+        {"name": "setpoint", "table": "holding_registers", "address": 2, "type": "int16", "scale": 0.1, "access": "read-write", "value": "21.5"},
+        {"name": "relay", "table": "coils", "address": 3, "type": "bool", "access": "write-only", "value": true},
+        {"name": "serial", "table": "holding_registers", "address": 8, "type": "string", "length": 4, "access": "read-only", "value": "SN42"}
+      ],
+      "values": [{"table": "holding_registers", "start": 0, "values": [7, 8]}],
+      "identification": {"vendor_name": "Acme", "product_code": "PM-200", "major_minor_revision": "1.0"}
+    },
+    {
+      "id": 2,
+      "sizes": {"holding_registers": 10},
+      "tags": [{"name": "mode", "table": "holding_registers", "address": 9, "type": "uint16", "access": "read-write", "value": 3}]
+    }
+  ]
+}`
+
+func TestParseJSON(t *testing.T) {
+	p, err := ParseJSON(strings.NewReader(meterJSON))
+	if err != nil {
+		t.Fatalf("ParseJSON() error = %v", err)
+	}
+	if p.Name != "PM-200" || len(p.Units) != 2 {
+		t.Fatalf("profile = %+v", p)
+	}
+	u := p.Units[0]
+	if !u.Default || len(u.Regions) != 3 || u.Regions[1].Access != store.AccessReadOnly {
+		t.Errorf("unit 1 = %+v", u)
+	}
+	voltage := u.Tags[0]
+	if voltage.Type != tag.Float32 || voltage.Order != protocol.CDAB || voltage.Value != 230.5 {
+		t.Errorf("voltage = %+v", voltage)
+	}
+	if u.Identification == nil || u.Identification.VendorName != "Acme" {
+		t.Errorf("identification = %+v", u.Identification)
+	}
+	if size := p.Units[1].Sizes[store.TableHoldingRegisters]; size != 10 {
+		t.Errorf("unit 2 holding register size = %d; want 10", size)
+	}
+}
+
+func TestParseJSON_DefaultType(t *testing.T) {
+	p, err := ParseJSON(strings.NewReader(`{"units": [{"id": 1, "tags": [
+		{"name": "count", "table": "holding_registers", "address": 2, "value": 7},
+		{"name": "level", "table": "input_registers", "address": 3},
+		{"name": "alarm", "table": "discrete_inputs", "address": 4}]}]}`))
+	if err != nil {
+		t.Fatalf("ParseJSON() error = %v", err)
+	}
+	want := []tag.DataType{tag.Uint16, tag.Uint16, tag.Bool}
+	for i, pt := range p.Units[0].Tags {
+		if pt.Type != want[i] {
+			t.Errorf("%s type = %s; want %s", pt.Name, pt.Type, want[i])
+		}
+	}
+	if p.Units[0].Tags[0].Value != 7.0 {
+		t.Errorf("count value = %v; want 7", p.Units[0].Tags[0].Value)
+	}
+}
+
+func TestParseJSON_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":  `{"units": [{"id": 1, "colour": "red"}]}`,
+		"no units":       `{"units": []}`,
+		"duplicate unit": `{"units": [{"id": 1}, {"id": 1}]}`,
+		"two defaults":   `{"units": [{"id": 1, "default": true}, {"id": 2, "default": true}]}`,
+		"bad tag":        `{"units": [{"id": 1, "tags": [{"name": "x", "table": "coils", "type": "float32"}]}]}`,
+		"duplicate tag": `{"units": [{"id": 1, "tags": [
+			{"name": "x", "table": "coils", "type": "bool"}, {"name": "x", "table": "coils", "address": 1, "type": "bool"}]}]}`,
+		"tag access none":   `{"units": [{"id": 1, "tags": [{"name": "x", "table": "coils", "access": "none"}]}]}`,
+		"unknown tag field": `{"units": [{"id": 1, "tags": [{"name": "x", "table": "coils", "colour": "red"}]}]}`,
+		"regions and sizes": `{"units": [{"id": 1, "sizes": {"coils": 8},
+			"regions": [{"table": "coils", "start": 0, "length": 8, "access": "read-write"}]}]}`,
+	}
+	for name, doc := range tests {
+		if _, err := ParseJSON(strings.NewReader(doc)); !errors.Is(err, ErrInvalidProfile) {
+			t.Errorf("%s: error = %v; want ErrInvalidProfile", name, err)
+		}
+	}
+}
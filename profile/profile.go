@@ -0,0 +1,194 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package profile loads device profiles, which declare the register map of
+// one or more Modbus units, and builds configured stores and servers from
+// them. Profiles are read from JSON or from CSV register maps as vendors
+// usually publish them.
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	modbus_server "github.com/hootrhino/goodbusserver"
+	"github.com/hootrhino/goodbusserver/store"
+	"github.com/hootrhino/goodbusserver/tag"
+)
+
+var (
+	ErrInvalidProfile = errors.New("profile: invalid profile")
+	// ErrUnknownFormat is returned by Load for files that are neither JSON
+	// nor CSV.
+	ErrUnknownFormat = errors.New("profile: unknown file format")
+)
+
+// Profile describes the units of a device.
+type Profile struct {
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Units       []Unit `json:"units"`
+}
+
+// Unit describes the register map of one unit ID. Its store is a
+// SparseStore of Regions when any are given, an InMemoryStore of Sizes when
+// those are given, and otherwise a SparseStore holding just the addresses of
+// its tags.
+type Unit struct {
+	ID byte `json:"id"`
+	// Default makes the unit also answer every unit ID that has no unit of
+	// its own. At most one unit may be the default.
+	Default bool `json:"default,omitempty"`
+	// Sizes gives the number of addresses of each table; tables left out
+	// have none.
+	Sizes   map[store.Table]int `json:"sizes,omitempty"`
+	Regions []store.Region      `json:"regions,omitempty"`
+	Tags    []Point             `json:"tags,omitempty"`
+	// Values holds raw initial values, applied after the region values and
+	// before the tag values.
+	Values         []Block               `json:"values,omitempty"`
+	Identification *DeviceIdentification `json:"identification,omitempty"`
+}
+
+// DeviceIdentification holds the objects a unit serves through Read Device
+// Identification.
+type DeviceIdentification = modbus_server.DeviceIdentification
+
+// Point is a tag with an optional initial value.
+type Point struct {
+	tag.Tag
+	// Value is the initial engineering value: a number or bool for numeric
+	// and bool tags, a string for string tags. Numbers may also be given as
+	// strings.
+	Value any `json:"value,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler. A point without a type is a
+// bool in coils and discrete inputs and a uint16 in registers, as in CSV
+// profiles.
+func (p *Point) UnmarshalJSON(data []byte) error {
+	type plain Point
+	v := plain{Tag: tag.Tag{Type: -1}}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	// 未给出类型时按表选择默认类型
+	if v.Type == -1 {
+		v.Type = defaultType(v.Table)
+	}
+	*p = Point(v)
+	return nil
+}
+
+// defaultType is the type of a point declared without one.
+func defaultType(table store.Table) tag.DataType {
+	if table == store.TableCoils || table == store.TableDiscreteInputs {
+		return tag.Bool
+	}
+	return tag.Uint16
+}
+
+// Block is a run of raw values starting at an address. For coils and
+// discrete inputs non-zero means on.
+type Block struct {
+	Table  store.Table `json:"table"`
+	Start  uint16      `json:"start"`
+	Values []uint16    `json:"values"`
+}
+
+// Validate checks the profile for mistakes that do not need a store to
+// find: duplicate or conflicting units, invalid tags and duplicate names.
+func (p *Profile) Validate() error {
+	if len(p.Units) == 0 {
+		return fmt.Errorf("%w: no units", ErrInvalidProfile)
+	}
+	seen := make(map[byte]bool)
+	hasDefault := false
+	for _, u := range p.Units {
+		if seen[u.ID] {
+			return fmt.Errorf("%w: unit %d declared twice", ErrInvalidProfile, u.ID)
+		}
+		seen[u.ID] = true
+		if u.Default {
+			if hasDefault {
+				return fmt.Errorf("%w: more than one default unit", ErrInvalidProfile)
+			}
+			hasDefault = true
+		}
+		if err := u.validate(); err != nil {
+			return fmt.Errorf("%w: unit %d: %v", ErrInvalidProfile, u.ID, err)
+		}
+	}
+	return nil
+}
+
+func (u Unit) validate() error {
+	if len(u.Regions) > 0 && len(u.Sizes) > 0 {
+		return errors.New("regions and sizes are exclusive")
+	}
+	for table, size := range u.Sizes {
+		if table < store.TableCoils || table > store.TableInputRegisters || size < 0 || size > store.MaxSize {
+			return fmt.Errorf("invalid size %d of %s", size, table)
+		}
+	}
+	names := make(map[string]bool)
+	for _, pt := range u.Tags {
+		if err := pt.Validate(); err != nil {
+			return err
+		}
+		if names[pt.Name] {
+			return fmt.Errorf("tag %s declared twice", pt.Name)
+		}
+		names[pt.Name] = true
+	}
+	return nil
+}
+
+// Load reads a profile file, choosing the format by its extension: .json
+// or .csv.
+func Load(path string) (*Profile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		return ParseJSON(f)
+	case ".csv":
+		return ParseCSV(f)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, ext)
+	}
+}
+
+// unit returns the unit with the given ID, adding it when missing.
+func (p *Profile) unit(id byte) *Unit {
+	for i := range p.Units {
+		if p.Units[i].ID == id {
+			return &p.Units[i]
+		}
+	}
+	p.Units = append(p.Units, Unit{ID: id})
+	return &p.Units[len(p.Units)-1]
+}
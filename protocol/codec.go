@@ -29,3 +29,26 @@ func DecodeUint16(data []byte) uint16 {
 	return binary.BigEndian.Uint16(data)
 }
 
+// PackBits packs one value per byte, non-zero meaning on, into bytes with
+// the first value in the least significant bit, as used by FC 01, 02 and 0F.
+func PackBits(bits []byte) []byte {
+	packed := make([]byte, (len(bits)+7)/8)
+	for i, b := range bits {
+		if b != 0 {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return packed
+}
+
+// UnpackBits returns the first n bits of LSB-first packed data, one 0 or 1
+// per byte. Missing data reads as 0.
+func UnpackBits(data []byte, n int) []byte {
+	bits := make([]byte, n)
+	for i := range bits {
+		if i/8 < len(data) && data[i/8]&(1<<(i%8)) != 0 {
+			bits[i] = 1
+		}
+	}
+	return bits
+}
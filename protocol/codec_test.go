@@ -33,3 +33,21 @@ func TestEncodeUint16(t *testing.T) {
 	}
 }
 
+func TestPackBits(t *testing.T) {
+	bits := []byte{1, 0, 1, 1, 0, 0, 0, 0, 1, 1}
+	expected := []byte{0x0D, 0x03}
+
+	result := PackBits(bits)
+	if string(result) != string(expected) {
+		t.Errorf("PackBits(%v) = %v; want %v", bits, result, expected)
+	}
+
+	unpacked := UnpackBits(result, len(bits))
+	if string(unpacked) != string(bits) {
+		t.Errorf("UnpackBits(%v, %d) = %v; want %v", result, len(bits), unpacked, bits)
+	}
+
+	if got := UnpackBits([]byte{0xFF}, 10); got[8] != 0 || got[9] != 0 {
+		t.Errorf("UnpackBits() should read missing data as 0, got %v", got)
+	}
+}
@@ -27,6 +27,9 @@ func (e *ModbusError) Error() string {
 var (
 	ErrIllegalFunction = &ModbusError{Code: 0x01, Message: "Illegal function"}
 	ErrIllegalDataAddress = &ModbusError{Code: 0x02, Message: "Illegal data address"}
+	ErrIllegalDataValue = &ModbusError{Code: 0x03, Message: "Illegal data value"}
+	ErrServerDeviceFailure = &ModbusError{Code: 0x04, Message: "Server device failure"}
+	ErrServerDeviceBusy = &ModbusError{Code: 0x06, Message: "Server device busy"}
 	// Add other standard errors
 )
 
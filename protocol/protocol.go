@@ -24,13 +24,29 @@ const (
 	FuncCodeWriteSingleRegister = 0x06
 	FuncCodeWriteMultipleCoils = 0x0F
 	FuncCodeWriteMultipleRegisters = 0x10 // Add this line
+	FuncCodeEncapsulatedInterface = 0x2B
 	// Add other standard function codes
 )
 
+// MEITypeReadDeviceIdentification is the MEI type of Read Device
+// Identification requests carried by FuncCodeEncapsulatedInterface.
+const MEITypeReadDeviceIdentification = 0x0E
+
 func IsCustomFuncCode(code byte) bool {
 	return code >= 0x80
 }
 
+// IsWriteFuncCode reports whether the standard function code modifies
+// coils or holding registers.
+func IsWriteFuncCode(code byte) bool {
+	switch code {
+	case FuncCodeWriteSingleCoil, FuncCodeWriteSingleRegister,
+		FuncCodeWriteMultipleCoils, FuncCodeWriteMultipleRegisters:
+		return true
+	}
+	return false
+}
+
 // ExtractTransactionID extracts the transaction ID from the Modbus TCP frame
 func ExtractTransactionID(frame []byte) uint16 {
     if len(frame) < 2 {
@@ -52,7 +68,13 @@ func BuildResponseHeader(transactionID uint16, protocolID uint16, length uint16,
     return header
 }
 
-var ErrIllegalDataValue = &ProtocolError{Code: "ILLEGAL_DATA_VALUE", Message: "Illegal data value"}
+// BuildExceptionResponse builds a complete exception response frame for the
+// given function code and exception code.
+func BuildExceptionResponse(transactionID uint16, unitID byte, funcCode byte, exceptionCode byte) []byte {
+    pdu := []byte{funcCode | 0x80, exceptionCode}
+    header := BuildResponseHeader(transactionID, 0, uint16(len(pdu)+1), unitID)
+    return append(header, pdu...)
+}
 
 type ProtocolError struct {
     Code    string
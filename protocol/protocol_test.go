@@ -84,3 +84,22 @@ func TestProtocolError_Error(t *testing.T) {
 	}
 }
 
+
+func TestIsWriteFuncCode(t *testing.T) {
+	for _, code := range []byte{FuncCodeWriteSingleCoil, FuncCodeWriteSingleRegister, FuncCodeWriteMultipleCoils, FuncCodeWriteMultipleRegisters} {
+		if !IsWriteFuncCode(code) {
+			t.Errorf("IsWriteFuncCode(0x%02X) = false; want true", code)
+		}
+	}
+	if IsWriteFuncCode(FuncCodeReadHoldingRegisters) {
+		t.Errorf("IsWriteFuncCode(0x%02X) = true; want false", FuncCodeReadHoldingRegisters)
+	}
+}
+
+func TestBuildExceptionResponse(t *testing.T) {
+	expected := []byte{0x12, 0x34, 0x00, 0x00, 0x00, 0x03, 0x01, 0x83, 0x02}
+	result := BuildExceptionResponse(0x1234, 0x01, FuncCodeReadHoldingRegisters, ErrIllegalDataAddress.Code)
+	if string(result) != string(expected) {
+		t.Errorf("BuildExceptionResponse() = %v; want %v", result, expected)
+	}
+}
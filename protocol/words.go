@@ -0,0 +1,255 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// WordOrder is the layout of a value spanning several registers, named
+// after where the bytes of the big-endian value ABCD end up.
+type WordOrder int
+
+const (
+	// ABCD is big-endian: high word first, high byte first.
+	ABCD WordOrder = iota
+	// CDAB swaps the words: low word first, high byte first.
+	CDAB
+	// BADC swaps the bytes of each word: high word first, low byte first.
+	BADC
+	// DCBA is little-endian: low word first, low byte first.
+	DCBA
+)
+
+func (o WordOrder) String() string {
+	switch o {
+	case ABCD:
+		return "ABCD"
+	case CDAB:
+		return "CDAB"
+	case BADC:
+		return "BADC"
+	case DCBA:
+		return "DCBA"
+	}
+	return "unknown"
+}
+
+// ParseWordOrder returns the order named by WordOrder.String, in any case.
+func ParseWordOrder(name string) (WordOrder, error) {
+	for o := ABCD; o <= DCBA; o++ {
+		if strings.EqualFold(o.String(), name) {
+			return o, nil
+		}
+	}
+	return 0, fmt.Errorf("protocol: unknown word order %q", name)
+}
+
+// MarshalText encodes the order as its name.
+func (o WordOrder) MarshalText() ([]byte, error) {
+	if o < ABCD || o > DCBA {
+		return nil, fmt.Errorf("protocol: unknown word order %d", int(o))
+	}
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText decodes an order name.
+func (o *WordOrder) UnmarshalText(text []byte) error {
+	parsed, err := ParseWordOrder(string(text))
+	if err != nil {
+		return err
+	}
+	*o = parsed
+	return nil
+}
+
+func (o WordOrder) swapsWords() bool { return o == CDAB || o == DCBA }
+func (o WordOrder) swapsBytes() bool { return o == BADC || o == DCBA }
+
+// ToWords lays big-endian bytes out as registers in order. len(b) must be
+// even.
+func (o WordOrder) ToWords(b []byte) []uint16 {
+	words := make([]uint16, len(b)/2)
+	for i := range words {
+		hi, lo := b[2*i], b[2*i+1]
+		if o.swapsBytes() {
+			hi, lo = lo, hi
+		}
+		words[i] = uint16(hi)<<8 | uint16(lo)
+	}
+	if o.swapsWords() {
+		reverse(words)
+	}
+	return words
+}
+
+// FromWords returns the big-endian bytes of registers laid out in order.
+func (o WordOrder) FromWords(words []uint16) []byte {
+	w := append([]uint16(nil), words...)
+	if o.swapsWords() {
+		reverse(w)
+	}
+	b := make([]byte, 2*len(w))
+	for i, v := range w {
+		hi, lo := byte(v>>8), byte(v)
+		if o.swapsBytes() {
+			hi, lo = lo, hi
+		}
+		b[2*i], b[2*i+1] = hi, lo
+	}
+	return b
+}
+
+func reverse(words []uint16) {
+	for i, j := 0, len(words)-1; i < j; i, j = i+1, j-1 {
+		words[i], words[j] = words[j], words[i]
+	}
+}
+
+// EncodeInt16 returns v as one register. BADC and DCBA swap its bytes.
+func EncodeInt16(v int16, order WordOrder) []uint16 {
+	return order.ToWords(binary.BigEndian.AppendUint16(nil, uint16(v)))
+}
+
+// DecodeInt16 reads one register written by EncodeInt16.
+func DecodeInt16(words []uint16, order WordOrder) int16 {
+	return int16(binary.BigEndian.Uint16(order.FromWords(words[:1])))
+}
+
+// EncodeUint32 returns v as two registers.
+func EncodeUint32(v uint32, order WordOrder) []uint16 {
+	return order.ToWords(binary.BigEndian.AppendUint32(nil, v))
+}
+
+// DecodeUint32 reads two registers written by EncodeUint32.
+func DecodeUint32(words []uint16, order WordOrder) uint32 {
+	return binary.BigEndian.Uint32(order.FromWords(words[:2]))
+}
+
+// EncodeInt32 returns v as two registers.
+func EncodeInt32(v int32, order WordOrder) []uint16 {
+	return EncodeUint32(uint32(v), order)
+}
+
+// DecodeInt32 reads two registers written by EncodeInt32.
+func DecodeInt32(words []uint16, order WordOrder) int32 {
+	return int32(DecodeUint32(words, order))
+}
+
+// EncodeUint64 returns v as four registers.
+func EncodeUint64(v uint64, order WordOrder) []uint16 {
+	return order.ToWords(binary.BigEndian.AppendUint64(nil, v))
+}
+
+// DecodeUint64 reads four registers written by EncodeUint64.
+func DecodeUint64(words []uint16, order WordOrder) uint64 {
+	return binary.BigEndian.Uint64(order.FromWords(words[:4]))
+}
+
+// EncodeInt64 returns v as four registers.
+func EncodeInt64(v int64, order WordOrder) []uint16 {
+	return EncodeUint64(uint64(v), order)
+}
+
+// DecodeInt64 reads four registers written by EncodeInt64.
+func DecodeInt64(words []uint16, order WordOrder) int64 {
+	return int64(DecodeUint64(words, order))
+}
+
+// EncodeFloat32 returns v as two registers in IEEE 754 single precision.
+func EncodeFloat32(v float32, order WordOrder) []uint16 {
+	return EncodeUint32(math.Float32bits(v), order)
+}
+
+// DecodeFloat32 reads two registers written by EncodeFloat32.
+func DecodeFloat32(words []uint16, order WordOrder) float32 {
+	return math.Float32frombits(DecodeUint32(words, order))
+}
+
+// EncodeFloat64 returns v as four registers in IEEE 754 double precision.
+func EncodeFloat64(v float64, order WordOrder) []uint16 {
+	return EncodeUint64(math.Float64bits(v), order)
+}
+
+// DecodeFloat64 reads four registers written by EncodeFloat64.
+func DecodeFloat64(words []uint16, order WordOrder) float64 {
+	return math.Float64frombits(DecodeUint64(words, order))
+}
+
+// ErrInvalidBCD is returned for BCD values with a nibble above 9 or a
+// value with more digits than the registers hold.
+var ErrInvalidBCD = errors.New("protocol: invalid BCD value")
+
+// EncodeBCD returns v as n registers of packed BCD, four digits per
+// register.
+func EncodeBCD(v uint64, n int, order WordOrder) ([]uint16, error) {
+	if n <= 0 || n > 4 {
+		return nil, ErrInvalidBCD
+	}
+	b := make([]byte, 2*n)
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = byte(v%10) | byte(v/10%10)<<4
+		v /= 100
+	}
+	if v != 0 {
+		return nil, ErrInvalidBCD
+	}
+	return order.ToWords(b), nil
+}
+
+// DecodeBCD reads registers written by EncodeBCD.
+func DecodeBCD(words []uint16, order WordOrder) (uint64, error) {
+	if len(words) == 0 || len(words) > 4 {
+		return 0, ErrInvalidBCD
+	}
+	var v uint64
+	for _, b := range order.FromWords(words) {
+		hi, lo := b>>4, b&0x0F
+		if hi > 9 || lo > 9 {
+			return 0, ErrInvalidBCD
+		}
+		v = v*100 + uint64(hi)*10 + uint64(lo)
+	}
+	return v, nil
+}
+
+// EncodeString returns s as n registers of ASCII, two characters per
+// register, padded with NUL bytes and cut to fit. Only the byte order
+// applies to strings: BADC and DCBA put the first character of each pair
+// in the low byte.
+func EncodeString(s string, n int, order WordOrder) []uint16 {
+	b := make([]byte, 2*n)
+	copy(b, s)
+	return stringOrder(order).ToWords(b)
+}
+
+// DecodeString reads registers written by EncodeString, without trailing
+// NUL bytes and spaces.
+func DecodeString(words []uint16, order WordOrder) string {
+	b := stringOrder(order).FromWords(words)
+	return strings.TrimRight(string(b), "\x00 ")
+}
+
+func stringOrder(order WordOrder) WordOrder {
+	if order.swapsBytes() {
+		return BADC
+	}
+	return ABCD
+}
@@ -0,0 +1,145 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package protocol
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestWordOrder_Uint32(t *testing.T) {
+	tests := []struct {
+		order WordOrder
+		words []uint16
+	}{
+		{ABCD, []uint16{0x1122, 0x3344}},
+		{CDAB, []uint16{0x3344, 0x1122}},
+		{BADC, []uint16{0x2211, 0x4433}},
+		{DCBA, []uint16{0x4433, 0x2211}},
+	}
+	for _, tt := range tests {
+		got := EncodeUint32(0x11223344, tt.order)
+		if !reflect.DeepEqual(got, tt.words) {
+			t.Errorf("EncodeUint32(%s) = %04X; want %04X", tt.order, got, tt.words)
+		}
+		if v := DecodeUint32(got, tt.order); v != 0x11223344 {
+			t.Errorf("DecodeUint32(%s) = %08X; want 11223344", tt.order, v)
+		}
+	}
+}
+
+func TestWordOrder_Uint64(t *testing.T) {
+	v := uint64(0x1122334455667788)
+	want := map[WordOrder][]uint16{
+		ABCD: {0x1122, 0x3344, 0x5566, 0x7788},
+		CDAB: {0x7788, 0x5566, 0x3344, 0x1122},
+		BADC: {0x2211, 0x4433, 0x6655, 0x8877},
+		DCBA: {0x8877, 0x6655, 0x4433, 0x2211},
+	}
+	for order, words := range want {
+		got := EncodeUint64(v, order)
+		if !reflect.DeepEqual(got, words) {
+			t.Errorf("EncodeUint64(%s) = %04X; want %04X", order, got, words)
+		}
+		if back := DecodeUint64(got, order); back != v {
+			t.Errorf("DecodeUint64(%s) = %X; want %X", order, back, v)
+		}
+	}
+}
+
+func TestEncodeFloat(t *testing.T) {
+	// 23.5 is 0x41BC0000 in single precision.
+	if got := EncodeFloat32(23.5, CDAB); !reflect.DeepEqual(got, []uint16{0x0000, 0x41BC}) {
+		t.Errorf("EncodeFloat32(23.5, CDAB) = %04X; want [0000 41BC]", got)
+	}
+	for order := ABCD; order <= DCBA; order++ {
+		if got := DecodeFloat32(EncodeFloat32(-1.25, order), order); got != -1.25 {
+			t.Errorf("float32 round trip %s = %v", order, got)
+		}
+		if got := DecodeFloat64(EncodeFloat64(math.Pi, order), order); got != math.Pi {
+			t.Errorf("float64 round trip %s = %v", order, got)
+		}
+		if got := DecodeInt32(EncodeInt32(-123456, order), order); got != -123456 {
+			t.Errorf("int32 round trip %s = %v", order, got)
+		}
+		if got := DecodeInt64(EncodeInt64(math.MinInt64, order), order); got != math.MinInt64 {
+			t.Errorf("int64 round trip %s = %v", order, got)
+		}
+		if got := DecodeInt16(EncodeInt16(-2, order), order); got != -2 {
+			t.Errorf("int16 round trip %s = %v", order, got)
+		}
+	}
+	if got := EncodeInt16(0x0102, BADC); got[0] != 0x0201 {
+		t.Errorf("EncodeInt16(BADC) = %04X; want 0201", got)
+	}
+}
+
+func TestBCD(t *testing.T) {
+	words, err := EncodeBCD(12345678, 2, ABCD)
+	if err != nil || !reflect.DeepEqual(words, []uint16{0x1234, 0x5678}) {
+		t.Fatalf("EncodeBCD() = %04X, %v; want [1234 5678]", words, err)
+	}
+	if v, err := DecodeBCD(words, ABCD); err != nil || v != 12345678 {
+		t.Errorf("DecodeBCD() = %d, %v", v, err)
+	}
+	if words, _ := EncodeBCD(1234, 2, CDAB); !reflect.DeepEqual(words, []uint16{0x1234, 0x0000}) {
+		t.Errorf("EncodeBCD(CDAB) = %04X; want [1234 0000]", words)
+	}
+	if _, err := EncodeBCD(10000, 1, ABCD); !errors.Is(err, ErrInvalidBCD) {
+		t.Errorf("EncodeBCD() overflow error = %v", err)
+	}
+	if _, err := DecodeBCD([]uint16{0x12A4}, ABCD); !errors.Is(err, ErrInvalidBCD) {
+		t.Errorf("DecodeBCD() invalid digit error = %v", err)
+	}
+}
+
+func TestString(t *testing.T) {
+	words := EncodeString("PUMP1", 4, ABCD)
+	if !reflect.DeepEqual(words, []uint16{0x5055, 0x4D50, 0x3100, 0x0000}) {
+		t.Errorf("EncodeString() = %04X", words)
+	}
+	if s := DecodeString(words, ABCD); s != "PUMP1" {
+		t.Errorf("DecodeString() = %q; want PUMP1", s)
+	}
+	swapped := EncodeString("PUMP1", 4, DCBA)
+	if swapped[0] != 0x5550 {
+		t.Errorf("EncodeString(DCBA) = %04X; want bytes swapped within each register", swapped)
+	}
+	if s := DecodeString(swapped, DCBA); s != "PUMP1" {
+		t.Errorf("DecodeString(DCBA) = %q; want PUMP1", s)
+	}
+	if s := DecodeString(EncodeString("TOO LONG", 2, ABCD), ABCD); s != "TOO " && s != "TOO" {
+		t.Errorf("EncodeString() did not cut to fit: %q", s)
+	}
+}
+
+func TestParseWordOrder(t *testing.T) {
+	for o := ABCD; o <= DCBA; o++ {
+		text, _ := o.MarshalText()
+		var parsed WordOrder
+		if err := parsed.UnmarshalText(text); err != nil || parsed != o {
+			t.Errorf("round trip %s = %s, %v", o, parsed, err)
+		}
+	}
+	if o, err := ParseWordOrder("cdab"); err != nil || o != CDAB {
+		t.Errorf("ParseWordOrder(cdab) = %s, %v", o, err)
+	}
+	if _, err := ParseWordOrder("ACBD"); err == nil {
+		t.Error("ParseWordOrder(ACBD) succeeded")
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package mbserver
+
+import (
+	"fmt"
+
+	"github.com/hootrhino/goodbusserver/protocol"
+)
+
+// PanicError reports a panic raised while handling a request. It is passed
+// to the error handler and unwraps to protocol.ErrServerDeviceFailure, so the
+// client receives exception 0x04 and the connection stays open.
+type PanicError struct {
+	Request Request
+	Value   any
+	Stack   []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic handling request SlaveID=%d, FuncCode=0x%x, StartAddress=%d, Quantity=%d: %v",
+		e.Request.SlaveID, e.Request.FuncCode, e.Request.StartAddress, e.Request.Quantity, e.Value)
+}
+
+func (e *PanicError) Unwrap() error {
+	return protocol.ErrServerDeviceFailure
+}
@@ -2,14 +2,19 @@ package mbserver
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"net"
+	"runtime/debug"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/hootrhino/goodbusserver/handler"
+	"github.com/hootrhino/goodbusserver/logger"
+	"github.com/hootrhino/goodbusserver/metrics"
 	"github.com/hootrhino/goodbusserver/protocol"
 	"github.com/hootrhino/goodbusserver/store"
 )
@@ -20,15 +25,53 @@ type Server struct {
 	cancel         context.CancelFunc
 	wg             sync.WaitGroup
 	errorHandler   func(error)
-	logger         *log.Logger
+	parseFailure   ParseFailureFunc
+	logger         *slog.Logger
+	requestLevel   slog.Level
+	frameDump      bool
 	store          store.Store
 	handlers       map[byte]handler.Handler
 	customHandler  func(Request)
-	customHandlers map[byte]func(Request, store.Store) ([]byte, error)
+	customHandlers map[byte]CustomHandlerFunc
+	middlewares    []Middleware
+	chain          HandlerFunc
 	connSem        chan struct{}
 	activeConns    int64
+	nextConnID     uint64
+	timeout        time.Duration
+	metrics        *metrics.Metrics
+	accessPolicy   *AccessPolicy
+	deviceIDMu     sync.RWMutex
+	deviceID       *DeviceIdentification
+	unitDeviceIDs  map[byte]DeviceIdentification
 }
 
+// CustomHandlerFunc handles a function code registered with
+// RegisterCustomHandler. ctx carries the connection metadata, see
+// ConnInfoFromContext, and is cancelled when the server stops.
+type CustomHandlerFunc func(ctx context.Context, req Request, st store.Store) ([]byte, error)
+
+// ParseFailureFunc receives a frame the server could not parse, and so
+// dropped without a response. ctx carries the connection metadata, see
+// ConnInfoFromContext.
+type ParseFailureFunc func(ctx context.Context, frame []byte, err error)
+
+// ConnInfo describes the client connection a request arrived on.
+type ConnInfo = handler.ConnInfo
+
+// ConnInfoFromContext returns the connection metadata of the request being
+// handled.
+func ConnInfoFromContext(ctx context.Context) (ConnInfo, bool) {
+	return handler.ConnInfoFromContext(ctx)
+}
+
+// AccessPolicy makes the built-in handlers enforce per-region access modes.
+type AccessPolicy = handler.AccessPolicy
+
+// DeviceIdentification holds the objects served by Read Device
+// Identification, see SetDeviceIdentification.
+type DeviceIdentification = handler.DeviceIdentification
+
 type Request struct {
 	Frame        []byte
 	SlaveID      byte
@@ -44,9 +87,12 @@ func NewServer(ctx context.Context, Store store.Store, maxConns int) *Server {
 		cancel:         cancel,
 		store:          Store,
 		handlers:       make(map[byte]handler.Handler),
-		customHandlers: make(map[byte]func(Request, store.Store) ([]byte, error)),
+		customHandlers: make(map[byte]CustomHandlerFunc),
 		connSem:        make(chan struct{}, maxConns),
+		logger:         logger.Discard(),
+		requestLevel:   slog.LevelDebug,
 	}
+	server.chain = server.route
 
 	// Register built-in handlers
 	server.handlers[protocol.FuncCodeReadCoils] = &handler.CoilsHandler{}
@@ -57,6 +103,7 @@ func NewServer(ctx context.Context, Store store.Store, maxConns int) *Server {
 	server.handlers[protocol.FuncCodeWriteSingleRegister] = &handler.SingleRegisterHandler{}
 	server.handlers[protocol.FuncCodeWriteMultipleCoils] = &handler.MultipleCoilsHandler{}
 	server.handlers[protocol.FuncCodeWriteMultipleRegisters] = &handler.MultipleRegistersHandler{}
+	server.handlers[protocol.FuncCodeEncapsulatedInterface] = deviceIdentificationHandler{server}
 
 	return server
 }
@@ -65,8 +112,105 @@ func (s *Server) SetErrorHandler(h func(error)) {
 	s.errorHandler = h
 }
 
-func (s *Server) SetLogger(w io.Writer) {
-	s.logger = log.New(w, "[MODBUS SERVER] ", log.Ldate|log.Ltime|log.Lshortfile)
+// SetParseFailureHandler sets a function called with every frame rejected
+// before it reaches the middleware chain, such as a write single coil with a
+// value other than 0x0000 or 0xFF00.
+func (s *Server) SetParseFailureHandler(fn ParseFailureFunc) {
+	s.parseFailure = fn
+}
+
+// SetTimeout bounds the time a single request may take. The deadline is
+// visible to handlers through their context. Zero disables the timeout.
+func (s *Server) SetTimeout(d time.Duration) {
+	s.timeout = d
+}
+
+// SetMetrics attaches m to the server. Requests, exceptions, parse
+// failures, traffic and active connections are recorded from then on. Wrap
+// the store with metrics.InstrumentStore to also record store latency.
+func (s *Server) SetMetrics(m *metrics.Metrics) {
+	s.metrics = m
+	m.SetActiveConnections(func() float64 {
+		return float64(atomic.LoadInt64(&s.activeConns))
+	})
+}
+
+// SetLogger sets the structured logger. Connection events are logged at
+// Info, failures at Warn or Error and per-request records at the level set
+// by SetRequestLogLevel. A nil logger disables logging.
+func (s *Server) SetLogger(l *slog.Logger) {
+	if l == nil {
+		l = logger.Discard()
+	}
+	s.logger = l
+}
+
+// SetRequestLogLevel sets the level of the per-request dispatch records,
+// slog.LevelDebug by default. Configure the logger above this level to turn
+// them off in production.
+func (s *Server) SetRequestLogLevel(level slog.Level) {
+	s.requestLevel = level
+}
+
+// SetAccessPolicy makes the built-in handlers reject client reads of
+// write-only and writes of read-only addresses as p configures. Custom
+// handlers find p with handler.AccessPolicyFromContext. Nil disables access
+// control.
+func (s *Server) SetAccessPolicy(p *AccessPolicy) {
+	s.accessPolicy = p
+}
+
+// SetDeviceIdentification answers Read Device Identification (function code
+// 0x2B, MEI type 0x0E) with id for every unit without an identification of
+// its own, see SetUnitDeviceIdentification. Nil stops answering for those
+// units. The function code is rejected as illegal until an identification
+// is set.
+func (s *Server) SetDeviceIdentification(id *DeviceIdentification) {
+	s.deviceIDMu.Lock()
+	defer s.deviceIDMu.Unlock()
+	s.deviceID = id
+}
+
+// SetUnitDeviceIdentification sets the identification served for one unit.
+func (s *Server) SetUnitDeviceIdentification(unitID byte, id DeviceIdentification) {
+	s.deviceIDMu.Lock()
+	defer s.deviceIDMu.Unlock()
+	if s.unitDeviceIDs == nil {
+		s.unitDeviceIDs = make(map[byte]DeviceIdentification)
+	}
+	s.unitDeviceIDs[unitID] = id
+}
+
+// deviceIdentificationHandler rejects function code 0x2B as illegal while
+// no identification is set, and serves the identifications otherwise.
+type deviceIdentificationHandler struct{ s *Server }
+
+func (h deviceIdentificationHandler) Handle(ctx context.Context, request handler.Request, st store.Store) ([]byte, error) {
+	h.s.deviceIDMu.RLock()
+	configured := h.s.deviceID != nil || len(h.s.unitDeviceIDs) > 0
+	h.s.deviceIDMu.RUnlock()
+	if !configured {
+		return nil, protocol.ErrIllegalFunction
+	}
+	return (&handler.DeviceIdentificationHandler{Lookup: h.s.deviceIdentification}).Handle(ctx, request, st)
+}
+
+func (s *Server) deviceIdentification(unitID byte) (DeviceIdentification, bool) {
+	s.deviceIDMu.RLock()
+	defer s.deviceIDMu.RUnlock()
+	if id, ok := s.unitDeviceIDs[unitID]; ok {
+		return id, true
+	}
+	if s.deviceID != nil {
+		return *s.deviceID, true
+	}
+	return DeviceIdentification{}, false
+}
+
+// SetFrameDump enables hex dumps of every received and sent frame, logged at
+// slog.LevelDebug.
+func (s *Server) SetFrameDump(enabled bool) {
+	s.frameDump = enabled
 }
 
 func (s *Server) SetCoils(values []byte) error          { return s.store.SetCoils(values) }
@@ -82,6 +226,24 @@ func (s *Server) Start(addr string) error {
 		s.handleError(nil, "failed to start listener", err)
 		return err
 	}
+	s.serve(listener)
+	return nil
+}
+
+// StartTLS is like Start but accepts Modbus/TCP Security connections. Set
+// config.ClientAuth to require client certificates; the verified peer
+// identity is available to handlers through ConnInfo.
+func (s *Server) StartTLS(addr string, config *tls.Config) error {
+	listener, err := tls.Listen("tcp", addr, config)
+	if err != nil {
+		s.handleError(nil, "failed to start listener", err)
+		return err
+	}
+	s.serve(listener)
+	return nil
+}
+
+func (s *Server) serve(listener net.Listener) {
 	s.listener = listener
 
 	s.wg.Add(1)
@@ -107,8 +269,6 @@ func (s *Server) Start(addr string) error {
 			go s.handleConnection(conn)
 		}
 	}()
-
-	return nil
 }
 
 func (s *Server) Stop() {
@@ -123,21 +283,44 @@ func (s *Server) OnCustomRequest(h func(Request)) {
 	s.customHandler = h
 }
 
-func (s *Server) RegisterCustomHandler(code byte, handler func(Request, store.Store) ([]byte, error)) {
+func (s *Server) RegisterCustomHandler(code byte, handler CustomHandlerFunc) {
 	s.customHandlers[code] = handler
 }
 
 func (s *Server) handleConnection(conn net.Conn) {
 	defer func() {
+		// 兜底：连接协程中的任何panic都不能导致整个进程退出
+		if v := recover(); v != nil {
+			s.handleError(conn, "connection panic", fmt.Errorf("panic: %v\n%s", v, debug.Stack()))
+		}
 		conn.Close()
 		atomic.AddInt64(&s.activeConns, -1)
 		<-s.connSem
 		s.wg.Done()
 	}()
 
-	if s.logger != nil {
-		s.logger.Printf("New connection from %s. Active connections: %d", conn.RemoteAddr(), atomic.LoadInt64(&s.activeConns))
+	info := ConnInfo{
+		ID:         atomic.AddUint64(&s.nextConnID, 1),
+		RemoteAddr: conn.RemoteAddr(),
+		LocalAddr:  conn.LocalAddr(),
+		Transport:  handler.TransportTCP,
 	}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := tlsConn.HandshakeContext(s.ctx); err != nil {
+			s.handleError(conn, "tls handshake failed", err)
+			return
+		}
+		state := tlsConn.ConnectionState()
+		info.Transport = handler.TransportTLS
+		info.TLS = &state
+	}
+	connCtx := handler.WithConnInfo(s.ctx, info)
+	connLogger := s.logger.With(logger.RemoteAddr(info.RemoteAddr), logger.ConnID(info.ID))
+
+	connLogger.LogAttrs(connCtx, slog.LevelInfo, "connection opened",
+		slog.String("transport", info.Transport),
+		slog.Int64("active_connections", atomic.LoadInt64(&s.activeConns)))
+	defer connLogger.LogAttrs(connCtx, slog.LevelInfo, "connection closed")
 
 	for {
 		select {
@@ -156,81 +339,154 @@ func (s *Server) handleConnection(conn net.Conn) {
 			return
 		}
 
+		if s.metrics != nil {
+			s.metrics.AddBytesIn(n)
+		}
+
 		// 复制数据避免后续处理中的竞争
 		frame := make([]byte, n)
 		copy(frame, buf[:n])
+		if s.frameDump {
+			connLogger.LogAttrs(connCtx, slog.LevelDebug, "frame received", logger.Frame(frame))
+		}
 
 		req, err := s.parseRequestSafe(frame)
 		if err != nil {
+			if s.metrics != nil {
+				s.metrics.ObserveParseFailure()
+			}
 			s.handleError(conn, "parse failed", err)
+			if s.parseFailure != nil {
+				s.parseFailure(connCtx, frame, err)
+			}
 			continue
 		}
 
-		resp, err := s.dispatchRequest(req)
+		start := time.Now()
+		reqCtx, cancel := s.requestContext(connCtx)
+		resp, err := s.dispatchRequest(reqCtx, req)
+		cancel()
+		latency := time.Since(start)
+		if s.metrics != nil {
+			s.metrics.ObserveRequest(req.FuncCode, req.SlaveID, latency)
+		}
+
+		attrs := append(requestAttrs(req), logger.Latency(latency))
 		if err != nil {
 			s.handleError(conn, "dispatch failed", err)
-			continue
+			var exception *protocol.ModbusError
+			if !errors.As(err, &exception) {
+				connLogger.LogAttrs(reqCtx, s.requestLevel, "request dropped", append(attrs, logger.Err(err))...)
+				continue
+			}
+			if s.metrics != nil {
+				s.metrics.ObserveException(exception.Code)
+			}
+			attrs = append(attrs, logger.Err(err), logger.ExceptionCode(exception.Code))
+			resp = protocol.BuildExceptionResponse(protocol.ExtractTransactionID(req.Frame), req.SlaveID, req.FuncCode, exception.Code)
 		}
+		connLogger.LogAttrs(reqCtx, s.requestLevel, "request handled", attrs...)
 
 		if err := writeResponse(conn, resp); err != nil {
 			s.handleError(conn, "write failed", err)
 			return
 		}
+		if s.metrics != nil {
+			s.metrics.AddBytesOut(len(resp))
+		}
+		if s.frameDump {
+			connLogger.LogAttrs(connCtx, slog.LevelDebug, "frame sent", logger.Frame(resp))
+		}
 	}
 }
 
-func (s *Server) dispatchRequest(req Request) ([]byte, error) {
-	if s.logger != nil {
-		s.logger.Printf("Dispatching request: SlaveID=%d, FuncCode=0x%x, StartAddress=%d, Quantity=%d",
-			req.SlaveID, req.FuncCode, req.StartAddress, req.Quantity)
+func (s *Server) requestContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if s.timeout > 0 {
+		return context.WithTimeout(parent, s.timeout)
 	}
+	return context.WithCancel(parent)
+}
 
-	if h, ok := s.customHandlers[req.FuncCode]; ok {
-		resp, err := h(req, s.store)
-		if s.logger != nil {
-			if err != nil {
-				s.logger.Printf("Custom handler for FuncCode=0x%x failed: %v", req.FuncCode, err)
-			} else {
-				s.logger.Printf("Custom handler for FuncCode=0x%x succeeded, response length=%d", req.FuncCode, len(resp))
-			}
+func (s *Server) dispatchRequest(ctx context.Context, req Request) (resp []byte, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			panicErr := &PanicError{Request: req, Value: v, Stack: debug.Stack()}
+			s.logger.LogAttrs(ctx, slog.LevelError, "handler panic",
+				append(requestAttrs(req), slog.Any("panic", v), slog.String("stack", string(panicErr.Stack)))...)
+			resp, err = nil, panicErr
 		}
-		return resp, err
+	}()
+	return s.chain(ctx, req)
+}
+
+// route selects the custom or built-in handler for a request. It is the
+// innermost link of the middleware chain.
+func (s *Server) route(ctx context.Context, req Request) ([]byte, error) {
+	ctx, st := s.requestStore(ctx, req)
+
+	if h, ok := s.customHandlers[req.FuncCode]; ok {
+		return h(ctx, req, st)
 	}
 
 	if h, ok := s.handlers[req.FuncCode]; ok {
-		resp, err := h.Handle(convertToHandlerRequest(req), s.store)
-		if s.logger != nil {
-			if err != nil {
-				s.logger.Printf("Built-in handler for FuncCode=0x%x failed: %v", req.FuncCode, err)
-			} else {
-				s.logger.Printf("Built-in handler for FuncCode=0x%x succeeded, response length=%d", req.FuncCode, len(resp))
-			}
-		}
-		return resp, err
+		return h.Handle(ctx, convertToHandlerRequest(req), st)
 	}
 
 	if s.customHandler != nil {
 		s.customHandler(req)
-		if s.logger != nil {
-			s.logger.Printf("Fallback custom handler invoked for FuncCode=0x%x", req.FuncCode)
-		}
+		s.logger.LogAttrs(ctx, s.requestLevel, "fallback custom handler invoked", requestAttrs(req)...)
 	}
 
-	err := fmt.Errorf("no handler for func code %x", req.FuncCode)
+	err := fmt.Errorf("no handler for func code %x: %w", req.FuncCode, protocol.ErrIllegalFunction)
 	s.handleError(nil, "dispatchRequest failed", err)
 	return nil, err
 }
 
+// requestStore selects the store of the request's unit, see
+// store.UnitStore, and binds it to the unit and client of the request, so
+// that store wrappers such as ObservableStore can tell who made a write.
+func (s *Server) requestStore(ctx context.Context, req Request) (context.Context, store.Store) {
+	origin := store.Origin{Source: store.SourceModbus, UnitID: req.SlaveID}
+	if info, ok := handler.ConnInfoFromContext(ctx); ok {
+		origin.ConnID = info.ID
+		if info.RemoteAddr != nil {
+			origin.Client = info.RemoteAddr.String()
+		}
+	}
+	ctx = store.WithOrigin(ctx, origin)
+	if s.accessPolicy != nil {
+		ctx = handler.WithAccessPolicy(ctx, s.accessPolicy)
+	}
+	return ctx, store.BindContext(store.StoreForUnit(s.store, req.SlaveID), ctx)
+}
+
 func (s *Server) handleError(conn net.Conn, msg string, err error) {
 	if s.errorHandler != nil {
 		s.errorHandler(err)
 	}
-	if s.logger != nil {
-		if conn != nil {
-			s.logger.Printf("%s (%s): %v", msg, conn.RemoteAddr(), err)
-		} else {
-			s.logger.Printf("%s: %v", msg, err)
-		}
+
+	level := slog.LevelError
+	attrs := []slog.Attr{logger.Err(err)}
+	if conn != nil {
+		attrs = append(attrs, logger.RemoteAddr(conn.RemoteAddr()))
+	}
+	var exception *protocol.ModbusError
+	if errors.As(err, &exception) {
+		// 异常响应通常由客户端请求引起，不属于服务端故障
+		level = slog.LevelWarn
+		attrs = append(attrs, logger.ExceptionCode(exception.Code))
+	}
+	s.logger.LogAttrs(s.ctx, level, msg, attrs...)
+}
+
+// requestAttrs returns the log attributes identifying a request.
+func requestAttrs(req Request) []slog.Attr {
+	return []slog.Attr{
+		logger.TransactionID(protocol.ExtractTransactionID(req.Frame)),
+		logger.UnitID(req.SlaveID),
+		logger.FuncCode(req.FuncCode),
+		logger.Address(req.StartAddress),
+		logger.Quantity(req.Quantity),
 	}
 }
 
@@ -250,7 +506,12 @@ func convertToHandlerRequest(req Request) handler.Request {
 }
 
 func (s *Server) parseRequestSafe(frame []byte) (Request, error) {
-	if len(frame) < 12 {
+	minLength := 12
+	if len(frame) > 7 && frame[7] == protocol.FuncCodeEncapsulatedInterface {
+		// 读取设备标识请求只有11字节（MEI类型、读取码、对象ID）
+		minLength = 11
+	}
+	if len(frame) < minLength {
 		err := fmt.Errorf("invalid frame length: %d", len(frame))
 		s.handleError(nil, "parseRequestSafe failed", err)
 		return Request{}, err
@@ -272,6 +533,11 @@ func (s *Server) parseRequestSafe(frame []byte) (Request, error) {
 		return Request{}, err
 	}
 
+	if frame[7] == protocol.FuncCodeEncapsulatedInterface {
+		// 封装接口请求没有地址和数量字段，由处理器自行解析
+		return Request{Frame: frame, SlaveID: frame[6], FuncCode: frame[7]}, nil
+	}
+
 	req := Request{
 		Frame:        frame,
 		SlaveID:      frame[6],
@@ -344,18 +610,13 @@ func (s *Server) parseRequestSafe(frame []byte) (Request, error) {
 		}
 	}
 
-	// 验证地址范围
+	// 验证地址范围；05/06 的第二个字段是写入值而非数量
 	maxAddress := uint32(req.StartAddress) + uint32(req.Quantity)
-	if maxAddress > 0xFFFF {
+	if req.FuncCode != 0x05 && req.FuncCode != 0x06 && maxAddress > 0x10000 {
 		err := fmt.Errorf("address overflow: start=%d, quantity=%d", req.StartAddress, req.Quantity)
 		s.handleError(nil, "parseRequestSafe failed", err)
 		return Request{}, err
 	}
 
-	if s.logger != nil {
-		s.logger.Printf("Parsed request: SlaveID=%d, FuncCode=0x%x, StartAddress=%d, Quantity=%d",
-			req.SlaveID, req.FuncCode, req.StartAddress, req.Quantity)
-	}
-
 	return req, nil
 }
@@ -1,12 +1,20 @@
 package mbserver
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
 	"net"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/hootrhino/goodbusserver/logger"
+	"github.com/hootrhino/goodbusserver/metrics"
+	"github.com/hootrhino/goodbusserver/protocol"
 	"github.com/hootrhino/goodbusserver/store"
 )
 
@@ -24,7 +32,7 @@ type fakeConn struct {
 	inBuf    []byte
 	outBuf   []byte
 	readOnce bool
-	closed   bool
+	closed   atomic.Bool
 }
 
 func (c *fakeConn) Read(b []byte) (int, error) {
@@ -41,7 +49,7 @@ func (c *fakeConn) Write(b []byte) (int, error) {
 	return len(b), nil
 }
 
-func (c *fakeConn) Close() error                       { c.closed = true; return nil }
+func (c *fakeConn) Close() error                       { c.closed.Store(true); return nil }
 func (c *fakeConn) LocalAddr() net.Addr                { return &net.IPAddr{} }
 func (c *fakeConn) RemoteAddr() net.Addr               { return &net.IPAddr{} }
 func (c *fakeConn) SetDeadline(t time.Time) error      { return nil }
@@ -59,7 +67,7 @@ func TestParseRequestSafe_InvalidLength(t *testing.T) {
 func TestDispatchRequest_NoHandler(t *testing.T) {
 	s := NewServer(context.Background(), &mockStore{}, 1)
 	req := Request{FuncCode: 0x99}
-	_, err := s.dispatchRequest(req)
+	_, err := s.dispatchRequest(context.Background(), req)
 	if err == nil {
 		t.Fatal("expected error for unknown func code, got nil")
 	}
@@ -68,13 +76,13 @@ func TestDispatchRequest_NoHandler(t *testing.T) {
 func TestDispatchRequest_CustomHandler(t *testing.T) {
 	s := NewServer(context.Background(), &mockStore{}, 1)
 	called := false
-	s.RegisterCustomHandler(0x64, func(r Request, st store.Store) ([]byte, error) {
+	s.RegisterCustomHandler(0x64, func(ctx context.Context, r Request, st store.Store) ([]byte, error) {
 		called = true
 		return []byte{0x01, 0x02}, nil
 	})
 
 	req := Request{FuncCode: 0x64}
-	resp, err := s.dispatchRequest(req)
+	resp, err := s.dispatchRequest(context.Background(), req)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -99,7 +107,7 @@ func TestHandleConnection_ClosesProperly(t *testing.T) {
 	go s.handleConnection(c)
 	time.Sleep(50 * time.Millisecond)
 
-	if !c.closed {
+	if !c.closed.Load() {
 		t.Fatal("connection was not closed")
 	}
 }
@@ -122,3 +130,435 @@ func TestServer_StartStop(t *testing.T) {
 	time.Sleep(50 * time.Millisecond)
 	s.Stop()
 }
+
+func TestServer_UseOrder(t *testing.T) {
+	s := NewServer(context.Background(), &mockStore{}, 1)
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx context.Context, req Request) ([]byte, error) {
+				order = append(order, name)
+				return next(ctx, req)
+			}
+		}
+	}
+	s.Use(mark("outer"), mark("inner"))
+	s.RegisterCustomHandler(0x64, func(ctx context.Context, r Request, st store.Store) ([]byte, error) {
+		order = append(order, "handler")
+		return nil, nil
+	})
+
+	if _, err := s.dispatchRequest(context.Background(), Request{FuncCode: 0x64}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(order, ",") != "outer,inner,handler" {
+		t.Fatalf("unexpected call order: %v", order)
+	}
+}
+
+func TestHandleConnection_WritesException(t *testing.T) {
+	s := NewServer(context.Background(), &mockStore{}, 1)
+	atomic.StoreInt64(&s.activeConns, 1)
+	s.wg.Add(1)
+	s.connSem <- struct{}{}
+
+	frame := []byte{0x00, 0x07, 0x00, 0x00, 0x00, 0x06, 0x01, 0x64, 0x00, 0x00, 0x00, 0x01}
+	c := &fakeConn{inBuf: frame}
+	s.handleConnection(c)
+
+	expected := []byte{0x00, 0x07, 0x00, 0x00, 0x00, 0x03, 0x01, 0xE4, 0x01}
+	if string(c.outBuf) != string(expected) {
+		t.Fatalf("unexpected exception response: %v, want %v", c.outBuf, expected)
+	}
+}
+
+func TestHandleConnection_ContextCarriesConnInfo(t *testing.T) {
+	s := NewServer(context.Background(), &mockStore{}, 1)
+	s.SetTimeout(time.Second)
+	atomic.StoreInt64(&s.activeConns, 1)
+	s.wg.Add(1)
+	s.connSem <- struct{}{}
+
+	var info ConnInfo
+	var hasDeadline bool
+	s.RegisterCustomHandler(0x64, func(ctx context.Context, r Request, st store.Store) ([]byte, error) {
+		info, _ = ConnInfoFromContext(ctx)
+		_, hasDeadline = ctx.Deadline()
+		return []byte{0x00}, nil
+	})
+
+	frame := []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x01, 0x64, 0x00, 0x00, 0x00, 0x01}
+	s.handleConnection(&fakeConn{inBuf: frame})
+
+	if info.ID == 0 || info.Transport != "tcp" || info.RemoteAddr == nil {
+		t.Fatalf("unexpected ConnInfo: %+v", info)
+	}
+	if !hasDeadline {
+		t.Fatal("expected request context to carry a deadline")
+	}
+}
+
+func TestDispatchRequest_RecoversPanic(t *testing.T) {
+	s := NewServer(context.Background(), &mockStore{}, 1)
+	s.RegisterCustomHandler(0x64, func(ctx context.Context, r Request, st store.Store) ([]byte, error) {
+		var frame []byte
+		return []byte{frame[10]}, nil
+	})
+
+	_, err := s.dispatchRequest(context.Background(), Request{FuncCode: 0x64, SlaveID: 3})
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("expected PanicError, got %v", err)
+	}
+	if panicErr.Request.SlaveID != 3 || len(panicErr.Stack) == 0 {
+		t.Fatalf("PanicError missing request details: %+v", panicErr)
+	}
+	if !errors.Is(err, protocol.ErrServerDeviceFailure) {
+		t.Fatalf("expected PanicError to unwrap to ErrServerDeviceFailure")
+	}
+}
+
+func TestHandleConnection_PanicKeepsConnectionAlive(t *testing.T) {
+	s := NewServer(context.Background(), &mockStore{}, 1)
+	atomic.StoreInt64(&s.activeConns, 1)
+	s.wg.Add(1)
+	s.connSem <- struct{}{}
+
+	var reported []error
+	s.SetErrorHandler(func(err error) { reported = append(reported, err) })
+	calls := 0
+	s.RegisterCustomHandler(0x64, func(ctx context.Context, r Request, st store.Store) ([]byte, error) {
+		calls++
+		if calls == 1 {
+			panic("plugin failure")
+		}
+		return []byte{0xAA}, nil
+	})
+
+	frame := []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x01, 0x64, 0x00, 0x00, 0x00, 0x01}
+	c := &multiReadConn{frames: [][]byte{frame, frame}}
+	s.handleConnection(c)
+
+	if calls != 2 {
+		t.Fatalf("expected connection to keep serving after panic, handler called %d times", calls)
+	}
+	expected := []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x03, 0x01, 0xE4, 0x04, 0xAA}
+	if string(c.outBuf) != string(expected) {
+		t.Fatalf("unexpected output %v, want %v", c.outBuf, expected)
+	}
+	var panicErr *PanicError
+	if len(reported) == 0 || !errors.As(reported[0], &panicErr) {
+		t.Fatalf("expected PanicError reported to error handler, got %v", reported)
+	}
+}
+
+// multiReadConn returns one frame per Read call and then net.ErrClosed
+type multiReadConn struct {
+	fakeConn
+	frames [][]byte
+}
+
+func (c *multiReadConn) Read(b []byte) (int, error) {
+	if len(c.frames) == 0 {
+		return 0, net.ErrClosed
+	}
+	n := copy(b, c.frames[0])
+	c.frames = c.frames[1:]
+	return n, nil
+}
+
+func TestServer_SetMetrics(t *testing.T) {
+	s := NewServer(context.Background(), &mockStore{}, 1)
+	m := metrics.New()
+	s.SetMetrics(m)
+	atomic.StoreInt64(&s.activeConns, 1)
+	s.wg.Add(1)
+	s.connSem <- struct{}{}
+
+	frame := []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x01, 0x64, 0x00, 0x00, 0x00, 0x01}
+	s.handleConnection(&fakeConn{inBuf: frame})
+
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+	for _, line := range []string{
+		"modbus_requests_total{function_code=\"0x64\",unit_id=\"1\"} 1",
+		"modbus_exceptions_total{exception_code=\"0x01\"} 1",
+		"modbus_received_bytes_total 12",
+		"modbus_sent_bytes_total 9",
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("missing line %q in:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestServer_SetLogger(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewServer(context.Background(), &mockStore{}, 1)
+	s.SetLogger(logger.New(&buf, slog.LevelDebug))
+	s.SetFrameDump(true)
+	atomic.StoreInt64(&s.activeConns, 1)
+	s.wg.Add(1)
+	s.connSem <- struct{}{}
+	s.RegisterCustomHandler(0x64, func(ctx context.Context, r Request, st store.Store) ([]byte, error) {
+		return []byte{0x00}, nil
+	})
+
+	frame := []byte{0x00, 0x2A, 0x00, 0x00, 0x00, 0x06, 0x01, 0x64, 0x00, 0x0A, 0x00, 0x02}
+	s.handleConnection(&fakeConn{inBuf: frame})
+
+	var handled map[string]any
+	var messages []string
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var record map[string]any
+		if err := json.Unmarshal(line, &record); err != nil {
+			t.Fatalf("invalid JSON record %q: %v", line, err)
+		}
+		messages = append(messages, record["msg"].(string))
+		if record["msg"] == "request handled" {
+			handled = record
+		}
+	}
+	if handled == nil {
+		t.Fatalf("no request record in %v", messages)
+	}
+	if handled[logger.KeyTransactionID] != float64(42) || handled[logger.KeyFuncCode] != "0x64" ||
+		handled[logger.KeyAddress] != float64(10) || handled[logger.KeyQuantity] != float64(2) {
+		t.Errorf("unexpected request record: %v", handled)
+	}
+	if !strings.Contains(strings.Join(messages, ","), "frame received") {
+		t.Errorf("expected frame dump in %v", messages)
+	}
+}
+
+func TestServer_RequestLogLevel(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewServer(context.Background(), &mockStore{}, 1)
+	s.SetLogger(logger.New(&buf, slog.LevelInfo))
+	atomic.StoreInt64(&s.activeConns, 1)
+	s.wg.Add(1)
+	s.connSem <- struct{}{}
+	s.RegisterCustomHandler(0x64, func(ctx context.Context, r Request, st store.Store) ([]byte, error) {
+		return []byte{0x00}, nil
+	})
+
+	frame := []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x01, 0x64, 0x00, 0x00, 0x00, 0x01}
+	s.handleConnection(&fakeConn{inBuf: frame})
+
+	if strings.Contains(buf.String(), "request handled") {
+		t.Fatalf("per-request record logged above Debug: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "connection opened") {
+		t.Fatalf("expected connection record: %s", buf.String())
+	}
+}
+
+func TestServer_WritesCarryOrigin(t *testing.T) {
+	obs := store.NewObservableStore(store.NewInMemoryStore())
+	var got store.ChangeEvent
+	obs.Subscribe(store.AllOf(store.TableHoldingRegisters), func(ev store.ChangeEvent) { got = ev })
+
+	s := NewServer(context.Background(), obs, 1)
+	atomic.StoreInt64(&s.activeConns, 1)
+	s.wg.Add(1)
+	s.connSem <- struct{}{}
+
+	frame := []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x07, 0x06, 0x00, 0x05, 0x12, 0x34}
+	s.handleConnection(&fakeConn{inBuf: frame})
+
+	if got.Origin.Source != store.SourceModbus || got.Origin.UnitID != 7 || got.Origin.ConnID == 0 {
+		t.Fatalf("unexpected origin: %+v", got.Origin)
+	}
+	if got.Address != 5 || got.NewValues[0] != 0x1234 {
+		t.Fatalf("unexpected event: %+v", got)
+	}
+}
+
+func TestServer_AccessPolicy(t *testing.T) {
+	mem := store.NewInMemoryStore()
+	s := NewServer(context.Background(), mem, 2)
+	s.SetAccessPolicy(&AccessPolicy{
+		Checker: store.NewAccessMap(store.AccessRule{
+			Units:  []byte{7},
+			Table:  store.TableHoldingRegisters,
+			Window: store.Window{Start: 0, End: 9},
+			Access: store.AccessReadOnly,
+		}),
+		Exception: protocol.ErrIllegalDataValue,
+	})
+
+	run := func(frame []byte) []byte {
+		atomic.StoreInt64(&s.activeConns, 1)
+		s.wg.Add(1)
+		s.connSem <- struct{}{}
+		c := &fakeConn{inBuf: frame}
+		s.handleConnection(c)
+		return c.outBuf
+	}
+
+	// Unit 7 may not write holding register 5.
+	out := run([]byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x07, 0x06, 0x00, 0x05, 0x12, 0x34})
+	expected := []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x03, 0x07, 0x86, 0x03}
+	if string(out) != string(expected) {
+		t.Fatalf("unexpected response: % X, want % X", out, expected)
+	}
+	if values, _ := mem.GetHoldingRegisters(5, 1); values[0] != 0 {
+		t.Fatalf("denied write reached the store: %v", values)
+	}
+
+	// Unit 8 is not covered by the rule.
+	run([]byte{0x00, 0x02, 0x00, 0x00, 0x00, 0x06, 0x08, 0x06, 0x00, 0x05, 0x12, 0x34})
+	if values, _ := mem.GetHoldingRegisters(5, 1); values[0] != 0x1234 {
+		t.Fatalf("allowed write not applied: %v", values)
+	}
+}
+
+func TestServer_RoutesUnits(t *testing.T) {
+	def := store.NewInMemoryStore()
+	unit := store.NewInMemoryStore()
+	units := store.NewUnitMap(def)
+	units.Set(9, unit)
+
+	s := NewServer(context.Background(), units, 2)
+	for _, frame := range [][]byte{
+		{0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x09, 0x06, 0x00, 0x01, 0x00, 0x09},
+		{0x00, 0x02, 0x00, 0x00, 0x00, 0x06, 0x01, 0x06, 0x00, 0x01, 0x00, 0x01},
+	} {
+		atomic.StoreInt64(&s.activeConns, 1)
+		s.wg.Add(1)
+		s.connSem <- struct{}{}
+		s.handleConnection(&fakeConn{inBuf: frame})
+	}
+
+	if values, _ := unit.GetHoldingRegisters(1, 1); values[0] != 9 {
+		t.Errorf("unit 9 store = %v, want [9]", values)
+	}
+	if values, _ := def.GetHoldingRegisters(1, 1); values[0] != 1 {
+		t.Errorf("default store = %v, want [1]", values)
+	}
+}
+
+func TestServer_DeviceIdentification(t *testing.T) {
+	s := NewServer(context.Background(), store.NewInMemoryStore(), 2)
+	run := func(frame []byte) []byte {
+		atomic.StoreInt64(&s.activeConns, 1)
+		s.wg.Add(1)
+		s.connSem <- struct{}{}
+		c := &fakeConn{inBuf: frame}
+		s.handleConnection(c)
+		return c.outBuf
+	}
+	request := func(unitID byte) []byte {
+		return []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x05, unitID, 0x2B, 0x0E, 0x04, 0x01}
+	}
+
+	// Not served until an identification is set.
+	if out := run(request(1)); string(out[7:]) != "\xAB\x01" {
+		t.Fatalf("unexpected response: % X", out)
+	}
+
+	s.SetDeviceIdentification(&DeviceIdentification{VendorName: "Acme", ProductCode: "DEF"})
+	s.SetUnitDeviceIdentification(9, DeviceIdentification{VendorName: "Acme", ProductCode: "U9"})
+
+	out := run(request(1))
+	if want := "\x2B\x0E\x04\x81\x00\x00\x01\x01\x03DEF"; string(out[7:]) != want {
+		t.Errorf("unit 1 response: % X", out[7:])
+	}
+	out = run(request(9))
+	if want := "\x2B\x0E\x04\x81\x00\x00\x01\x01\x02U9"; string(out[7:]) != want {
+		t.Errorf("unit 9 response: % X", out[7:])
+	}
+}
+
+func TestServer_SetDeviceIdentificationWhileServing(t *testing.T) {
+	s := NewServer(context.Background(), store.NewInMemoryStore(), 1)
+	req, err := s.parseRequestSafe([]byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x05, 0x01, 0x2B, 0x0E, 0x01, 0x00})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			s.SetDeviceIdentification(&DeviceIdentification{VendorName: "Acme"})
+			s.SetUnitDeviceIdentification(byte(i), DeviceIdentification{VendorName: "Unit"})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		s.dispatchRequest(context.Background(), req)
+	}
+	<-done
+
+	if _, err := s.dispatchRequest(context.Background(), req); err != nil {
+		t.Fatalf("identification not served: %v", err)
+	}
+}
+
+func TestServer_ParseFailureHandler(t *testing.T) {
+	s := NewServer(context.Background(), store.NewInMemoryStore(), 1)
+	var frames [][]byte
+	var connID uint64
+	s.SetParseFailureHandler(func(ctx context.Context, frame []byte, err error) {
+		frames = append(frames, frame)
+		info, _ := ConnInfoFromContext(ctx)
+		connID = info.ID
+	})
+	atomic.StoreInt64(&s.activeConns, 1)
+	s.wg.Add(1)
+	s.connSem <- struct{}{}
+
+	frame := []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x01, 0x05, 0x00, 0x03, 0x12, 0x34}
+	c := &fakeConn{inBuf: frame}
+	s.handleConnection(c)
+
+	if len(c.outBuf) != 0 {
+		t.Errorf("response % X, want the frame dropped", c.outBuf)
+	}
+	if len(frames) != 1 || !bytes.Equal(frames[0], frame) || connID == 0 {
+		t.Errorf("handler got %d frames, conn %d", len(frames), connID)
+	}
+}
+
+func TestServer_FullAddressSpace(t *testing.T) {
+	mem := store.NewInMemoryStore(store.WithFullAddressSpace())
+	mem.SetHoldingRegistersAt(0xFFFF, []uint16{0xBEEF})
+	s := NewServer(context.Background(), mem, 2)
+	run := func(frame []byte) []byte {
+		atomic.StoreInt64(&s.activeConns, 1)
+		s.wg.Add(1)
+		s.connSem <- struct{}{}
+		c := &fakeConn{inBuf: frame}
+		s.handleConnection(c)
+		return c.outBuf
+	}
+
+	// FC03 reading the last register.
+	out := run([]byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x01, 0x03, 0xFF, 0xFF, 0x00, 0x01})
+	if want := "\x03\x02\xBE\xEF"; len(out) < 7 || string(out[7:]) != want {
+		t.Errorf("FC03 at 65535 response: % X", out)
+	}
+
+	// FC05 ON at 40000: 0xFF00 is the value, not a quantity.
+	frame := []byte{0x00, 0x02, 0x00, 0x00, 0x00, 0x06, 0x01, 0x05, 0x9C, 0x40, 0xFF, 0x00}
+	if out := run(frame); string(out) != string(frame) {
+		t.Errorf("FC05 response: % X, want echo", out)
+	}
+	if bits, _ := mem.GetCoils(40000, 1); bits[0] != 1 {
+		t.Errorf("coil 40000 = %v, want [1]", bits)
+	}
+
+	// FC06 with a large value at a high address.
+	frame = []byte{0x00, 0x03, 0x00, 0x00, 0x00, 0x06, 0x01, 0x06, 0xFF, 0xF0, 0xFF, 0xFE}
+	if out := run(frame); string(out) != string(frame) {
+		t.Errorf("FC06 response: % X, want echo", out)
+	}
+	if values, _ := mem.GetHoldingRegisters(0xFFF0, 1); values[0] != 0xFFFE {
+		t.Errorf("register 65520 = %v, want [65534]", values)
+	}
+
+	// A range past the end is still rejected.
+	if _, err := s.parseRequestSafe([]byte{0x00, 0x04, 0x00, 0x00, 0x00, 0x06, 0x01, 0x03, 0xFF, 0xFF, 0x00, 0x02}); err == nil {
+		t.Error("FC03 past 65535 accepted")
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sim
+
+import (
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Generator produces the simulated value of a point.
+type Generator interface {
+	// Value returns the value at elapsed time since the simulation
+	// started. r is the random source of the simulator.
+	Value(elapsed time.Duration, r *rand.Rand) float64
+}
+
+// GeneratorFunc adapts a function to Generator.
+type GeneratorFunc func(elapsed time.Duration, r *rand.Rand) float64
+
+// Value implements Generator.
+func (f GeneratorFunc) Value(elapsed time.Duration, r *rand.Rand) float64 {
+	return f(elapsed, r)
+}
+
+// Constant always returns v.
+func Constant(v float64) Generator {
+	return GeneratorFunc(func(time.Duration, *rand.Rand) float64 { return v })
+}
+
+// phase returns how far elapsed is into the current period, from 0 to 1.
+func phase(elapsed, period time.Duration) float64 {
+	return float64(elapsed%period) / float64(period)
+}
+
+// Ramp rises linearly from from to to over each period, then starts over.
+// A falling ramp has to below from.
+func Ramp(from, to float64, period time.Duration) Generator {
+	return GeneratorFunc(func(elapsed time.Duration, _ *rand.Rand) float64 {
+		if period <= 0 {
+			return to
+		}
+		return from + (to-from)*phase(elapsed, period)
+	})
+}
+
+// Sine oscillates around mid by amplitude with the given period, starting
+// at mid and rising.
+func Sine(mid, amplitude float64, period time.Duration) Generator {
+	return GeneratorFunc(func(elapsed time.Duration, _ *rand.Rand) float64 {
+		if period <= 0 {
+			return mid
+		}
+		return mid + amplitude*math.Sin(2*math.Pi*phase(elapsed, period))
+	})
+}
+
+// Square is high for the first half of each period and low for the second.
+// Use 0 and 1 to toggle a bool point.
+func Square(low, high float64, period time.Duration) Generator {
+	return GeneratorFunc(func(elapsed time.Duration, _ *rand.Rand) float64 {
+		if period <= 0 || phase(elapsed, period) < 0.5 {
+			return high
+		}
+		return low
+	})
+}
+
+// Noise adds uniform noise of up to ±amplitude to the value of base.
+func Noise(base Generator, amplitude float64) Generator {
+	return GeneratorFunc(func(elapsed time.Duration, r *rand.Rand) float64 {
+		return base.Value(elapsed, r) + (r.Float64()*2-1)*amplitude
+	})
+}
+
+type randomWalk struct {
+	mu           sync.Mutex
+	value        float64
+	step, lo, hi float64
+}
+
+// RandomWalk starts at start and moves by up to ±step on every value,
+// bouncing off lo and hi. The walk advances once per call, so give every
+// point its own walk.
+func RandomWalk(start, step, lo, hi float64) Generator {
+	return &randomWalk{value: min(max(start, lo), hi), step: step, lo: lo, hi: hi}
+}
+
+func (w *randomWalk) Value(_ time.Duration, r *rand.Rand) float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	v := w.value + (r.Float64()*2-1)*w.step
+	// 越界时反弹回区间内
+	if v > w.hi {
+		v = w.hi - (v - w.hi)
+	}
+	if v < w.lo {
+		v = w.lo + (w.lo - v)
+	}
+	w.value = min(max(v, w.lo), w.hi)
+	return w.value
+}
+
+// Step holds Value for Duration in a step sequence.
+type Step struct {
+	Duration time.Duration
+	Value    float64
+}
+
+// Steps plays a time-scripted sequence of values. After the last step the
+// sequence starts over when loop is set and holds the last value otherwise.
+func Steps(loop bool, steps ...Step) Generator {
+	var total time.Duration
+	for _, s := range steps {
+		total += max(s.Duration, 0)
+	}
+	return GeneratorFunc(func(elapsed time.Duration, _ *rand.Rand) float64 {
+		if len(steps) == 0 {
+			return 0
+		}
+		if loop && total > 0 {
+			elapsed %= total
+		}
+		for _, s := range steps {
+			if elapsed < s.Duration {
+				return s.Value
+			}
+			elapsed -= max(s.Duration, 0)
+		}
+		return steps[len(steps)-1].Value
+	})
+}
@@ -0,0 +1,93 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sim
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+func newRand() *rand.Rand {
+	return rand.New(rand.NewPCG(1, 2))
+}
+
+func TestGenerators(t *testing.T) {
+	s := time.Second
+	tests := []struct {
+		name    string
+		gen     Generator
+		elapsed time.Duration
+		want    float64
+	}{
+		{"constant", Constant(7), 5 * s, 7},
+		{"ramp start", Ramp(0, 100, 10*s), 0, 0},
+		{"ramp middle", Ramp(0, 100, 10*s), 2500 * time.Millisecond, 25},
+		{"ramp wraps", Ramp(0, 100, 10*s), 12 * s, 20},
+		{"falling ramp", Ramp(100, 0, 10*s), 4 * s, 60},
+		{"sine start", Sine(50, 10, 4*s), 0, 50},
+		{"sine peak", Sine(50, 10, 4*s), s, 60},
+		{"sine trough", Sine(50, 10, 4*s), 7 * s, 40},
+		{"square high", Square(0, 1, 2*s), 999 * time.Millisecond, 1},
+		{"square low", Square(0, 1, 2*s), s, 0},
+		{"steps", Steps(false, Step{s, 1}, Step{2 * s, 2}, Step{s, 3}), 2 * s, 2},
+		{"steps hold last", Steps(false, Step{s, 1}, Step{s, 3}), time.Hour, 3},
+		{"steps loop", Steps(true, Step{s, 1}, Step{s, 3}), 4500 * time.Millisecond, 1},
+	}
+	for _, tt := range tests {
+		if got := tt.gen.Value(tt.elapsed, newRand()); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: Value(%v) = %v; want %v", tt.name, tt.elapsed, got, tt.want)
+		}
+	}
+}
+
+func TestRandomWalk(t *testing.T) {
+	r := newRand()
+	walk := RandomWalk(50, 5, 45, 55)
+	prev := 50.0
+	moved := false
+	for i := 0; i < 1000; i++ {
+		v := walk.Value(0, r)
+		if v < 45 || v > 55 {
+			t.Fatalf("step %d: %v outside [45, 55]", i, v)
+		}
+		if math.Abs(v-prev) > 5+1e-9 {
+			t.Fatalf("step %d: moved %v; want at most 5", i, v-prev)
+		}
+		moved = moved || v != prev
+		prev = v
+	}
+	if !moved {
+		t.Error("walk never moved")
+	}
+}
+
+func TestNoise(t *testing.T) {
+	r := newRand()
+	gen := Noise(Constant(20), 0.5)
+	distinct := make(map[float64]bool)
+	for i := 0; i < 100; i++ {
+		v := gen.Value(0, r)
+		if v < 19.5 || v > 20.5 {
+			t.Fatalf("%v outside 20 ± 0.5", v)
+		}
+		distinct[v] = true
+	}
+	if len(distinct) < 50 {
+		t.Errorf("only %d distinct values in 100", len(distinct))
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package sim drives tags with live-changing values, such as ramps, sine
+// waves and random walks, for testing HMIs and historians against a
+// simulated device.
+package sim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/hootrhino/goodbusserver/tag"
+)
+
+// DefaultTick is the update interval when none is configured.
+const DefaultTick = time.Second
+
+// Option configures a Simulator.
+type Option func(*config)
+
+type config struct {
+	tick    time.Duration
+	seed    uint64
+	seeded  bool
+	onError func(error)
+}
+
+// WithTick sets how often Run updates the points.
+func WithTick(d time.Duration) Option {
+	return func(c *config) {
+		if d > 0 {
+			c.tick = d
+		}
+	}
+}
+
+// WithSeed makes the random generators repeat the same sequence on every
+// run.
+func WithSeed(seed uint64) Option {
+	return func(c *config) {
+		c.seed, c.seeded = seed, true
+	}
+}
+
+// WithErrorHandler receives the errors of the updates made by Run, such as
+// a value out of the range of its tag.
+func WithErrorHandler(fn func(error)) Option {
+	return func(c *config) {
+		c.onError = fn
+	}
+}
+
+type point struct {
+	name string
+	gen  Generator
+}
+
+// Simulator writes the values of generators to tags. Values go through the
+// tag database, so scaling and word order apply and the store sees ordinary
+// writes, which change notifications and history observe.
+type Simulator struct {
+	db     *tag.DB
+	cfg    config
+	mu     sync.Mutex
+	rand   *rand.Rand
+	points []point
+}
+
+// New returns a simulator writing to the tags of db.
+func New(db *tag.DB, opts ...Option) *Simulator {
+	cfg := config{tick: DefaultTick}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if !cfg.seeded {
+		cfg.seed = rand.Uint64()
+	}
+	return &Simulator{db: db, cfg: cfg, rand: rand.New(rand.NewPCG(cfg.seed, cfg.seed))}
+}
+
+// Add drives a numeric or bool tag with g, replacing the generator it had.
+// Bool tags are set while the value is not 0.
+func (s *Simulator) Add(name string, g Generator) error {
+	t, ok := s.db.Tag(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", tag.ErrUnknownTag, name)
+	}
+	if t.Type == tag.String {
+		return fmt.Errorf("%w: %s is a string", tag.ErrTypeMismatch, name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.points {
+		if s.points[i].name == name {
+			s.points[i].gen = g
+			return nil
+		}
+	}
+	s.points = append(s.points, point{name: name, gen: g})
+	return nil
+}
+
+// Remove stops driving a tag. The tag keeps its last value.
+func (s *Simulator) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.points {
+		if s.points[i].name == name {
+			s.points = append(s.points[:i], s.points[i+1:]...)
+			return
+		}
+	}
+}
+
+// Step writes the value every generator has at elapsed time since the
+// simulation started. A failed point does not stop the others; their
+// errors are joined.
+func (s *Simulator) Step(elapsed time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for _, p := range s.points {
+		if err := s.db.Write(p.name, p.gen.Value(elapsed, s.rand)); err != nil {
+			errs = append(errs, fmt.Errorf("sim: %s: %w", p.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run updates the points at once and then on every tick until ctx is done,
+// which it returns.
+func (s *Simulator) Run(ctx context.Context) error {
+	start := time.Now()
+	ticker := time.NewTicker(s.cfg.tick)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Step(time.Since(start)); err != nil && s.cfg.onError != nil {
+			s.cfg.onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sim
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hootrhino/goodbusserver/store"
+	"github.com/hootrhino/goodbusserver/tag"
+)
+
+func newDB(t *testing.T) (*tag.DB, store.Store) {
+	t.Helper()
+	st := store.NewInMemoryStore()
+	db, err := tag.NewDB(st,
+		tag.Tag{Name: "temperature", Table: store.TableInputRegisters, Address: 0, Type: tag.Int16, Scale: 0.1},
+		tag.Tag{Name: "flow", Table: store.TableHoldingRegisters, Address: 10, Type: tag.Float32},
+		tag.Tag{Name: "running", Table: store.TableDiscreteInputs, Address: 2, Type: tag.Bool},
+		tag.Tag{Name: "level", Table: store.TableInputRegisters, Address: 5, Type: tag.Uint16},
+		tag.Tag{Name: "model", Table: store.TableInputRegisters, Address: 20, Type: tag.String, Length: 2},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, st
+}
+
+func TestSimulator_Step(t *testing.T) {
+	db, st := newDB(t)
+	s := New(db)
+	s.Add("temperature", Ramp(20, 30, 10*time.Second))
+	s.Add("flow", Sine(5, 1, 4*time.Second))
+	s.Add("running", Square(0, 1, 4*time.Second))
+
+	if err := s.Step(5 * time.Second); err != nil {
+		t.Fatalf("Step() error = %v", err)
+	}
+	if raw, _ := st.GetInputRegisters(0, 1); raw[0] != 250 {
+		t.Errorf("temperature raw = %d; want 250", raw[0])
+	}
+	if v, _ := db.Read("flow"); v != 6 {
+		t.Errorf("flow = %v; want 6", v)
+	}
+	if bits, _ := st.GetDiscreteInputs(2, 1); bits[0] != 1 {
+		t.Errorf("running = %d; want 1", bits[0])
+	}
+
+	s.Step(6 * time.Second)
+	if on, _ := db.ReadBool("running"); on {
+		t.Error("running still on in the second half of the period")
+	}
+}
+
+func TestSimulator_AddErrors(t *testing.T) {
+	db, _ := newDB(t)
+	s := New(db)
+	if err := s.Add("missing", Constant(1)); !errors.Is(err, tag.ErrUnknownTag) {
+		t.Errorf("Add(missing) error = %v; want ErrUnknownTag", err)
+	}
+	if err := s.Add("model", Constant(1)); !errors.Is(err, tag.ErrTypeMismatch) {
+		t.Errorf("Add(model) error = %v; want ErrTypeMismatch", err)
+	}
+}
+
+func TestSimulator_StepErrors(t *testing.T) {
+	db, st := newDB(t)
+	s := New(db)
+	s.Add("level", Constant(-1))
+	s.Add("temperature", Constant(21))
+
+	err := s.Step(0)
+	if !errors.Is(err, tag.ErrOutOfRange) {
+		t.Fatalf("Step() error = %v; want ErrOutOfRange", err)
+	}
+	if raw, _ := st.GetInputRegisters(0, 1); raw[0] != 210 {
+		t.Errorf("temperature raw = %d; want 210 despite the failed point", raw[0])
+	}
+
+	s.Remove("level")
+	if err := s.Step(0); err != nil {
+		t.Errorf("Step() after Remove error = %v", err)
+	}
+}
+
+func TestSimulator_Seed(t *testing.T) {
+	run := func() []uint16 {
+		db, st := newDB(t)
+		s := New(db, WithSeed(42))
+		s.Add("level", RandomWalk(500, 50, 0, 1000))
+		var values []uint16
+		for i := 0; i < 10; i++ {
+			s.Step(0)
+			raw, _ := st.GetInputRegisters(5, 1)
+			values = append(values, raw[0])
+		}
+		return values
+	}
+	a, b := run(), run()
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("seeded runs differ: %v and %v", a, b)
+		}
+	}
+}
+
+func TestSimulator_Run(t *testing.T) {
+	db, _ := newDB(t)
+	var mu sync.Mutex
+	var errs []error
+	s := New(db, WithTick(5*time.Millisecond), WithErrorHandler(func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}))
+	s.Add("flow", Ramp(0, 1000, time.Hour))
+	s.Add("level", Constant(70000))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Millisecond)
+	defer cancel()
+	if err := s.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run() error = %v; want DeadlineExceeded", err)
+	}
+
+	if v, _ := db.Read("flow"); v <= 0 {
+		t.Errorf("flow = %v; want the ramp to have advanced", v)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) < 2 {
+		t.Errorf("error handler called %d times; want one per tick", len(errs))
+	}
+}
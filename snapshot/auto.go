@@ -0,0 +1,73 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+// AutoSaver periodically snapshots a store to a file, so that an in-memory
+// simulator keeps its setpoints across restarts. Restore the file with
+// LoadFile before starting the server.
+type AutoSaver struct {
+	Store    store.Store
+	Path     string
+	Interval time.Duration
+	Format   Format
+	// OnError is called when a periodic save fails; nil ignores failures.
+	OnError func(error)
+
+	last []Unit
+}
+
+// Run saves the store every Interval until ctx is done, skipping saves when
+// nothing changed, then saves once more so the final values are kept. It
+// returns the error of that final save.
+func (a *AutoSaver) Run(ctx context.Context) error {
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return a.Save()
+		case <-ticker.C:
+			if err := a.Save(); err != nil && a.OnError != nil {
+				a.OnError(err)
+			}
+		}
+	}
+}
+
+// Save writes a snapshot now unless the contents equal the last one saved.
+func (a *AutoSaver) Save() error {
+	snap, err := Capture(a.Store)
+	if err != nil {
+		return err
+	}
+	if a.last != nil && reflect.DeepEqual(a.last, snap.Units) {
+		return nil
+	}
+	if err := WriteFile(a.Path, snap, a.Format); err != nil {
+		return err
+	}
+	a.last = snap.Units
+	return nil
+}
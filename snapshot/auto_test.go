@@ -0,0 +1,77 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+func TestAutoSaver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auto.json")
+	st := store.NewInMemoryStore()
+	a := &AutoSaver{Store: st, Path: path, Interval: 10 * time.Millisecond, Format: FormatJSON}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- a.Run(ctx) }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("AutoSaver did not write a snapshot")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	st.SetHoldingRegistersAt(1, []uint16{11})
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	restored := store.NewInMemoryStore()
+	if err := LoadFile(path, restored); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if values, _ := restored.GetHoldingRegisters(1, 1); values[0] != 11 {
+		t.Errorf("Final save missing latest values: %v", values)
+	}
+}
+
+func TestAutoSaver_SkipsUnchanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auto.snap")
+	a := &AutoSaver{Store: store.NewInMemoryStore(), Path: path, Format: FormatBinary}
+
+	if err := a.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	os.Remove(path)
+	if err := a.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected an unchanged store not to be saved again")
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hootrhino/goodbusserver/protocol"
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+// Format selects the encoding of a snapshot file.
+type Format int
+
+const (
+	// FormatJSON is indented, human-readable JSON.
+	FormatJSON Format = iota
+	// FormatBinary is a compact big-endian encoding with bit-packed coils.
+	FormatBinary
+)
+
+// binaryMagic starts every binary snapshot.
+var binaryMagic = []byte("MBSS")
+
+// ErrInvalidFormat is returned when a file is not a snapshot.
+var ErrInvalidFormat = errors.New("snapshot: invalid format")
+
+// Encode writes snap to w.
+func Encode(w io.Writer, snap *Snapshot, format Format) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(snap)
+	case FormatBinary:
+		return encodeBinary(w, snap)
+	}
+	return fmt.Errorf("snapshot: unknown format %d", format)
+}
+
+// Decode reads a snapshot in either format from r.
+func Decode(r io.Reader) (*Snapshot, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(len(binaryMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if bytes.Equal(head, binaryMagic) {
+		return decodeBinary(br)
+	}
+
+	var snap Snapshot
+	if err := json.NewDecoder(br).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+	}
+	if snap.Version != Version {
+		return nil, fmt.Errorf("%w %d", ErrUnsupportedVersion, snap.Version)
+	}
+	return &snap, nil
+}
+
+// SaveFile captures st and writes it to path. The file is replaced
+// atomically, so a crash never leaves a truncated snapshot behind.
+func SaveFile(path string, st store.Store, format Format) error {
+	snap, err := Capture(st)
+	if err != nil {
+		return err
+	}
+	return WriteFile(path, snap, format)
+}
+
+// WriteFile writes snap to path atomically.
+func WriteFile(path string, snap *Snapshot, format Format) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	if err := Encode(w, snap, format); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ReadFile reads a snapshot file in either format.
+func ReadFile(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Decode(f)
+}
+
+// LoadFile restores st from the snapshot at path. A missing file is
+// reported with an error matching os.ErrNotExist.
+func LoadFile(path string, st store.Store) error {
+	snap, err := ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return snap.Restore(st)
+}
+
+// The binary format is, big-endian throughout:
+//
+//	magic "MBSS", version uint16, time int64 (Unix nanoseconds), units uint16
+//	per unit:  flags byte (1 = default), id byte, blocks uint32
+//	per block: table byte, start uint16, count uint32, then the values,
+//	           bit-packed LSB first for coils and discrete inputs and two
+//	           bytes each for registers
+func encodeBinary(w io.Writer, snap *Snapshot) error {
+	var buf bytes.Buffer
+	buf.Write(binaryMagic)
+	binary.Write(&buf, binary.BigEndian, uint16(snap.Version))
+	binary.Write(&buf, binary.BigEndian, snap.Time.UnixNano())
+	binary.Write(&buf, binary.BigEndian, uint16(len(snap.Units)))
+
+	for _, unit := range snap.Units {
+		var flags byte
+		if unit.Default {
+			flags |= 1
+		}
+		buf.WriteByte(flags)
+		buf.WriteByte(unit.ID)
+		binary.Write(&buf, binary.BigEndian, uint32(len(unit.Blocks)))
+
+		for _, b := range unit.Blocks {
+			buf.WriteByte(byte(b.Table))
+			binary.Write(&buf, binary.BigEndian, b.Start)
+			binary.Write(&buf, binary.BigEndian, uint32(len(b.Values)))
+			if b.Table == store.TableCoils || b.Table == store.TableDiscreteInputs {
+				bits := make([]byte, len(b.Values))
+				for i, v := range b.Values {
+					bits[i] = byte(min(v, 1))
+				}
+				buf.Write(protocol.PackBits(bits))
+				continue
+			}
+			binary.Write(&buf, binary.BigEndian, b.Values)
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func decodeBinary(r io.Reader) (*Snapshot, error) {
+	var header struct {
+		Magic   [4]byte
+		Version uint16
+		Time    int64
+		Units   uint16
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+	}
+	if header.Version != Version {
+		return nil, fmt.Errorf("%w %d", ErrUnsupportedVersion, header.Version)
+	}
+
+	snap := &Snapshot{Version: int(header.Version), Time: time.Unix(0, header.Time).UTC()}
+	for range header.Units {
+		var unitHeader struct {
+			Flags  byte
+			ID     byte
+			Blocks uint32
+		}
+		if err := binary.Read(r, binary.BigEndian, &unitHeader); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+		}
+		unit := Unit{ID: unitHeader.ID, Default: unitHeader.Flags&1 != 0}
+
+		for range unitHeader.Blocks {
+			var blockHeader struct {
+				Table byte
+				Start uint16
+				Count uint32
+			}
+			if err := binary.Read(r, binary.BigEndian, &blockHeader); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+			}
+			table := store.Table(blockHeader.Table)
+			if _, err := table.MarshalText(); err != nil || int(blockHeader.Start)+int(blockHeader.Count) > store.MaxSize {
+				return nil, ErrInvalidFormat
+			}
+
+			block := Block{Table: table, Start: blockHeader.Start}
+			if table == store.TableCoils || table == store.TableDiscreteInputs {
+				packed := make([]byte, (blockHeader.Count+7)/8)
+				if _, err := io.ReadFull(r, packed); err != nil {
+					return nil, fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+				}
+				for _, b := range protocol.UnpackBits(packed, int(blockHeader.Count)) {
+					block.Values = append(block.Values, uint16(b))
+				}
+			} else {
+				block.Values = make([]uint16, blockHeader.Count)
+				if err := binary.Read(r, binary.BigEndian, block.Values); err != nil {
+					return nil, fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+				}
+			}
+			unit.Blocks = append(unit.Blocks, block)
+		}
+		snap.Units = append(snap.Units, unit)
+	}
+	return snap, nil
+}
@@ -0,0 +1,119 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	snap, err := Capture(newTestStore(t))
+	if err != nil {
+		t.Fatalf("Capture() error = %v", err)
+	}
+
+	for _, format := range []Format{FormatJSON, FormatBinary} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, snap, format); err != nil {
+			t.Fatalf("Encode(%d) error = %v", format, err)
+		}
+		decoded, err := Decode(&buf)
+		if err != nil {
+			t.Fatalf("Decode(%d) error = %v", format, err)
+		}
+		if !decoded.Time.Equal(snap.Time) || !reflect.DeepEqual(decoded.Units, snap.Units) {
+			t.Errorf("Format %d did not round-trip", format)
+		}
+	}
+}
+
+func TestEncodeJSON_TableNames(t *testing.T) {
+	snap := &Snapshot{Version: Version, Units: []Unit{{Default: true, Blocks: []Block{
+		{Table: store.TableHoldingRegisters, Start: 10, Values: []uint16{1}},
+	}}}}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, snap, FormatJSON); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), `"table": "holding_registers"`) {
+		t.Errorf("Expected table names in JSON, got %s", buf.String())
+	}
+}
+
+func TestBinarySmallerThanJSON(t *testing.T) {
+	snap, err := Capture(store.NewInMemoryStore(store.WithFullAddressSpace()))
+	if err != nil {
+		t.Fatalf("Capture() error = %v", err)
+	}
+
+	var jsonBuf, binBuf bytes.Buffer
+	Encode(&jsonBuf, snap, FormatJSON)
+	Encode(&binBuf, snap, FormatBinary)
+	// Two bytes per register and one bit per coil, plus headers.
+	if want := 2*2*store.MaxSize + 2*store.MaxSize/8 + 100; binBuf.Len() > want {
+		t.Errorf("Binary snapshot is %d bytes, want at most %d", binBuf.Len(), want)
+	}
+	if binBuf.Len() >= jsonBuf.Len() {
+		t.Errorf("Binary snapshot (%d bytes) not smaller than JSON (%d bytes)", binBuf.Len(), jsonBuf.Len())
+	}
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	if _, err := Decode(strings.NewReader("not a snapshot")); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("Expected ErrInvalidFormat, got %v", err)
+	}
+	if _, err := Decode(strings.NewReader(`{"version": 7}`)); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+	if _, err := Decode(bytes.NewReader([]byte("MBSS\x00\x01"))); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("Expected ErrInvalidFormat for a truncated file, got %v", err)
+	}
+}
+
+func TestSaveLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.snap")
+	src := store.NewInMemoryStore()
+	src.SetHoldingRegistersAt(7, []uint16{99})
+
+	if err := LoadFile(path, src); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected os.ErrNotExist, got %v", err)
+	}
+	if err := SaveFile(path, src, FormatBinary); err != nil {
+		t.Fatalf("SaveFile() error = %v", err)
+	}
+
+	dst := store.NewInMemoryStore()
+	if err := LoadFile(path, dst); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if values, _ := dst.GetHoldingRegisters(7, 1); values[0] != 99 {
+		t.Errorf("LoadFile() did not restore values: %v", values)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("Expected only the snapshot file, found %d entries", len(entries))
+	}
+}
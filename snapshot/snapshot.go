@@ -0,0 +1,217 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package snapshot exports the contents of a store, all tables and all
+// units, to a versioned file and restores a store from it.
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+// Version is the snapshot format version written by this package.
+const Version = 1
+
+// ErrUnsupportedVersion is returned for snapshots of an unknown version.
+var ErrUnsupportedVersion = errors.New("snapshot: unsupported version")
+
+// Snapshot is the captured state of a store.
+type Snapshot struct {
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+	Units   []Unit    `json:"units"`
+}
+
+// Unit holds the tables of one unit. The default unit is the store itself;
+// the others are the units of a store.UnitStore.
+type Unit struct {
+	ID      byte    `json:"id"`
+	Default bool    `json:"default,omitempty"`
+	Blocks  []Block `json:"blocks"`
+}
+
+// Block is a run of consecutive values of one table. Coil and discrete input
+// values are 0 or 1.
+type Block struct {
+	Table  store.Table `json:"table"`
+	Start  uint16      `json:"start"`
+	Values []uint16    `json:"values"`
+}
+
+// windowed is implemented by stores with holes in their address space.
+type windowed interface {
+	Windows(table store.Table) []store.Window
+}
+
+// Capture reads every table of st, and of each unit when st is a
+// store.UnitStore. Each unit is read inside a store transaction, so its
+// tables are captured at a single instant.
+func Capture(st store.Store) (*Snapshot, error) {
+	snap := &Snapshot{Version: Version, Time: time.Now().UTC()}
+
+	unit, err := captureUnit(st)
+	if err != nil {
+		return nil, err
+	}
+	unit.Default = true
+	snap.Units = append(snap.Units, unit)
+
+	if us, ok := st.(store.UnitStore); ok {
+		for _, id := range us.Units() {
+			ust, _ := us.Unit(id)
+			unit, err := captureUnit(ust)
+			if err != nil {
+				return nil, fmt.Errorf("snapshot: unit %d: %w", id, err)
+			}
+			unit.ID = id
+			snap.Units = append(snap.Units, unit)
+		}
+	}
+	return snap, nil
+}
+
+func captureUnit(st store.Store) (Unit, error) {
+	var windows [4][]store.Window
+	for t := store.TableCoils; t <= store.TableInputRegisters; t++ {
+		windows[t] = tableWindows(st, t)
+	}
+
+	var unit Unit
+	err := st.Update(func(tx store.Transaction) error {
+		for t, ws := range windows {
+			for _, w := range ws {
+				values, err := readBlock(tx, store.Table(t), w)
+				if err != nil {
+					return fmt.Errorf("snapshot: read %s %d-%d: %w", store.Table(t), w.Start, w.End, err)
+				}
+				unit.Blocks = append(unit.Blocks, Block{Table: store.Table(t), Start: w.Start, Values: values})
+			}
+		}
+		return nil
+	})
+	return unit, err
+}
+
+// tableWindows returns the defined addresses of a table.
+func tableWindows(st store.Store, table store.Table) []store.Window {
+	if w, ok := st.(windowed); ok {
+		if windows := w.Windows(table); windows != nil {
+			return windows
+		}
+	}
+	if size := st.Size(table); size > 0 {
+		return []store.Window{{Start: 0, End: uint16(size - 1)}}
+	}
+	return nil
+}
+
+// maxRead is the largest quantity read at once.
+const maxRead = 0x8000
+
+func readBlock(r store.Reader, table store.Table, w store.Window) ([]uint16, error) {
+	n := int(w.End) - int(w.Start) + 1
+	values := make([]uint16, 0, n)
+	for off := 0; off < n; off += maxRead {
+		start := uint16(int(w.Start) + off)
+		quantity := uint16(min(maxRead, n-off))
+
+		switch table {
+		case store.TableCoils, store.TableDiscreteInputs:
+			get := r.GetCoils
+			if table == store.TableDiscreteInputs {
+				get = r.GetDiscreteInputs
+			}
+			bits, err := get(start, quantity)
+			if err != nil {
+				return nil, err
+			}
+			for _, b := range bits {
+				values = append(values, uint16(min(b, 1)))
+			}
+		case store.TableHoldingRegisters, store.TableInputRegisters:
+			get := r.GetHoldingRegisters
+			if table == store.TableInputRegisters {
+				get = r.GetInputRegisters
+			}
+			words, err := get(start, quantity)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, words...)
+		}
+	}
+	return values, nil
+}
+
+// Restore writes the snapshot into st. Each unit is written in one store
+// transaction; units other than the default must exist in st, which must
+// then be a store.UnitStore.
+func (s *Snapshot) Restore(st store.Store) error {
+	if s.Version != Version {
+		return fmt.Errorf("%w %d", ErrUnsupportedVersion, s.Version)
+	}
+
+	for _, unit := range s.Units {
+		target := st
+		if !unit.Default {
+			us, ok := st.(store.UnitStore)
+			if !ok {
+				return fmt.Errorf("snapshot: unit %d: store has no units", unit.ID)
+			}
+			if target, ok = us.Unit(unit.ID); !ok {
+				return fmt.Errorf("snapshot: unit %d: no such unit in store", unit.ID)
+			}
+		}
+
+		err := target.Update(func(tx store.Transaction) error {
+			for _, b := range unit.Blocks {
+				if err := writeBlock(tx, b); err != nil {
+					return fmt.Errorf("snapshot: unit %d: write %s at %d: %w", unit.ID, b.Table, b.Start, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeBlock(tx store.Transaction, b Block) error {
+	if len(b.Values) == 0 {
+		return nil
+	}
+	switch b.Table {
+	case store.TableCoils, store.TableDiscreteInputs:
+		bits := make([]byte, len(b.Values))
+		for i, v := range b.Values {
+			bits[i] = byte(min(v, 1))
+		}
+		if b.Table == store.TableCoils {
+			return tx.SetCoilsAt(b.Start, bits)
+		}
+		return tx.SetDiscreteInputsAt(b.Start, bits)
+	case store.TableHoldingRegisters:
+		return tx.SetHoldingRegistersAt(b.Start, b.Values)
+	case store.TableInputRegisters:
+		return tx.SetInputRegistersAt(b.Start, b.Values)
+	}
+	return store.ErrInvalidTable
+}
@@ -0,0 +1,94 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+func newTestStore(t *testing.T) *store.UnitMap {
+	t.Helper()
+	def := store.NewInMemoryStore(store.WithTableSize(store.TableCoils, 16))
+	def.SetCoilsAt(3, []byte{1, 1})
+	def.SetHoldingRegistersAt(100, []uint16{1234, 5678})
+	def.SetInputRegistersAt(999, []uint16{42})
+
+	unit := store.NewInMemoryStore(store.WithWindows(store.TableHoldingRegisters,
+		store.Window{Start: 40000, End: 40009}, store.Window{Start: 40100, End: 40101}))
+	unit.SetHoldingRegistersAt(40100, []uint16{7, 8})
+
+	m := store.NewUnitMap(def)
+	m.Set(5, unit)
+	return m
+}
+
+func TestCaptureRestore(t *testing.T) {
+	src := newTestStore(t)
+	snap, err := Capture(src)
+	if err != nil {
+		t.Fatalf("Capture() error = %v", err)
+	}
+	if len(snap.Units) != 2 || !snap.Units[0].Default || snap.Units[1].ID != 5 {
+		t.Fatalf("Unexpected units: %+v", snap.Units)
+	}
+
+	var holding []Block
+	for _, b := range snap.Units[1].Blocks {
+		if b.Table == store.TableHoldingRegisters {
+			holding = append(holding, b)
+		}
+	}
+	if len(holding) != 2 || holding[1].Start != 40100 || !reflect.DeepEqual(holding[1].Values, []uint16{7, 8}) {
+		t.Errorf("Unit windows not captured as blocks: %+v", holding)
+	}
+
+	dst := store.NewUnitMap(store.NewInMemoryStore(store.WithTableSize(store.TableCoils, 16)))
+	dst.Set(5, store.NewInMemoryStore(store.WithWindows(store.TableHoldingRegisters,
+		store.Window{Start: 40000, End: 40009}, store.Window{Start: 40100, End: 40101})))
+	if err := snap.Restore(dst); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	coils, _ := dst.GetCoils(0, 16)
+	if coils[3] != 1 || coils[4] != 1 || coils[5] != 0 {
+		t.Errorf("Coils not restored: %v", coils)
+	}
+	if values, _ := dst.GetInputRegisters(999, 1); values[0] != 42 {
+		t.Errorf("Input registers not restored: %v", values)
+	}
+	unit, _ := dst.Unit(5)
+	if values, _ := unit.GetHoldingRegisters(40100, 2); !reflect.DeepEqual(values, []uint16{7, 8}) {
+		t.Errorf("Unit 5 not restored: %v", values)
+	}
+}
+
+func TestRestore_MissingUnit(t *testing.T) {
+	snap, err := Capture(newTestStore(t))
+	if err != nil {
+		t.Fatalf("Capture() error = %v", err)
+	}
+	if err := snap.Restore(store.NewInMemoryStore()); err == nil {
+		t.Error("Expected an error restoring unit 5 into a store without units")
+	}
+
+	snap.Version = 99
+	if err := snap.Restore(store.NewInMemoryStore()); err == nil {
+		t.Error("Expected an error for an unknown version")
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Access is the access mode of a register region as seen by Modbus clients.
+// The zero value is read-write.
+type Access int
+
+const (
+	AccessReadWrite Access = iota
+	AccessReadOnly
+	AccessWriteOnly
+	// AccessNone results from intersecting read-only and write-only
+	// addresses in one range.
+	AccessNone
+)
+
+func (a Access) String() string {
+	switch a {
+	case AccessReadWrite:
+		return "read-write"
+	case AccessReadOnly:
+		return "read-only"
+	case AccessWriteOnly:
+		return "write-only"
+	case AccessNone:
+		return "none"
+	}
+	return "unknown"
+}
+
+// ParseAccess returns the mode named by Access.String.
+func ParseAccess(name string) (Access, error) {
+	for a := AccessReadWrite; a <= AccessNone; a++ {
+		if a.String() == name {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("store: unknown access mode %q", name)
+}
+
+// MarshalText encodes the mode as its name.
+func (a Access) MarshalText() ([]byte, error) {
+	if a < AccessReadWrite || a > AccessNone {
+		return nil, fmt.Errorf("store: unknown access mode %d", int(a))
+	}
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText decodes a mode name.
+func (a *Access) UnmarshalText(text []byte) error {
+	parsed, err := ParseAccess(string(text))
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// CanRead reports whether clients may read addresses with this mode.
+func (a Access) CanRead() bool {
+	return a == AccessReadWrite || a == AccessReadOnly
+}
+
+// CanWrite reports whether clients may write addresses with this mode.
+func (a Access) CanWrite() bool {
+	return a == AccessReadWrite || a == AccessWriteOnly
+}
+
+// Intersect returns the mode allowing only what both a and b allow.
+func (a Access) Intersect(b Access) Access {
+	switch {
+	case a == b || b == AccessReadWrite:
+		return a
+	case a == AccessReadWrite:
+		return b
+	}
+	return AccessNone
+}
+
+// AccessChecker reports the access mode Modbus clients of a unit have to
+// quantity addresses from start; mixed modes are intersected.
+type AccessChecker interface {
+	Access(unitID byte, table Table, start uint16, quantity int) Access
+}
+
+// AccessRule sets the access mode of a window of addresses.
+type AccessRule struct {
+	// Units lists the unit IDs the rule applies to; empty means every unit.
+	Units  []byte
+	Table  Table
+	Window Window
+	Access Access
+}
+
+func (r AccessRule) appliesTo(unitID byte) bool {
+	if len(r.Units) == 0 {
+		return true
+	}
+	for _, u := range r.Units {
+		if u == unitID {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessMap is an AccessChecker built from rules. Addresses not covered by
+// any rule are read-write; where rules overlap their modes are intersected.
+type AccessMap struct {
+	mu    sync.RWMutex
+	rules []AccessRule
+}
+
+var _ AccessChecker = (*AccessMap)(nil)
+
+// NewAccessMap returns a map holding rules.
+func NewAccessMap(rules ...AccessRule) *AccessMap {
+	m := &AccessMap{}
+	for _, r := range rules {
+		m.Add(r)
+	}
+	return m
+}
+
+// Add appends a rule.
+func (m *AccessMap) Add(rule AccessRule) {
+	rule.Units = append([]byte(nil), rule.Units...)
+	if rule.Window.End < rule.Window.Start {
+		rule.Window.Start, rule.Window.End = rule.Window.End, rule.Window.Start
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rules = append(m.rules, rule)
+}
+
+// Rules returns a copy of the rules in the order they were added.
+func (m *AccessMap) Rules() []AccessRule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]AccessRule(nil), m.rules...)
+}
+
+// Access implements AccessChecker.
+func (m *AccessMap) Access(unitID byte, table Table, start uint16, quantity int) Access {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	access := AccessReadWrite
+	for _, r := range m.rules {
+		if r.Table == table && r.appliesTo(unitID) &&
+			overlaps(table, start, quantity, Filter{Table: table, Start: r.Window.Start, End: r.Window.End}) {
+			access = access.Intersect(r.Access)
+		}
+	}
+	return access
+}
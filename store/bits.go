@@ -0,0 +1,115 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+// bitSet holds a coil or discrete input table packed eight bits per byte,
+// least significant bit first, as the bits travel in Modbus frames. The
+// full 65536-bit space takes 8 KB.
+type bitSet struct {
+	data []byte
+	n    int
+}
+
+func newBitSet(n int) bitSet {
+	return bitSet{data: make([]byte, (n+7)/8), n: n}
+}
+
+// bitSetOf packs values, one bit per byte with non-zero meaning on.
+func bitSetOf(values []byte) bitSet {
+	b := newBitSet(len(values))
+	for i, v := range values {
+		b.set(i, v != 0)
+	}
+	return b
+}
+
+func (b bitSet) len() int {
+	return b.n
+}
+
+func (b bitSet) get(i int) bool {
+	return b.data[i/8]&(1<<(i%8)) != 0
+}
+
+func (b bitSet) set(i int, on bool) {
+	if on {
+		b.data[i/8] |= 1 << (i % 8)
+	} else {
+		b.data[i/8] &^= 1 << (i % 8)
+	}
+}
+
+// read unpacks quantity bits from start into dst, one 0 or 1 per byte,
+// allocating dst when it is nil.
+func (b bitSet) read(start uint16, quantity int, dst []byte) ([]byte, error) {
+	if quantity == 0 {
+		return nil, ErrInvalidAddress
+	}
+	startIdx := int(start)
+	endIdx := startIdx + quantity
+
+	if startIdx >= b.n || endIdx > b.n {
+		return nil, ErrInvalidAddress
+	}
+
+	if dst == nil {
+		dst = make([]byte, quantity)
+	}
+	for i := range quantity {
+		dst[i] = 0
+		if b.get(startIdx + i) {
+			dst[i] = 1
+		}
+	}
+	return dst, nil
+}
+
+// write stores values from start, non-zero meaning on. Nothing is written if
+// the range does not fit.
+func (b bitSet) write(start uint16, values []byte) error {
+	if len(values) == 0 {
+		return ErrInvalidAddress
+	}
+	startIdx := int(start)
+	if startIdx+len(values) > b.n {
+		return ErrInvalidAddress
+	}
+
+	for i, v := range values {
+		b.set(startIdx+i, v != 0)
+	}
+	return nil
+}
+
+// bitsToBytes converts bools to the one-byte-per-bit form used by Store.
+func bitsToBytes(values []bool) []byte {
+	out := make([]byte, len(values))
+	for i, v := range values {
+		if v {
+			out[i] = 1
+		}
+	}
+	return out
+}
+
+// checkBitTable returns ErrInvalidTable unless t is a coil or discrete input
+// table.
+func checkBitTable(t Table) error {
+	if t != TableCoils && t != TableDiscreteInputs {
+		return ErrInvalidTable
+	}
+	return nil
+}
@@ -0,0 +1,408 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// CachedStore keeps an in-memory image of a persistent store. Every read is
+// served from memory. Writes reach the backing store either before they are
+// applied to the image (write-through, the default) or from a write-behind
+// queue that is flushed periodically.
+//
+// Queued writes are persisted in the order they were applied, and each flush
+// is one backing transaction, so after a crash the backing store holds a
+// prefix of the write sequence, never a mix of old and new writes.
+//
+// Whole-table setters write from address 0 and leave the rest of the table
+// unchanged, as SqliteStore does.
+type CachedStore struct {
+	backing Store
+	image   *InMemoryStore
+	cfg     cacheConfig
+
+	// mu orders writes, so that the image and the backing store, or the
+	// queue, see them in the same order.
+	mu      sync.Mutex
+	pending []cachedWrite
+	// flushMu serialises flushes.
+	flushMu sync.Mutex
+
+	kick      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// CacheOption configures a CachedStore built by NewCachedStore.
+type CacheOption func(*cacheConfig)
+
+type cacheConfig struct {
+	interval   time.Duration
+	maxPending int
+	onError    func(error)
+}
+
+// DefaultMaxPending is the number of queued writes that triggers a flush
+// before the flush interval has elapsed.
+const DefaultMaxPending = 1024
+
+// WithWriteBehind queues writes and persists them every interval instead of
+// on every write. A non-positive interval keeps write-through.
+func WithWriteBehind(interval time.Duration) CacheOption {
+	return func(c *cacheConfig) {
+		c.interval = interval
+	}
+}
+
+// WithMaxPending flushes the write-behind queue early once it holds n
+// writes.
+func WithMaxPending(n int) CacheOption {
+	return func(c *cacheConfig) {
+		if n > 0 {
+			c.maxPending = n
+		}
+	}
+}
+
+// WithFlushErrorHandler sets a function called when a background flush
+// fails. The failed writes stay queued and are retried on the next flush.
+func WithFlushErrorHandler(fn func(error)) CacheOption {
+	return func(c *cacheConfig) {
+		c.onError = fn
+	}
+}
+
+type cachedWrite struct {
+	table  Table
+	start  uint16
+	values []uint16
+}
+
+// ErrCachedUnits is returned by NewCachedStore for a backing store with
+// per-unit stores, whose units the cache would merge into one image.
+var ErrCachedUnits = errors.New("store: cannot cache a store with unit stores")
+
+// NewCachedStore loads every table of backing into memory and returns a
+// store that serves reads from there. Closing the CachedStore flushes
+// pending writes and closes backing. It fails with ErrCachedUnits when
+// backing is a UnitStore with units; units must not be added to backing
+// afterwards either.
+func NewCachedStore(backing Store, opts ...CacheOption) (*CachedStore, error) {
+	if us, ok := backing.(UnitStore); ok && len(us.Units()) > 0 {
+		return nil, ErrCachedUnits
+	}
+	cfg := cacheConfig{maxPending: DefaultMaxPending}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	image, err := loadImage(backing)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &CachedStore{backing: backing, image: image, cfg: cfg}
+	if cfg.interval > 0 {
+		c.kick = make(chan struct{}, 1)
+		c.stop = make(chan struct{})
+		c.done = make(chan struct{})
+		go c.run()
+	}
+	return c, nil
+}
+
+// loadImage copies backing into a new InMemoryStore of the same shape.
+func loadImage(backing Store) (*InMemoryStore, error) {
+	var opts []InMemoryOption
+	var windows [4][]Window
+	for t := TableCoils; t <= TableInputRegisters; t++ {
+		opts = append(opts, WithTableSize(t, backing.Size(t)))
+		if w, ok := backing.(interface{ Windows(Table) []Window }); ok {
+			windows[t] = w.Windows(t)
+			if windows[t] != nil {
+				opts = append(opts, WithWindows(t, windows[t]...))
+			}
+		}
+		if windows[t] == nil && backing.Size(t) > 0 {
+			windows[t] = []Window{{Start: 0, End: uint16(backing.Size(t) - 1)}}
+		}
+	}
+	image := NewInMemoryStore(opts...).(*InMemoryStore)
+
+	err := backing.Update(func(tx Transaction) error {
+		return image.Update(func(img Transaction) error {
+			for t, ws := range windows {
+				for _, w := range ws {
+					if err := copyWindow(tx, img, Table(t), w); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+// maxCopy is the largest quantity read from the backing store at once.
+const maxCopy = 0x8000
+
+func copyWindow(src Reader, dst Transaction, table Table, w Window) error {
+	n := int(w.End) - int(w.Start) + 1
+	for off := 0; off < n; off += maxCopy {
+		start := uint16(int(w.Start) + off)
+		values, err := readWords(src, table, start, min(maxCopy, n-off))
+		if err != nil {
+			return err
+		}
+		if err := writeWords(dst, table, start, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Backing returns the persistent store behind the cache.
+func (c *CachedStore) Backing() Store {
+	return c.backing
+}
+
+// Pending returns the number of queued writes not yet persisted. It is
+// always 0 in write-through mode.
+func (c *CachedStore) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending)
+}
+
+func (c *CachedStore) GetCoils(start, quantity uint16) ([]byte, error) {
+	return c.image.GetCoils(start, quantity)
+}
+
+func (c *CachedStore) GetDiscreteInputs(start, quantity uint16) ([]byte, error) {
+	return c.image.GetDiscreteInputs(start, quantity)
+}
+
+func (c *CachedStore) GetHoldingRegisters(start, quantity uint16) ([]uint16, error) {
+	return c.image.GetHoldingRegisters(start, quantity)
+}
+
+func (c *CachedStore) GetInputRegisters(start, quantity uint16) ([]uint16, error) {
+	return c.image.GetInputRegisters(start, quantity)
+}
+
+// View runs fn with a consistent view of the image, see InMemoryStore.View.
+func (c *CachedStore) View(fn func(r Reader) error) error {
+	return c.image.View(fn)
+}
+
+func (c *CachedStore) SetCoils(values []byte) error {
+	return c.SetCoilsAt(0, values)
+}
+
+func (c *CachedStore) SetDiscreteInputs(values []byte) error {
+	return c.SetDiscreteInputsAt(0, values)
+}
+
+func (c *CachedStore) SetHoldingRegisters(values []uint16) error {
+	return c.SetHoldingRegistersAt(0, values)
+}
+
+func (c *CachedStore) SetInputRegisters(values []uint16) error {
+	return c.SetInputRegistersAt(0, values)
+}
+
+func (c *CachedStore) SetCoilsAt(start uint16, values []byte) error {
+	return c.write(TableCoils, start, bitsToWords(values))
+}
+
+func (c *CachedStore) SetDiscreteInputsAt(start uint16, values []byte) error {
+	return c.write(TableDiscreteInputs, start, bitsToWords(values))
+}
+
+func (c *CachedStore) SetHoldingRegistersAt(start uint16, values []uint16) error {
+	return c.write(TableHoldingRegisters, start, values)
+}
+
+func (c *CachedStore) SetInputRegistersAt(start uint16, values []uint16) error {
+	return c.write(TableInputRegisters, start, values)
+}
+
+func (c *CachedStore) write(table Table, start uint16, values []uint16) error {
+	return c.Update(func(tx Transaction) error {
+		return writeWords(tx, table, start, values)
+	})
+}
+
+// Update implements Store. In write-through mode fn runs in a backing
+// transaction and the image is updated once it commits; with write-behind
+// fn runs against the image and its writes are queued as a whole.
+func (c *CachedStore) Update(fn func(tx Transaction) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cfg.interval <= 0 {
+		var writes []cachedWrite
+		err := c.backing.Update(func(tx Transaction) error {
+			rec := &recordingTx{Transaction: tx}
+			err := fn(rec)
+			writes = rec.writes
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return c.image.Update(func(tx Transaction) error {
+			return applyWrites(tx, writes)
+		})
+	}
+
+	var writes []cachedWrite
+	err := c.image.Update(func(tx Transaction) error {
+		rec := &recordingTx{Transaction: tx}
+		err := fn(rec)
+		writes = rec.writes
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	c.pending = append(c.pending, writes...)
+	if len(c.pending) >= c.cfg.maxPending {
+		select {
+		case c.kick <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Flush persists every queued write in one backing transaction. Writes
+// leave the queue only once the transaction commits; if it fails they stay
+// queued, ahead of any made since.
+func (c *CachedStore) Flush() error {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	c.mu.Lock()
+	batch := c.pending[:len(c.pending):len(c.pending)]
+	c.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := c.backing.Update(func(tx Transaction) error {
+		return applyWrites(tx, batch)
+	})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.pending = c.pending[len(batch):]
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *CachedStore) run() {
+	defer close(c.done)
+	ticker := time.NewTicker(c.cfg.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		case <-c.kick:
+		}
+		if err := c.Flush(); err != nil && c.cfg.onError != nil {
+			c.cfg.onError(err)
+		}
+	}
+}
+
+// Size implements Store.
+func (c *CachedStore) Size(table Table) int {
+	return c.image.Size(table)
+}
+
+// Windows returns the valid address windows of the backing store, see
+// InMemoryStore.Windows.
+func (c *CachedStore) Windows(table Table) []Window {
+	return c.image.Windows(table)
+}
+
+// Close stops the write-behind loop, flushes the queue and closes the
+// backing store.
+func (c *CachedStore) Close() error {
+	c.closeOnce.Do(func() {
+		if c.stop != nil {
+			close(c.stop)
+			<-c.done
+		}
+		c.closeErr = errors.Join(c.Flush(), c.backing.Close())
+	})
+	return c.closeErr
+}
+
+func applyWrites(tx Transaction, writes []cachedWrite) error {
+	for _, w := range writes {
+		if err := writeWords(tx, w.table, w.start, w.values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordingTx remembers the writes that succeed, so they can be replayed on
+// the image or the backing store.
+type recordingTx struct {
+	Transaction
+	writes []cachedWrite
+}
+
+func (tx *recordingTx) SetCoilsAt(start uint16, values []byte) error {
+	return tx.record(TableCoils, start, bitsToWords(values))
+}
+
+func (tx *recordingTx) SetDiscreteInputsAt(start uint16, values []byte) error {
+	return tx.record(TableDiscreteInputs, start, bitsToWords(values))
+}
+
+func (tx *recordingTx) SetHoldingRegistersAt(start uint16, values []uint16) error {
+	return tx.record(TableHoldingRegisters, start, append([]uint16(nil), values...))
+}
+
+func (tx *recordingTx) SetInputRegistersAt(start uint16, values []uint16) error {
+	return tx.record(TableInputRegisters, start, append([]uint16(nil), values...))
+}
+
+func (tx *recordingTx) record(table Table, start uint16, values []uint16) error {
+	if err := writeWords(tx.Transaction, table, start, values); err != nil {
+		return err
+	}
+	tx.writes = append(tx.writes, cachedWrite{table: table, start: start, values: values})
+	return nil
+}
@@ -0,0 +1,290 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingStore fails every Update while fail is set.
+type failingStore struct {
+	Store
+	fail atomic.Bool
+}
+
+var errBackingDown = errors.New("backing store down")
+
+func (s *failingStore) Update(fn func(tx Transaction) error) error {
+	if s.fail.Load() {
+		return errBackingDown
+	}
+	return s.Store.Update(fn)
+}
+
+func TestCachedStore_LoadsBackingStore(t *testing.T) {
+	backing, err := NewSqliteStore(":memory:")
+	if err != nil {
+		t.Fatalf("NewSqliteStore() error = %v", err)
+	}
+	backing.SetHoldingRegistersAt(500, []uint16{7, 8})
+	backing.SetCoilsAt(65535, []byte{1})
+
+	c, err := NewCachedStore(backing)
+	if err != nil {
+		t.Fatalf("NewCachedStore() error = %v", err)
+	}
+	defer c.Close()
+
+	if got := c.Size(TableHoldingRegisters); got != MaxSize {
+		t.Errorf("Size() = %d, want %d", got, MaxSize)
+	}
+	regs, _ := c.GetHoldingRegisters(499, 3)
+	if !reflect.DeepEqual(regs, []uint16{0, 7, 8}) {
+		t.Errorf("GetHoldingRegisters() = %v, want [0 7 8]", regs)
+	}
+	coils, _ := c.GetCoils(65535, 1)
+	if !reflect.DeepEqual(coils, []byte{1}) {
+		t.Errorf("GetCoils() = %v, want [1]", coils)
+	}
+}
+
+func TestCachedStore_KeepsWindows(t *testing.T) {
+	backing, err := NewSparseStore(Region{Table: TableHoldingRegisters, Start: 100, Length: 2, Values: []uint16{1, 2}})
+	if err != nil {
+		t.Fatalf("NewSparseStore() error = %v", err)
+	}
+	c, err := NewCachedStore(backing)
+	if err != nil {
+		t.Fatalf("NewCachedStore() error = %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.GetHoldingRegisters(99, 1); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("read outside window error = %v, want ErrInvalidAddress", err)
+	}
+	regs, err := c.GetHoldingRegisters(100, 2)
+	if err != nil || !reflect.DeepEqual(regs, []uint16{1, 2}) {
+		t.Errorf("GetHoldingRegisters() = %v, %v, want [1 2]", regs, err)
+	}
+}
+
+func TestCachedStore_WriteThrough(t *testing.T) {
+	backing := NewInMemoryStore()
+	c, err := NewCachedStore(backing)
+	if err != nil {
+		t.Fatalf("NewCachedStore() error = %v", err)
+	}
+	defer c.Close()
+
+	if err := c.SetHoldingRegistersAt(10, []uint16{1, 2, 3}); err != nil {
+		t.Fatalf("SetHoldingRegistersAt() error = %v", err)
+	}
+	if err := c.SetCoilsAt(3, []byte{1, 0, 1}); err != nil {
+		t.Fatalf("SetCoilsAt() error = %v", err)
+	}
+	if c.Pending() != 0 {
+		t.Errorf("Pending() = %d, want 0", c.Pending())
+	}
+
+	for name, r := range map[string]Reader{"cache": c, "backing": backing} {
+		regs, _ := r.GetHoldingRegisters(10, 3)
+		if !reflect.DeepEqual(regs, []uint16{1, 2, 3}) {
+			t.Errorf("%s registers = %v, want [1 2 3]", name, regs)
+		}
+		coils, _ := r.GetCoils(3, 3)
+		if !reflect.DeepEqual(coils, []byte{1, 0, 1}) {
+			t.Errorf("%s coils = %v, want [1 0 1]", name, coils)
+		}
+	}
+}
+
+func TestCachedStore_WriteThroughFailure(t *testing.T) {
+	backing := &failingStore{Store: NewInMemoryStore()}
+	c, err := NewCachedStore(backing)
+	if err != nil {
+		t.Fatalf("NewCachedStore() error = %v", err)
+	}
+	defer c.Close()
+
+	backing.fail.Store(true)
+	if err := c.SetHoldingRegistersAt(0, []uint16{9}); !errors.Is(err, errBackingDown) {
+		t.Fatalf("SetHoldingRegistersAt() error = %v, want errBackingDown", err)
+	}
+	regs, _ := c.GetHoldingRegisters(0, 1)
+	if regs[0] != 0 {
+		t.Errorf("cache holds %d after a failed write, want 0", regs[0])
+	}
+}
+
+func TestCachedStore_WriteBehind(t *testing.T) {
+	backing := NewInMemoryStore()
+	c, err := NewCachedStore(backing, WithWriteBehind(time.Hour))
+	if err != nil {
+		t.Fatalf("NewCachedStore() error = %v", err)
+	}
+	defer c.Close()
+
+	c.SetHoldingRegistersAt(0, []uint16{1, 1})
+	c.SetHoldingRegistersAt(1, []uint16{2})
+	c.SetInputRegistersAt(5, []uint16{3})
+
+	regs, _ := c.GetHoldingRegisters(0, 2)
+	if !reflect.DeepEqual(regs, []uint16{1, 2}) {
+		t.Errorf("cache = %v, want [1 2]", regs)
+	}
+	if got, _ := backing.GetHoldingRegisters(0, 2); !reflect.DeepEqual(got, []uint16{0, 0}) {
+		t.Errorf("backing before flush = %v, want [0 0]", got)
+	}
+	if c.Pending() != 3 {
+		t.Errorf("Pending() = %d, want 3", c.Pending())
+	}
+
+	if err := c.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if got, _ := backing.GetHoldingRegisters(0, 2); !reflect.DeepEqual(got, []uint16{1, 2}) {
+		t.Errorf("backing after flush = %v, want [1 2]", got)
+	}
+	if got, _ := backing.GetInputRegisters(5, 1); got[0] != 3 {
+		t.Errorf("backing input register = %d, want 3", got[0])
+	}
+	if c.Pending() != 0 {
+		t.Errorf("Pending() = %d, want 0", c.Pending())
+	}
+}
+
+func TestCachedStore_FailedFlushKeepsOrder(t *testing.T) {
+	backing := &failingStore{Store: NewInMemoryStore()}
+	c, err := NewCachedStore(backing, WithWriteBehind(time.Hour))
+	if err != nil {
+		t.Fatalf("NewCachedStore() error = %v", err)
+	}
+	defer c.Close()
+
+	c.SetHoldingRegistersAt(0, []uint16{1})
+	backing.fail.Store(true)
+	if err := c.Flush(); !errors.Is(err, errBackingDown) {
+		t.Fatalf("Flush() error = %v, want errBackingDown", err)
+	}
+	c.SetHoldingRegistersAt(0, []uint16{2})
+	if c.Pending() != 2 {
+		t.Fatalf("Pending() = %d, want 2", c.Pending())
+	}
+
+	backing.fail.Store(false)
+	if err := c.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if got, _ := backing.GetHoldingRegisters(0, 1); got[0] != 2 {
+		t.Errorf("backing = %d, want the later write 2", got[0])
+	}
+}
+
+func TestCachedStore_MaxPendingFlushes(t *testing.T) {
+	backing := NewInMemoryStore()
+	c, err := NewCachedStore(backing, WithWriteBehind(time.Hour), WithMaxPending(2))
+	if err != nil {
+		t.Fatalf("NewCachedStore() error = %v", err)
+	}
+	defer c.Close()
+
+	c.SetHoldingRegistersAt(0, []uint16{1})
+	c.SetHoldingRegistersAt(1, []uint16{2})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for c.Pending() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("queue was not flushed after reaching the limit")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got, _ := backing.GetHoldingRegisters(0, 2); !reflect.DeepEqual(got, []uint16{1, 2}) {
+		t.Errorf("backing = %v, want [1 2]", got)
+	}
+}
+
+func TestCachedStore_UpdateRollback(t *testing.T) {
+	for _, opts := range [][]CacheOption{nil, {WithWriteBehind(time.Hour)}} {
+		backing := NewInMemoryStore()
+		c, err := NewCachedStore(backing, opts...)
+		if err != nil {
+			t.Fatalf("NewCachedStore() error = %v", err)
+		}
+
+		errAbort := errors.New("abort")
+		err = c.Update(func(tx Transaction) error {
+			tx.SetHoldingRegistersAt(0, []uint16{5})
+			return errAbort
+		})
+		if !errors.Is(err, errAbort) {
+			t.Errorf("Update() error = %v, want errAbort", err)
+		}
+		if c.Pending() != 0 {
+			t.Errorf("Pending() = %d, want 0", c.Pending())
+		}
+		if err := c.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+		for name, r := range map[string]Reader{"cache": c, "backing": backing} {
+			if got, _ := r.GetHoldingRegisters(0, 1); got[0] != 0 {
+				t.Errorf("%s = %d after rollback, want 0", name, got[0])
+			}
+		}
+	}
+}
+
+func TestCachedStore_CloseFlushes(t *testing.T) {
+	backing := NewInMemoryStore()
+	c, err := NewCachedStore(backing, WithWriteBehind(time.Hour))
+	if err != nil {
+		t.Fatalf("NewCachedStore() error = %v", err)
+	}
+
+	c.SetCoilsAt(0, []byte{1})
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if got, _ := backing.GetCoils(0, 1); got[0] != 1 {
+		t.Errorf("backing coil = %d after Close, want 1", got[0])
+	}
+}
+
+func TestCachedStore_RejectsUnits(t *testing.T) {
+	backing, err := NewSqliteStore(":memory:")
+	if err != nil {
+		t.Fatalf("NewSqliteStore() error = %v", err)
+	}
+	defer backing.Close()
+
+	// 没有单元的数据库可以缓存
+	if _, err := NewCachedStore(backing); err != nil {
+		t.Fatalf("NewCachedStore() error = %v", err)
+	}
+
+	if _, err := backing.AddUnit(2); err != nil {
+		t.Fatalf("AddUnit() error = %v", err)
+	}
+	if _, err := NewCachedStore(backing); !errors.Is(err, ErrCachedUnits) {
+		t.Errorf("NewCachedStore() error = %v, want %v", err, ErrCachedUnits)
+	}
+	if _, err := NewCachedStore(NewUnitMap(NewInMemoryStore())); err != nil {
+		t.Errorf("NewCachedStore() of an empty unit map error = %v", err)
+	}
+}
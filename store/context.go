@@ -0,0 +1,76 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import "context"
+
+// Source tells who initiated a write.
+type Source int
+
+const (
+	// SourceApplication is a write made by the application through the Go API.
+	SourceApplication Source = iota
+	// SourceModbus is a write made by a Modbus client.
+	SourceModbus
+)
+
+func (s Source) String() string {
+	if s == SourceModbus {
+		return "modbus"
+	}
+	return "application"
+}
+
+// Origin describes who initiated a store operation.
+type Origin struct {
+	Source Source
+	UnitID byte
+	// Client is the remote address of the Modbus client, empty for
+	// application writes.
+	Client string
+	ConnID uint64
+}
+
+type originKey struct{}
+
+// WithOrigin returns a copy of ctx carrying origin.
+func WithOrigin(ctx context.Context, origin Origin) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+// OriginFromContext returns the origin stored in ctx. Without one the
+// operation is attributed to the application.
+func OriginFromContext(ctx context.Context) Origin {
+	origin, _ := ctx.Value(originKey{}).(Origin)
+	return origin
+}
+
+// ContextStore is implemented by stores that can bind a request context to
+// their operations, for example to honour cancellation or to attribute
+// writes to the client that made them.
+type ContextStore interface {
+	Store
+	WithContext(ctx context.Context) Store
+}
+
+// BindContext returns st bound to ctx if st implements ContextStore, and st
+// unchanged otherwise.
+func BindContext(st Store, ctx context.Context) Store {
+	if cs, ok := st.(ContextStore); ok {
+		return cs.WithContext(ctx)
+	}
+	return st
+}
@@ -0,0 +1,39 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"context"
+	"testing"
+)
+
+func TestOriginFromContext(t *testing.T) {
+	if origin := OriginFromContext(context.Background()); origin.Source != SourceApplication {
+		t.Errorf("expected application source by default, got %v", origin.Source)
+	}
+
+	ctx := WithOrigin(context.Background(), Origin{Source: SourceModbus, UnitID: 2})
+	if origin := OriginFromContext(ctx); origin.Source != SourceModbus || origin.UnitID != 2 {
+		t.Errorf("unexpected origin: %+v", origin)
+	}
+}
+
+func TestBindContext_Unsupported(t *testing.T) {
+	st := NewInMemoryStore()
+	if BindContext(st, context.Background()) != st {
+		t.Error("expected store without WithContext to be returned unchanged")
+	}
+}
@@ -19,169 +19,420 @@ import (
 	"sync"
 )
 
+// InMemoryStore keeps all four tables in memory. Coils and discrete inputs
+// are bit-packed. Reads return copies and setters copy their input, so
+// callers never share memory with the store.
 type InMemoryStore struct {
-	coils            []byte
-	discreteInputs   []byte
+	coils            bitSet
+	discreteInputs   bitSet
 	holdingRegisters []uint16
 	inputRegisters   []uint16
-	mu               sync.RWMutex
+	// windows holds the merged valid address windows per table; nil means
+	// the whole table is valid.
+	windows [4][]Window
+	mu      sync.RWMutex
+}
+
+// InMemoryOption configures an InMemoryStore built by NewInMemoryStore.
+type InMemoryOption func(*inMemoryConfig)
+
+type inMemoryConfig struct {
+	sizes   [4]int
+	windows [4][]Window
+}
+
+// DefaultTableSize is the number of addresses per table when no size is
+// configured.
+const DefaultTableSize = 1000
+
+// WithTableSize sets the number of addresses in table. Sizes are capped at
+// MaxSize.
+func WithTableSize(table Table, size int) InMemoryOption {
+	return func(c *inMemoryConfig) {
+		if validTable(table) {
+			c.sizes[table] = min(max(size, 0), MaxSize)
+		}
+	}
+}
+
+// WithFullAddressSpace sizes every table to the full 0-65535 range.
+func WithFullAddressSpace() InMemoryOption {
+	return func(c *inMemoryConfig) {
+		for i := range c.sizes {
+			c.sizes[i] = MaxSize
+		}
+	}
+}
+
+// WithWindows declares the valid addresses of table. Any read or write that
+// touches an address outside the windows fails with ErrInvalidAddress, which
+// the handlers answer with exception 0x02. The table grows to cover the last
+// window if needed.
+func WithWindows(table Table, windows ...Window) InMemoryOption {
+	return func(c *inMemoryConfig) {
+		if validTable(table) {
+			c.windows[table] = append(c.windows[table], windows...)
+		}
+	}
+}
+
+func NewInMemoryStore(opts ...InMemoryOption) Store {
+	cfg := inMemoryConfig{sizes: [4]int{DefaultTableSize, DefaultTableSize, DefaultTableSize, DefaultTableSize}}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	s := &InMemoryStore{}
+	for i, windows := range cfg.windows {
+		if len(windows) == 0 {
+			continue
+		}
+		s.windows[i] = mergeWindows(windows)
+		last := s.windows[i][len(s.windows[i])-1]
+		cfg.sizes[i] = max(cfg.sizes[i], int(last.End)+1)
+	}
+
+	s.coils = newBitSet(cfg.sizes[TableCoils])
+	s.discreteInputs = newBitSet(cfg.sizes[TableDiscreteInputs])
+	s.holdingRegisters = make([]uint16, cfg.sizes[TableHoldingRegisters])
+	s.inputRegisters = make([]uint16, cfg.sizes[TableInputRegisters])
+	return s
+}
+
+// GetCoils implements Store.
+func (s *InMemoryStore) GetCoils(start, quantity uint16) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return inMemoryReader{s}.GetCoils(start, quantity)
+}
+
+// GetDiscreteInputs implements Store.
+func (s *InMemoryStore) GetDiscreteInputs(start, quantity uint16) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return inMemoryReader{s}.GetDiscreteInputs(start, quantity)
 }
 
 // GetHoldingRegisters implements Store.
-func (s *InMemoryStore) GetHoldingRegisters(start uint16, quantity uint16) ([]uint16, error) {
+func (s *InMemoryStore) GetHoldingRegisters(start, quantity uint16) ([]uint16, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return inMemoryReader{s}.GetHoldingRegisters(start, quantity)
+}
 
-	if quantity == 0 {
-		return nil, ErrInvalidAddress
-	}
-	startIdx := int(start)
-	endIdx := startIdx + int(quantity)
+// GetInputRegisters implements Store.
+func (s *InMemoryStore) GetInputRegisters(start, quantity uint16) ([]uint16, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return inMemoryReader{s}.GetInputRegisters(start, quantity)
+}
 
-	if startIdx < 0 || startIdx >= len(s.holdingRegisters) || endIdx > len(s.holdingRegisters) {
-		return nil, ErrInvalidAddress
+// GetCoilsInto reads len(dst) coils from start into dst without allocating.
+func (s *InMemoryStore) GetCoilsInto(start uint16, dst []byte) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.covers(TableCoils, start, len(dst)) {
+		return ErrInvalidAddress
 	}
+	_, err := s.coils.read(start, len(dst), dst)
+	return err
+}
 
-	return s.holdingRegisters[startIdx:endIdx], nil
+// GetDiscreteInputsInto reads len(dst) discrete inputs from start into dst
+// without allocating.
+func (s *InMemoryStore) GetDiscreteInputsInto(start uint16, dst []byte) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.covers(TableDiscreteInputs, start, len(dst)) {
+		return ErrInvalidAddress
+	}
+	_, err := s.discreteInputs.read(start, len(dst), dst)
+	return err
 }
 
-// GetInputRegisters implements Store.
-func (s *InMemoryStore) GetInputRegisters(start uint16, quantity uint16) ([]uint16, error) {
-    s.mu.RLock()
-    defer s.mu.RUnlock()
+// GetHoldingRegistersInto reads len(dst) holding registers from start into
+// dst without allocating.
+func (s *InMemoryStore) GetHoldingRegistersInto(start uint16, dst []uint16) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.covers(TableHoldingRegisters, start, len(dst)) {
+		return ErrInvalidAddress
+	}
+	_, err := readRange(s.holdingRegisters, start, len(dst), dst)
+	return err
+}
 
-    if quantity == 0 {
-        return nil, ErrInvalidAddress
-    }
-    startIdx := int(start)
-    endIdx := startIdx + int(quantity)
+// GetInputRegistersInto reads len(dst) input registers from start into dst
+// without allocating.
+func (s *InMemoryStore) GetInputRegistersInto(start uint16, dst []uint16) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.covers(TableInputRegisters, start, len(dst)) {
+		return ErrInvalidAddress
+	}
+	_, err := readRange(s.inputRegisters, start, len(dst), dst)
+	return err
+}
 
-    if startIdx < 0 || startIdx >= len(s.inputRegisters) || endIdx > len(s.inputRegisters) {
-        return nil, ErrInvalidAddress
-    }
+// View calls fn with a consistent snapshot of all four tables. Writes are
+// blocked until fn returns, so fn should only read. Values read through r
+// are copies and stay valid after View returns.
+func (s *InMemoryStore) View(fn func(r Reader) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return fn(inMemoryReader{s})
+}
 
-    return s.inputRegisters[startIdx:endIdx], nil
+// SetCoils implements Store. The table is replaced by a copy of values.
+func (s *InMemoryStore) SetCoils(values []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.coils = bitSetOf(values)
+	return nil
 }
 
-// SetDiscreteInputs implements Store.
+// SetDiscreteInputs implements Store. The table is replaced by a copy of
+// values.
 func (s *InMemoryStore) SetDiscreteInputs(values []byte) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.discreteInputs = values
+	s.discreteInputs = bitSetOf(values)
 	return nil
 }
 
-// SetHoldingRegisters implements Store.
+// SetHoldingRegisters implements Store. The table is replaced by a copy of
+// values.
 func (s *InMemoryStore) SetHoldingRegisters(values []uint16) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.holdingRegisters = values
+	s.holdingRegisters = append([]uint16(nil), values...)
 	return nil
 }
 
-// SetInputRegisters implements Store.
+// SetInputRegisters implements Store. The table is replaced by a copy of
+// values.
 func (s *InMemoryStore) SetInputRegisters(values []uint16) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.inputRegisters = values
+	s.inputRegisters = append([]uint16(nil), values...)
 	return nil
 }
 
+func (s *InMemoryStore) SetCoilsAt(start uint16, values []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.covers(TableCoils, start, len(values)) {
+		return ErrInvalidAddress
+	}
+	return s.coils.write(start, values)
+}
+
+func (s *InMemoryStore) SetDiscreteInputsAt(start uint16, values []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.covers(TableDiscreteInputs, start, len(values)) {
+		return ErrInvalidAddress
+	}
+	return s.discreteInputs.write(start, values)
+}
+
 func (s *InMemoryStore) SetHoldingRegistersAt(start uint16, values []uint16) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if !s.covers(TableHoldingRegisters, start, len(values)) {
+		return ErrInvalidAddress
+	}
+	return writeRange(s.holdingRegisters, start, values)
+}
 
-	if len(values) == 0 {
+func (s *InMemoryStore) SetInputRegistersAt(start uint16, values []uint16) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.covers(TableInputRegisters, start, len(values)) {
 		return ErrInvalidAddress
 	}
+	return writeRange(s.inputRegisters, start, values)
+}
 
-	startIdx := int(start)
-	endIdx := startIdx + len(values)
+// GetBit returns a single coil or discrete input.
+func (s *InMemoryStore) GetBit(table Table, address uint16) (bool, error) {
+	if err := checkBitTable(table); err != nil {
+		return false, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	bits := s.bits(table)
+	if int(address) >= bits.len() || !s.covers(table, address, 1) {
+		return false, ErrInvalidAddress
+	}
+	return bits.get(int(address)), nil
+}
 
-	if startIdx < 0 || startIdx > len(s.holdingRegisters) || endIdx > len(s.holdingRegisters) || endIdx < startIdx {
+// SetBits writes coils or discrete inputs from start.
+func (s *InMemoryStore) SetBits(table Table, start uint16, values []bool) error {
+	if err := checkBitTable(table); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.covers(table, start, len(values)) {
 		return ErrInvalidAddress
 	}
+	return s.bits(table).write(start, bitsToBytes(values))
+}
 
-	copy(s.holdingRegisters[startIdx:endIdx], values)
-	return nil
+func (s *InMemoryStore) bits(table Table) bitSet {
+	if table == TableCoils {
+		return s.coils
+	}
+	return s.discreteInputs
+}
+
+// Update implements Store. The store is locked for the whole of fn, so
+// neither Modbus reads nor other writers see a partial update, and writes
+// are undone if fn fails.
+func (s *InMemoryStore) Update(fn func(tx Transaction) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return runUndoTx(inMemoryReader{s}, s.writeLocked, fn)
 }
 
-func NewInMemoryStore() Store {
-	defaultDiscreteInputsSize := 1000  // 增加默认大小
-	defaultCoilsSize := 1000          // 增加默认大小
-	defaultHoldingRegistersSize := 1000 // 增加默认大小
-	defaultInputRegistersSize := 1000   // 增加默认大小
-	return &InMemoryStore{
-		coils:            make([]byte, defaultCoilsSize),
-		discreteInputs:   make([]byte, defaultDiscreteInputsSize),
-		holdingRegisters: make([]uint16, defaultHoldingRegistersSize),
-		inputRegisters:   make([]uint16, defaultInputRegistersSize),
+// writeLocked writes any table; the caller holds the lock.
+func (s *InMemoryStore) writeLocked(table Table, start uint16, values []uint16) error {
+	if !s.covers(table, start, len(values)) {
+		return ErrInvalidAddress
+	}
+	switch table {
+	case TableCoils:
+		return s.coils.write(start, wordsToBits(values))
+	case TableDiscreteInputs:
+		return s.discreteInputs.write(start, wordsToBits(values))
+	case TableHoldingRegisters:
+		return writeRange(s.holdingRegisters, start, values)
+	case TableInputRegisters:
+		return writeRange(s.inputRegisters, start, values)
 	}
+	return ErrInvalidTable
 }
 
-// The following method implementation is added to make *InMemoryStore implement the Store interface
-// GetDiscreteInputs method implementation
-func (s *InMemoryStore) GetDiscreteInputs(start, quantity uint16) ([]byte, error) {
+// Size implements Store.
+func (s *InMemoryStore) Size(table Table) int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	if quantity == 0 {
+	switch table {
+	case TableCoils:
+		return s.coils.len()
+	case TableDiscreteInputs:
+		return s.discreteInputs.len()
+	case TableHoldingRegisters:
+		return len(s.holdingRegisters)
+	case TableInputRegisters:
+		return len(s.inputRegisters)
+	}
+	return 0
+}
+
+// Windows returns the valid address windows of table, merged and in order,
+// or nil when every address below Size is valid.
+func (s *InMemoryStore) Windows(table Table) []Window {
+	if !validTable(table) {
+		return nil
+	}
+	return append([]Window(nil), s.windows[table]...)
+}
+
+// Close implements Store. The in-memory store holds no resources.
+func (s *InMemoryStore) Close() error {
+	return nil
+}
+
+// covers reports whether quantity addresses from start lie inside the
+// windows of table.
+func (s *InMemoryStore) covers(table Table, start uint16, quantity int) bool {
+	return windowsCover(s.windows[table], start, quantity)
+}
+
+// inMemoryReader reads the tables of a store whose lock is already held.
+type inMemoryReader struct {
+	s *InMemoryStore
+}
+
+func (r inMemoryReader) GetCoils(start, quantity uint16) ([]byte, error) {
+	if !r.s.covers(TableCoils, start, int(quantity)) {
 		return nil, ErrInvalidAddress
 	}
-	startIdx := int(start)
-	endIdx := startIdx + int(quantity)
+	return r.s.coils.read(start, int(quantity), nil)
+}
 
-	if startIdx < 0 || startIdx >= len(s.discreteInputs) || endIdx > len(s.discreteInputs) {
+func (r inMemoryReader) GetDiscreteInputs(start, quantity uint16) ([]byte, error) {
+	if !r.s.covers(TableDiscreteInputs, start, int(quantity)) {
 		return nil, ErrInvalidAddress
 	}
+	return r.s.discreteInputs.read(start, int(quantity), nil)
+}
 
-	return s.discreteInputs[startIdx:endIdx], nil
+func (r inMemoryReader) GetHoldingRegisters(start, quantity uint16) ([]uint16, error) {
+	if !r.s.covers(TableHoldingRegisters, start, int(quantity)) {
+		return nil, ErrInvalidAddress
+	}
+	return readRange(r.s.holdingRegisters, start, int(quantity), nil)
+}
+
+func (r inMemoryReader) GetInputRegisters(start, quantity uint16) ([]uint16, error) {
+	if !r.s.covers(TableInputRegisters, start, int(quantity)) {
+		return nil, ErrInvalidAddress
+	}
+	return readRange(r.s.inputRegisters, start, int(quantity), nil)
 }
-func (s *InMemoryStore) GetCoils(start, quantity uint16) ([]byte, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
 
+// readRange copies quantity values from start into dst, allocating dst when
+// it is nil.
+func readRange(table []uint16, start uint16, quantity int, dst []uint16) ([]uint16, error) {
 	if quantity == 0 {
 		return nil, ErrInvalidAddress
 	}
 	startIdx := int(start)
-	endIdx := startIdx + int(quantity)
+	endIdx := startIdx + quantity
 
-	if startIdx < 0 || startIdx >= len(s.coils) || endIdx > len(s.coils) {
+	if startIdx >= len(table) || endIdx > len(table) {
 		return nil, ErrInvalidAddress
 	}
 
-	return s.coils[startIdx:endIdx], nil
-}
-
-func (s *InMemoryStore) SetCoils(values []byte) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.coils = values
-	return nil
+	if dst == nil {
+		dst = make([]uint16, quantity)
+	}
+	copy(dst, table[startIdx:endIdx])
+	return dst, nil
 }
 
-func (s *InMemoryStore) SetCoilsAt(start uint16, values []byte) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
+// writeRange copies values into table from start. Nothing is written if the
+// range does not fit.
+func writeRange(table []uint16, start uint16, values []uint16) error {
 	if len(values) == 0 {
 		return ErrInvalidAddress
 	}
-
 	startIdx := int(start)
 	endIdx := startIdx + len(values)
 
-	if startIdx < 0 || startIdx > len(s.coils) || endIdx > len(s.coils) || endIdx < startIdx {
+	if startIdx > len(table) || endIdx > len(table) {
 		return ErrInvalidAddress
 	}
 
-	copy(s.coils[startIdx:endIdx], values)
+	copy(table[startIdx:endIdx], values)
 	return nil
 }
 
+func validTable(t Table) bool {
+	return t >= TableCoils && t <= TableInputRegisters
+}
+
 var ErrInvalidAddress = &StoreError{Code: "INVALID_ADDRESS", Message: "Invalid address"}
 
+// ErrInvalidTable is returned by bit accessors used with a register table.
+var ErrInvalidTable = &StoreError{Code: "INVALID_TABLE", Message: "Invalid table"}
+
 type StoreError struct {
 	Code    string
 	Message string
@@ -16,6 +16,7 @@
 package store
 
 import (
+	"sync"
 	"testing"
 )
 
@@ -65,3 +66,263 @@ func TestInMemoryStore_SetGetHoldingRegisters(t *testing.T) {
 	}
 }
 
+func TestInMemoryStore_SetInputRegistersAt(t *testing.T) {
+	store := NewInMemoryStore()
+
+	if err := store.SetInputRegistersAt(10, []uint16{0x0102, 0x0304}); err != nil {
+		t.Fatalf("Failed to set input registers: %v", err)
+	}
+	result, err := store.GetInputRegisters(10, 2)
+	if err != nil {
+		t.Fatalf("Failed to get input registers: %v", err)
+	}
+	if result[0] != 0x0102 || result[1] != 0x0304 {
+		t.Errorf("Input registers mismatch: got %v", result)
+	}
+
+	if err := store.SetInputRegistersAt(uint16(store.Size(TableInputRegisters)-1), []uint16{1, 2}); err != ErrInvalidAddress {
+		t.Errorf("Expected ErrInvalidAddress for write past the end, got %v", err)
+	}
+}
+
+func TestInMemoryStore_SetDiscreteInputsAt(t *testing.T) {
+	store := NewInMemoryStore()
+
+	if err := store.SetDiscreteInputsAt(5, []byte{1, 1}); err != nil {
+		t.Fatalf("Failed to set discrete inputs: %v", err)
+	}
+	result, err := store.GetDiscreteInputs(4, 3)
+	if err != nil {
+		t.Fatalf("Failed to get discrete inputs: %v", err)
+	}
+	if result[0] != 0 || result[1] != 1 || result[2] != 1 {
+		t.Errorf("Discrete inputs mismatch: got %v", result)
+	}
+}
+
+func TestInMemoryStore_Size(t *testing.T) {
+	store := NewInMemoryStore()
+	for _, table := range []Table{TableCoils, TableDiscreteInputs, TableHoldingRegisters, TableInputRegisters} {
+		if got := store.Size(table); got != 1000 {
+			t.Errorf("Size(%s) = %d; want 1000", table, got)
+		}
+	}
+
+	store.SetHoldingRegisters(make([]uint16, 12))
+	if got := store.Size(TableHoldingRegisters); got != 12 {
+		t.Errorf("Size(holding_registers) = %d; want 12", got)
+	}
+	if err := store.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
+
+func TestInMemoryStore_CopySafety(t *testing.T) {
+	store := NewInMemoryStore()
+	input := []uint16{1, 2, 3}
+	store.SetHoldingRegisters(input)
+	input[0] = 99
+
+	result, _ := store.GetHoldingRegisters(0, 3)
+	if result[0] != 1 {
+		t.Fatalf("Store shares memory with the setter's input: got %d", result[0])
+	}
+
+	result[1] = 99
+	again, _ := store.GetHoldingRegisters(0, 3)
+	if again[1] != 2 {
+		t.Fatalf("Store shares memory with a returned slice: got %d", again[1])
+	}
+}
+
+func TestInMemoryStore_GetInto(t *testing.T) {
+	store := NewInMemoryStore().(*InMemoryStore)
+	store.SetHoldingRegistersAt(4, []uint16{10, 20})
+	store.SetCoilsAt(2, []byte{1})
+
+	regs := make([]uint16, 2)
+	if err := store.GetHoldingRegistersInto(4, regs); err != nil {
+		t.Fatalf("GetHoldingRegistersInto() error = %v", err)
+	}
+	if regs[0] != 10 || regs[1] != 20 {
+		t.Errorf("GetHoldingRegistersInto() got %v", regs)
+	}
+
+	coils := make([]byte, 3)
+	if err := store.GetCoilsInto(0, coils); err != nil {
+		t.Fatalf("GetCoilsInto() error = %v", err)
+	}
+	if coils[2] != 1 {
+		t.Errorf("GetCoilsInto() got %v", coils)
+	}
+
+	if err := store.GetInputRegistersInto(999, make([]uint16, 2)); err != ErrInvalidAddress {
+		t.Errorf("Expected ErrInvalidAddress, got %v", err)
+	}
+}
+
+func TestInMemoryStore_ViewConsistent(t *testing.T) {
+	store := NewInMemoryStore().(*InMemoryStore)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+
+	// Writer keeps holding register 0 and input register 0 equal
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := uint16(0); ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			store.mu.Lock()
+			store.holdingRegisters[0] = i
+			store.inputRegisters[0] = i
+			store.mu.Unlock()
+		}
+	}()
+
+	for i := 0; i < 1000; i++ {
+		err := store.View(func(r Reader) error {
+			hr, err := r.GetHoldingRegisters(0, 1)
+			if err != nil {
+				return err
+			}
+			ir, err := r.GetInputRegisters(0, 1)
+			if err != nil {
+				return err
+			}
+			if hr[0] != ir[0] {
+				t.Errorf("View saw torn state: %d != %d", hr[0], ir[0])
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("View() error = %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestInMemoryStore_ConcurrentAccess(t *testing.T) {
+	store := NewInMemoryStore()
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				store.SetHoldingRegistersAt(uint16(w*10), []uint16{uint16(i), uint16(i)})
+				store.SetHoldingRegisters(make([]uint16, 1000))
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				if values, err := store.GetHoldingRegisters(0, 40); err == nil {
+					values[0]++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestInMemoryStore_BitAccess(t *testing.T) {
+	store := NewInMemoryStore().(*InMemoryStore)
+
+	if err := store.SetBits(TableDiscreteInputs, 998, []bool{true, true}); err != nil {
+		t.Fatalf("SetBits() error = %v", err)
+	}
+	if on, err := store.GetBit(TableDiscreteInputs, 999); err != nil || !on {
+		t.Errorf("GetBit(999) = %v, %v; want true", on, err)
+	}
+	if _, err := store.GetBit(TableDiscreteInputs, 1000); err != ErrInvalidAddress {
+		t.Errorf("Expected ErrInvalidAddress, got %v", err)
+	}
+	if err := store.SetBits(TableDiscreteInputs, 999, []bool{true, true}); err != ErrInvalidAddress {
+		t.Errorf("Expected ErrInvalidAddress, got %v", err)
+	}
+	if err := store.SetBits(TableInputRegisters, 0, []bool{true}); err != ErrInvalidTable {
+		t.Errorf("Expected ErrInvalidTable, got %v", err)
+	}
+
+	values, err := store.GetDiscreteInputs(997, 3)
+	if err != nil {
+		t.Fatalf("GetDiscreteInputs() error = %v", err)
+	}
+	if string(values) != string([]byte{0, 1, 1}) {
+		t.Errorf("GetDiscreteInputs() = %v, want [0 1 1]", values)
+	}
+}
+
+func TestInMemoryStore_FullCoilSpace(t *testing.T) {
+	store := &InMemoryStore{}
+	if err := store.SetCoils(make([]byte, MaxSize)); err != nil {
+		t.Fatalf("SetCoils() error = %v", err)
+	}
+	if got := len(store.coils.data); got != 8192 {
+		t.Errorf("Expected 8192 bytes of coil storage, got %d", got)
+	}
+	if err := store.SetCoilsAt(0xFFFF, []byte{1}); err != nil {
+		t.Fatalf("SetCoilsAt() error = %v", err)
+	}
+	if on, _ := store.GetBit(TableCoils, 0xFFFF); !on {
+		t.Error("Expected last coil to be on")
+	}
+}
+
+func TestNewInMemoryStore_Options(t *testing.T) {
+	store := NewInMemoryStore(
+		WithTableSize(TableCoils, 16),
+		WithTableSize(TableInputRegisters, 1<<20),
+		WithWindows(TableHoldingRegisters, Window{Start: 40000, End: 40009}, Window{Start: 40020, End: 40029}),
+	).(*InMemoryStore)
+
+	if got := store.Size(TableCoils); got != 16 {
+		t.Errorf("Size(coils) = %d, want 16", got)
+	}
+	if got := store.Size(TableInputRegisters); got != MaxSize {
+		t.Errorf("Size(input registers) = %d, want %d", got, MaxSize)
+	}
+	if got := store.Size(TableHoldingRegisters); got != 40030 {
+		t.Errorf("Size(holding registers) = %d, want 40030", got)
+	}
+	if got := store.Size(TableDiscreteInputs); got != DefaultTableSize {
+		t.Errorf("Size(discrete inputs) = %d, want %d", got, DefaultTableSize)
+	}
+
+	if err := store.SetHoldingRegistersAt(40005, []uint16{1, 2, 3}); err != nil {
+		t.Fatalf("SetHoldingRegistersAt() error = %v", err)
+	}
+	if _, err := store.GetHoldingRegisters(40000, 10); err != nil {
+		t.Errorf("GetHoldingRegisters() error = %v", err)
+	}
+	if _, err := store.GetHoldingRegisters(40005, 10); err != ErrInvalidAddress {
+		t.Errorf("Expected ErrInvalidAddress for a read into a hole, got %v", err)
+	}
+	if err := store.SetHoldingRegistersAt(40010, []uint16{1}); err != ErrInvalidAddress {
+		t.Errorf("Expected ErrInvalidAddress for a write into a hole, got %v", err)
+	}
+	if err := store.GetHoldingRegistersInto(0, make([]uint16, 1)); err != ErrInvalidAddress {
+		t.Errorf("Expected ErrInvalidAddress below the first window, got %v", err)
+	}
+
+	windows := store.Windows(TableHoldingRegisters)
+	if len(windows) != 2 || windows[1] != (Window{Start: 40020, End: 40029}) {
+		t.Errorf("Windows() = %v", windows)
+	}
+}
+
+func TestNewInMemoryStore_FullAddressSpace(t *testing.T) {
+	store := NewInMemoryStore(WithFullAddressSpace())
+	if err := store.SetHoldingRegistersAt(0xFFFF, []uint16{7}); err != nil {
+		t.Fatalf("SetHoldingRegistersAt() error = %v", err)
+	}
+	values, err := store.GetHoldingRegisters(0xFFFF, 1)
+	if err != nil || values[0] != 7 {
+		t.Errorf("GetHoldingRegisters() = %v, %v; want [7]", values, err)
+	}
+}
@@ -0,0 +1,711 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hootrhino/goodbusserver/protocol"
+)
+
+// ChangeEvent describes a write that changed at least one value. Coil and
+// discrete input values are reported as 0 or 1.
+type ChangeEvent struct {
+	Table     Table
+	Address   uint16
+	OldValues []uint16
+	NewValues []uint16
+	Origin    Origin
+	Time      time.Time
+	// InUnit is set when the change was made through the store of a unit,
+	// see ObservableStore.Unit, and UnitID is then that unit. Changes made
+	// through the ObservableStore itself, which include Modbus requests for
+	// units without a store of their own, leave both unset.
+	InUnit bool
+	UnitID byte
+}
+
+// Filter selects the addresses a subscriber is notified about. End is
+// inclusive.
+type Filter struct {
+	Table Table
+	Start uint16
+	End   uint16
+}
+
+// AllOf returns a filter matching every address of table.
+func AllOf(table Table) Filter {
+	return Filter{Table: table, Start: 0, End: 0xFFFF}
+}
+
+// Range returns a filter matching quantity addresses of table from start.
+func Range(table Table, start, quantity uint16) Filter {
+	end := uint32(start) + uint32(quantity) - 1
+	if quantity == 0 || end > 0xFFFF {
+		end = 0xFFFF
+	}
+	return Filter{Table: table, Start: start, End: uint16(end)}
+}
+
+type subscriber struct {
+	id     uint64
+	filter Filter
+	fn     func(ChangeEvent)
+}
+
+// WriteRequest is passed to write hooks before a write is applied. Coil
+// values are 0 or 1.
+type WriteRequest struct {
+	Table     Table
+	Address   uint16
+	Values    []uint16
+	OldValues []uint16
+	Origin    Origin
+}
+
+// WriteHook validates or transforms a write before the store is mutated. It
+// returns the values to store, which must have the same length as
+// req.Values, or an error to reject the whole write. Return a
+// *protocol.ModbusError to choose the exception sent to the client; any
+// other error is answered with exception 0x03 Illegal Data Value.
+//
+// Hooks run while writes are serialized and must not write to the store.
+type WriteHook func(req WriteRequest) ([]uint16, error)
+
+type writeHook struct {
+	id     uint64
+	filter Filter
+	fn     WriteHook
+}
+
+// RejectedWriteError is returned when a write hook rejects a write.
+type RejectedWriteError struct {
+	Request WriteRequest
+	Err     error
+}
+
+func (e *RejectedWriteError) Error() string {
+	return fmt.Sprintf("write to %s at %d rejected: %v", e.Request.Table, e.Request.Address, e.Err)
+}
+
+func (e *RejectedWriteError) Unwrap() []error {
+	var exception *protocol.ModbusError
+	if errors.As(e.Err, &exception) {
+		return []error{e.Err}
+	}
+	return []error{e.Err, protocol.ErrIllegalDataValue}
+}
+
+// ObservableStore wraps a Store, runs write hooks before every write and
+// notifies subscribers of every value change made through it. Writes made by
+// the server carry the unit ID and client of the request in Origin.
+//
+// When the wrapped store is a UnitStore, the ObservableStore is one too: the
+// store of each unit is wrapped in turn, sharing the subscribers and hooks,
+// so that requests still reach the tables of their unit.
+type ObservableStore struct {
+	Store
+	*observers
+	// unit is the unit this store wraps, when inUnit is set.
+	unit   byte
+	inUnit bool
+}
+
+// observers is the state shared by an ObservableStore and the wrappers of
+// its units.
+type observers struct {
+	writeMu     sync.Mutex
+	subMu       sync.RWMutex
+	subscribers []subscriber
+	hooks       []writeHook
+	nextID      uint64
+
+	// 事件在写锁内入队，按写入顺序投递
+	queueMu   sync.Mutex
+	queued    sync.Cond
+	queue     []ChangeEvent
+	draining  bool
+	enqueued  uint64
+	delivered uint64
+}
+
+var _ UnitStore = (*ObservableStore)(nil)
+
+func NewObservableStore(inner Store) *ObservableStore {
+	o := &observers{}
+	o.queued.L = &o.queueMu
+	return &ObservableStore{Store: inner, observers: o}
+}
+
+// Units implements UnitStore. It is empty unless the wrapped store is a
+// UnitStore.
+func (s *ObservableStore) Units() []byte {
+	if us, ok := s.Store.(UnitStore); ok {
+		return us.Units()
+	}
+	return nil
+}
+
+// Unit implements UnitStore, returning the store of the unit wrapped with
+// the same subscribers and hooks.
+func (s *ObservableStore) Unit(id byte) (Store, bool) {
+	us, ok := s.Store.(UnitStore)
+	if !ok {
+		return nil, false
+	}
+	unit, ok := us.Unit(id)
+	if !ok {
+		return nil, false
+	}
+	return &ObservableStore{Store: unit, observers: s.observers, unit: id, inUnit: true}, true
+}
+
+// Subscribe calls fn for every change matching filter. The event is clipped
+// to the filtered range. Events are delivered one at a time in the order of
+// the writes, after the write has been applied. fn runs on the writing
+// goroutine, or on the goroutine of an earlier write still delivering its
+// events, so it must not block for long. The returned function removes the
+// subscription.
+func (s *ObservableStore) Subscribe(filter Filter, fn func(ChangeEvent)) (unsubscribe func()) {
+	s.subMu.Lock()
+	s.nextID++
+	id := s.nextID
+	s.subscribers = append(s.subscribers, subscriber{id: id, filter: filter, fn: fn})
+	s.subMu.Unlock()
+
+	return func() {
+		s.subMu.Lock()
+		defer s.subMu.Unlock()
+		for i, sub := range s.subscribers {
+			if sub.id == id {
+				s.subscribers = append(s.subscribers[:i:i], s.subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// OnWrite registers a hook run before every write overlapping filter. The
+// hook sees the complete write, so it can check values that belong together
+// such as the two halves of a 32-bit value. Hooks run in registration order,
+// each receiving the values returned by the previous one. The returned
+// function removes the hook.
+func (s *ObservableStore) OnWrite(filter Filter, hook WriteHook) (remove func()) {
+	s.subMu.Lock()
+	s.nextID++
+	id := s.nextID
+	s.hooks = append(s.hooks, writeHook{id: id, filter: filter, fn: hook})
+	s.subMu.Unlock()
+
+	return func() {
+		s.subMu.Lock()
+		defer s.subMu.Unlock()
+		for i, h := range s.hooks {
+			if h.id == id {
+				s.hooks = append(s.hooks[:i:i], s.hooks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Watch delivers changes matching filter on a channel with the given buffer.
+// Delivery to every subscriber waits while the buffer is full. The channel is
+// closed by cancel.
+func (s *ObservableStore) Watch(filter Filter, buffer int) (events <-chan ChangeEvent, cancel func()) {
+	ch := make(chan ChangeEvent, buffer)
+	done := make(chan struct{})
+	var mu sync.Mutex
+	closed := false
+
+	unsubscribe := s.Subscribe(filter, func(ev ChangeEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case ch <- ev:
+		case <-done:
+		}
+	})
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			close(done)
+			unsubscribe()
+			mu.Lock()
+			closed = true
+			close(ch)
+			mu.Unlock()
+		})
+	}
+}
+
+// WithContext returns a view of the store whose writes are attributed to the
+// origin stored in ctx.
+func (s *ObservableStore) WithContext(ctx context.Context) Store {
+	return &boundObservableStore{ObservableStore: s, ctx: ctx}
+}
+
+func (s *ObservableStore) SetCoils(values []byte) error {
+	return s.setCoils(context.Background(), values)
+}
+
+func (s *ObservableStore) SetDiscreteInputs(values []byte) error {
+	return s.setDiscreteInputs(context.Background(), values)
+}
+
+func (s *ObservableStore) SetHoldingRegisters(values []uint16) error {
+	return s.setHoldingRegisters(context.Background(), values)
+}
+
+func (s *ObservableStore) SetInputRegisters(values []uint16) error {
+	return s.setInputRegisters(context.Background(), values)
+}
+
+func (s *ObservableStore) SetCoilsAt(start uint16, values []byte) error {
+	return s.setCoilsAt(context.Background(), start, values)
+}
+
+func (s *ObservableStore) SetDiscreteInputsAt(start uint16, values []byte) error {
+	return s.setDiscreteInputsAt(context.Background(), start, values)
+}
+
+func (s *ObservableStore) SetHoldingRegistersAt(start uint16, values []uint16) error {
+	return s.setHoldingRegistersAt(context.Background(), start, values)
+}
+
+func (s *ObservableStore) SetInputRegistersAt(start uint16, values []uint16) error {
+	return s.setInputRegistersAt(context.Background(), start, values)
+}
+
+// Update implements Store. Write hooks run for every write in the
+// transaction and a rejected write aborts the whole update. Subscribers are
+// notified once the update has been applied.
+func (s *ObservableStore) Update(fn func(tx Transaction) error) error {
+	return s.update(context.Background(), fn)
+}
+
+func (s *ObservableStore) update(ctx context.Context, fn func(tx Transaction) error) error {
+	otx := &observableTx{s: s, origin: OriginFromContext(ctx)}
+
+	s.writeMu.Lock()
+	err := BindContext(s.Store, ctx).Update(func(tx Transaction) error {
+		otx.Transaction = tx
+		otx.events = otx.events[:0]
+		return fn(otx)
+	})
+	if err == nil {
+		now := time.Now()
+		for i := range otx.events {
+			otx.events[i].Time = now
+		}
+		s.enqueue(otx.events...)
+	}
+	s.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.drain()
+	return nil
+}
+
+func (s *ObservableStore) setCoils(ctx context.Context, values []byte) error {
+	inner := BindContext(s.Store, ctx)
+	return s.apply(ctx, TableCoils, 0, bitsToWords(values), func(v []uint16) error {
+		return inner.SetCoils(wordsToBits(v))
+	})
+}
+
+func (s *ObservableStore) setDiscreteInputs(ctx context.Context, values []byte) error {
+	inner := BindContext(s.Store, ctx)
+	return s.apply(ctx, TableDiscreteInputs, 0, bitsToWords(values), func(v []uint16) error {
+		return inner.SetDiscreteInputs(wordsToBits(v))
+	})
+}
+
+func (s *ObservableStore) setHoldingRegisters(ctx context.Context, values []uint16) error {
+	inner := BindContext(s.Store, ctx)
+	return s.apply(ctx, TableHoldingRegisters, 0, values, inner.SetHoldingRegisters)
+}
+
+func (s *ObservableStore) setInputRegisters(ctx context.Context, values []uint16) error {
+	inner := BindContext(s.Store, ctx)
+	return s.apply(ctx, TableInputRegisters, 0, values, inner.SetInputRegisters)
+}
+
+func (s *ObservableStore) setCoilsAt(ctx context.Context, start uint16, values []byte) error {
+	inner := BindContext(s.Store, ctx)
+	return s.apply(ctx, TableCoils, start, bitsToWords(values), func(v []uint16) error {
+		return inner.SetCoilsAt(start, wordsToBits(v))
+	})
+}
+
+func (s *ObservableStore) setDiscreteInputsAt(ctx context.Context, start uint16, values []byte) error {
+	inner := BindContext(s.Store, ctx)
+	return s.apply(ctx, TableDiscreteInputs, start, bitsToWords(values), func(v []uint16) error {
+		return inner.SetDiscreteInputsAt(start, wordsToBits(v))
+	})
+}
+
+func (s *ObservableStore) setHoldingRegistersAt(ctx context.Context, start uint16, values []uint16) error {
+	inner := BindContext(s.Store, ctx)
+	return s.apply(ctx, TableHoldingRegisters, start, values, func(v []uint16) error {
+		return inner.SetHoldingRegistersAt(start, v)
+	})
+}
+
+func (s *ObservableStore) setInputRegistersAt(ctx context.Context, start uint16, values []uint16) error {
+	inner := BindContext(s.Store, ctx)
+	return s.apply(ctx, TableInputRegisters, start, values, func(v []uint16) error {
+		return inner.SetInputRegistersAt(start, v)
+	})
+}
+
+// apply captures the current values, runs the write hooks, performs the
+// write and notifies the subscribers. Writes are serialized so that old
+// values are exact and a rejected write leaves the store untouched.
+func (s *ObservableStore) apply(ctx context.Context, table Table, start uint16, values []uint16, write func([]uint16) error) error {
+	origin := OriginFromContext(ctx)
+
+	s.writeMu.Lock()
+	old := s.read(table, start, len(values))
+	values, err := s.runHooks(WriteRequest{Table: table, Address: start, Values: values, OldValues: old, Origin: origin})
+	if err != nil {
+		s.writeMu.Unlock()
+		return err
+	}
+	if err := write(values); err != nil {
+		s.writeMu.Unlock()
+		return err
+	}
+	s.enqueue(ChangeEvent{
+		Table:     table,
+		Address:   start,
+		OldValues: old,
+		NewValues: append([]uint16(nil), values...),
+		Origin:    origin,
+		Time:      time.Now(),
+		InUnit:    s.inUnit,
+		UnitID:    s.unit,
+	})
+	s.writeMu.Unlock()
+
+	s.drain()
+	return nil
+}
+
+// enqueue queues events for delivery. It is called with writeMu held, so
+// the queue is in write order.
+func (s *ObservableStore) enqueue(events ...ChangeEvent) {
+	s.queueMu.Lock()
+	s.queue = append(s.queue, events...)
+	s.enqueued += uint64(len(events))
+	s.queueMu.Unlock()
+}
+
+// drain delivers the queued events in order, unless another goroutine is
+// already doing so; that one then delivers the events queued here too. A
+// subscriber writing to the store thus has its events delivered after it
+// returns instead of waiting for itself.
+func (s *ObservableStore) drain() {
+	s.queueMu.Lock()
+	if s.draining {
+		s.queueMu.Unlock()
+		return
+	}
+	s.draining = true
+	delivering := false
+	defer func() {
+		v := recover()
+		if delivering {
+			// 订阅者 panic：放弃剩余事件，不能让队列永久卡住
+			s.queueMu.Lock()
+			s.delivered += uint64(len(s.queue)) + 1
+			s.queue = nil
+		}
+		s.draining = false
+		s.queued.Broadcast()
+		s.queueMu.Unlock()
+		if v != nil {
+			panic(v)
+		}
+	}()
+	for len(s.queue) > 0 {
+		ev := s.queue[0]
+		s.queue = s.queue[1:]
+		s.queueMu.Unlock()
+		delivering = true
+		s.notify(ev)
+		delivering = false
+		s.queueMu.Lock()
+		s.delivered++
+		s.queued.Broadcast()
+	}
+}
+
+// Sync waits until the subscribers have received the events of every write
+// that returned before the call, including writes from other goroutines
+// whose events are delivered by an earlier writer. It must not be called
+// from a subscriber.
+func (s *ObservableStore) Sync() {
+	s.drain()
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+	target := s.enqueued
+	for s.delivered < target {
+		s.queued.Wait()
+	}
+}
+
+func (s *ObservableStore) runHooks(req WriteRequest) ([]uint16, error) {
+	s.subMu.RLock()
+	hooks := append([]writeHook(nil), s.hooks...)
+	s.subMu.RUnlock()
+	if len(hooks) == 0 {
+		return req.Values, nil
+	}
+
+	// 钩子可能原地修改切片，不能影响调用方的数据
+	req.Values = append([]uint16(nil), req.Values...)
+	for _, h := range hooks {
+		if !overlaps(req.Table, req.Address, len(req.Values), h.filter) {
+			continue
+		}
+		values, err := h.fn(req)
+		if err != nil {
+			return nil, &RejectedWriteError{Request: req, Err: err}
+		}
+		if len(values) != len(req.Values) {
+			return nil, &RejectedWriteError{Request: req, Err: fmt.Errorf("hook returned %d values for a write of %d: %w", len(values), len(req.Values), protocol.ErrServerDeviceFailure)}
+		}
+		req.Values = values
+	}
+	return req.Values, nil
+}
+
+func overlaps(table Table, start uint16, n int, filter Filter) bool {
+	if table != filter.Table || n == 0 {
+		return false
+	}
+	last := int(start) + n - 1
+	return int(start) <= int(filter.End) && last >= int(filter.Start)
+}
+
+// read returns the current values of a range, with zeros for addresses
+// beyond the end of the table, such as when a write grows the table.
+func (s *ObservableStore) read(table Table, start uint16, n int) []uint16 {
+	values := make([]uint16, n)
+	if size := s.Store.Size(table); int(start)+n > size {
+		n = size - int(start)
+	}
+	if n <= 0 {
+		return values
+	}
+
+	var current []uint16
+	var err error
+	switch table {
+	case TableCoils:
+		var bits []byte
+		bits, err = s.Store.GetCoils(start, uint16(n))
+		current = bitsToWords(bits)
+	case TableDiscreteInputs:
+		var bits []byte
+		bits, err = s.Store.GetDiscreteInputs(start, uint16(n))
+		current = bitsToWords(bits)
+	case TableHoldingRegisters:
+		current, err = s.Store.GetHoldingRegisters(start, uint16(n))
+	case TableInputRegisters:
+		current, err = s.Store.GetInputRegisters(start, uint16(n))
+	}
+	if err == nil {
+		copy(values, current)
+	}
+	return values
+}
+
+func (s *ObservableStore) notify(ev ChangeEvent) {
+	s.subMu.RLock()
+	subs := append([]subscriber(nil), s.subscribers...)
+	s.subMu.RUnlock()
+
+	for _, sub := range subs {
+		if clipped, ok := clip(ev, sub.filter); ok {
+			sub.fn(clipped)
+		}
+	}
+}
+
+// clip restricts ev to the range of filter and reports whether any value in
+// that range changed.
+func clip(ev ChangeEvent, filter Filter) (ChangeEvent, bool) {
+	if ev.Table != filter.Table || len(ev.NewValues) == 0 {
+		return ev, false
+	}
+	first := int(ev.Address)
+	last := first + len(ev.NewValues) - 1
+	if first < int(filter.Start) {
+		first = int(filter.Start)
+	}
+	if last > int(filter.End) {
+		last = int(filter.End)
+	}
+	if first > last {
+		return ev, false
+	}
+
+	lo, hi := first-int(ev.Address), last-int(ev.Address)+1
+	changed := false
+	for i := lo; i < hi; i++ {
+		if ev.OldValues[i] != ev.NewValues[i] {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return ev, false
+	}
+
+	ev.Address = uint16(first)
+	ev.OldValues = ev.OldValues[lo:hi]
+	ev.NewValues = ev.NewValues[lo:hi]
+	return ev, true
+}
+
+// observableTx runs the write hooks for each write of a transaction and
+// collects the change events to deliver once it is applied.
+type observableTx struct {
+	Transaction
+	s      *ObservableStore
+	origin Origin
+	events []ChangeEvent
+}
+
+func (tx *observableTx) SetCoilsAt(start uint16, values []byte) error {
+	return tx.set(TableCoils, start, bitsToWords(values), func(v []uint16) error {
+		return tx.Transaction.SetCoilsAt(start, wordsToBits(v))
+	})
+}
+
+func (tx *observableTx) SetDiscreteInputsAt(start uint16, values []byte) error {
+	return tx.set(TableDiscreteInputs, start, bitsToWords(values), func(v []uint16) error {
+		return tx.Transaction.SetDiscreteInputsAt(start, wordsToBits(v))
+	})
+}
+
+func (tx *observableTx) SetHoldingRegistersAt(start uint16, values []uint16) error {
+	return tx.set(TableHoldingRegisters, start, values, func(v []uint16) error {
+		return tx.Transaction.SetHoldingRegistersAt(start, v)
+	})
+}
+
+func (tx *observableTx) SetInputRegistersAt(start uint16, values []uint16) error {
+	return tx.set(TableInputRegisters, start, values, func(v []uint16) error {
+		return tx.Transaction.SetInputRegistersAt(start, v)
+	})
+}
+
+func (tx *observableTx) set(table Table, start uint16, values []uint16, write func([]uint16) error) error {
+	old, err := readWords(tx.Transaction, table, start, len(values))
+	if err != nil {
+		old = make([]uint16, len(values))
+	}
+	values, err = tx.s.runHooks(WriteRequest{Table: table, Address: start, Values: values, OldValues: old, Origin: tx.origin})
+	if err != nil {
+		return err
+	}
+	if err := write(values); err != nil {
+		return err
+	}
+	tx.events = append(tx.events, ChangeEvent{
+		Table:     table,
+		Address:   start,
+		OldValues: old,
+		NewValues: append([]uint16(nil), values...),
+		Origin:    tx.origin,
+		InUnit:    tx.s.inUnit,
+		UnitID:    tx.s.unit,
+	})
+	return nil
+}
+
+type boundObservableStore struct {
+	*ObservableStore
+	ctx context.Context
+}
+
+func (s *boundObservableStore) Update(fn func(tx Transaction) error) error {
+	return s.update(s.ctx, fn)
+}
+
+func (s *boundObservableStore) SetCoils(values []byte) error {
+	return s.setCoils(s.ctx, values)
+}
+
+func (s *boundObservableStore) SetDiscreteInputs(values []byte) error {
+	return s.setDiscreteInputs(s.ctx, values)
+}
+
+func (s *boundObservableStore) SetHoldingRegisters(values []uint16) error {
+	return s.setHoldingRegisters(s.ctx, values)
+}
+
+func (s *boundObservableStore) SetInputRegisters(values []uint16) error {
+	return s.setInputRegisters(s.ctx, values)
+}
+
+func (s *boundObservableStore) SetCoilsAt(start uint16, values []byte) error {
+	return s.setCoilsAt(s.ctx, start, values)
+}
+
+func (s *boundObservableStore) SetDiscreteInputsAt(start uint16, values []byte) error {
+	return s.setDiscreteInputsAt(s.ctx, start, values)
+}
+
+func (s *boundObservableStore) SetHoldingRegistersAt(start uint16, values []uint16) error {
+	return s.setHoldingRegistersAt(s.ctx, start, values)
+}
+
+func (s *boundObservableStore) SetInputRegistersAt(start uint16, values []uint16) error {
+	return s.setInputRegistersAt(s.ctx, start, values)
+}
+
+func bitsToWords(bits []byte) []uint16 {
+	words := make([]uint16, len(bits))
+	for i, b := range bits {
+		if b != 0 {
+			words[i] = 1
+		}
+	}
+	return words
+}
+
+func wordsToBits(words []uint16) []byte {
+	bits := make([]byte, len(words))
+	for i, w := range words {
+		if w != 0 {
+			bits[i] = 1
+		}
+	}
+	return bits
+}
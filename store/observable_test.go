@@ -0,0 +1,304 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/hootrhino/goodbusserver/protocol"
+)
+
+func TestObservableStore_Subscribe(t *testing.T) {
+	obs := NewObservableStore(NewInMemoryStore())
+	var events []ChangeEvent
+	unsubscribe := obs.Subscribe(Range(TableHoldingRegisters, 10, 5), func(ev ChangeEvent) {
+		events = append(events, ev)
+	})
+
+	if err := obs.SetHoldingRegistersAt(8, []uint16{1, 2, 3, 4}); err != nil {
+		t.Fatalf("SetHoldingRegistersAt() error = %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	ev := events[0]
+	if ev.Table != TableHoldingRegisters || ev.Address != 10 {
+		t.Errorf("unexpected event range: %+v", ev)
+	}
+	if len(ev.NewValues) != 2 || ev.NewValues[0] != 3 || ev.NewValues[1] != 4 || ev.OldValues[0] != 0 {
+		t.Errorf("event not clipped to filter: %+v", ev)
+	}
+	if ev.Origin.Source != SourceApplication {
+		t.Errorf("expected application origin, got %v", ev.Origin.Source)
+	}
+
+	// Writing the same values again is not a change
+	obs.SetHoldingRegistersAt(10, []uint16{3, 4})
+	// Writes outside the filter are not delivered
+	obs.SetHoldingRegistersAt(0, []uint16{9})
+	if len(events) != 1 {
+		t.Fatalf("unexpected events: %+v", events[1:])
+	}
+
+	unsubscribe()
+	obs.SetHoldingRegistersAt(10, []uint16{7})
+	if len(events) != 1 {
+		t.Fatal("event delivered after unsubscribe")
+	}
+}
+
+func TestObservableStore_CoilsAndOrigin(t *testing.T) {
+	obs := NewObservableStore(NewInMemoryStore())
+	var got ChangeEvent
+	obs.Subscribe(AllOf(TableCoils), func(ev ChangeEvent) { got = ev })
+
+	ctx := WithOrigin(context.Background(), Origin{Source: SourceModbus, UnitID: 5, Client: "10.0.0.1:50200"})
+	if err := BindContext(obs, ctx).SetCoilsAt(3, []byte{1, 0, 1}); err != nil {
+		t.Fatalf("SetCoilsAt() error = %v", err)
+	}
+	if got.Origin.UnitID != 5 || got.Origin.Client != "10.0.0.1:50200" || got.Origin.Source != SourceModbus {
+		t.Errorf("unexpected origin: %+v", got.Origin)
+	}
+	if got.Address != 3 || len(got.NewValues) != 3 || got.NewValues[0] != 1 || got.NewValues[2] != 1 {
+		t.Errorf("unexpected event: %+v", got)
+	}
+}
+
+func TestObservableStore_Watch(t *testing.T) {
+	obs := NewObservableStore(NewInMemoryStore())
+	events, cancel := obs.Watch(AllOf(TableHoldingRegisters), 1)
+
+	obs.SetHoldingRegistersAt(1, []uint16{42})
+	ev := <-events
+	if ev.Address != 1 || ev.NewValues[0] != 42 {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Fatal("expected channel to be closed after cancel")
+	}
+	// Writes after cancel must not block or panic
+	obs.SetHoldingRegistersAt(1, []uint16{43})
+	cancel()
+}
+
+func TestObservableStore_OnWriteTransform(t *testing.T) {
+	obs := NewObservableStore(NewInMemoryStore())
+	obs.OnWrite(Range(TableHoldingRegisters, 0, 1), func(req WriteRequest) ([]uint16, error) {
+		values := req.Values
+		// Clamp the setpoint at address 0 to 500
+		if req.Address == 0 && values[0] > 500 {
+			values[0] = 500
+		}
+		return values, nil
+	})
+
+	input := []uint16{900, 900}
+	if err := obs.SetHoldingRegistersAt(0, input); err != nil {
+		t.Fatalf("SetHoldingRegistersAt() error = %v", err)
+	}
+	values, _ := obs.GetHoldingRegisters(0, 2)
+	if values[0] != 500 || values[1] != 900 {
+		t.Errorf("unexpected stored values: %v", values)
+	}
+	if input[0] != 900 {
+		t.Errorf("hook modified the caller's slice: %v", input)
+	}
+}
+
+func TestObservableStore_OnWriteVeto(t *testing.T) {
+	obs := NewObservableStore(NewInMemoryStore())
+	notified := false
+	obs.Subscribe(AllOf(TableHoldingRegisters), func(ev ChangeEvent) { notified = true })
+	remove := obs.OnWrite(Range(TableHoldingRegisters, 11, 1), func(req WriteRequest) ([]uint16, error) {
+		if req.Origin.Source == SourceModbus {
+			return nil, protocol.ErrIllegalDataAddress
+		}
+		return req.Values, nil
+	})
+	obs.OnWrite(Range(TableCoils, 0, 1), func(req WriteRequest) ([]uint16, error) {
+		return nil, errors.New("interlock active")
+	})
+
+	ctx := WithOrigin(context.Background(), Origin{Source: SourceModbus})
+	err := BindContext(obs, ctx).SetHoldingRegistersAt(10, []uint16{1, 2, 3})
+	var rejected *RejectedWriteError
+	if !errors.As(err, &rejected) || !errors.Is(err, protocol.ErrIllegalDataAddress) {
+		t.Fatalf("expected rejection with ErrIllegalDataAddress, got %v", err)
+	}
+	values, _ := obs.GetHoldingRegisters(10, 3)
+	if values[0] != 0 || values[1] != 0 || values[2] != 0 {
+		t.Errorf("rejected write partially applied: %v", values)
+	}
+	if notified {
+		t.Error("rejected write notified subscribers")
+	}
+
+	// Application writes pass this hook
+	if err := obs.SetHoldingRegistersAt(10, []uint16{1, 2, 3}); err != nil {
+		t.Fatalf("application write rejected: %v", err)
+	}
+
+	// Plain errors are answered with Illegal Data Value
+	if err := obs.SetCoilsAt(0, []byte{1}); !errors.Is(err, protocol.ErrIllegalDataValue) {
+		t.Fatalf("expected ErrIllegalDataValue, got %v", err)
+	}
+
+	remove()
+	if err := BindContext(obs, ctx).SetHoldingRegistersAt(11, []uint16{4}); err != nil {
+		t.Fatalf("write rejected after hook removal: %v", err)
+	}
+}
+
+func TestObservableStore_Update(t *testing.T) {
+	obs := NewObservableStore(NewInMemoryStore())
+	var events []ChangeEvent
+	obs.Subscribe(AllOf(TableHoldingRegisters), func(ev ChangeEvent) { events = append(events, ev) })
+	obs.OnWrite(Range(TableHoldingRegisters, 100, 1), func(req WriteRequest) ([]uint16, error) {
+		if req.Values[0] > 50 {
+			return nil, errors.New("out of range")
+		}
+		return req.Values, nil
+	})
+
+	err := obs.Update(func(tx Transaction) error {
+		if err := tx.SetHoldingRegistersAt(0, []uint16{1}); err != nil {
+			return err
+		}
+		return tx.SetHoldingRegistersAt(100, []uint16{99})
+	})
+	if err == nil {
+		t.Fatal("Expected the hook to abort the update")
+	}
+	if values, _ := obs.GetHoldingRegisters(0, 1); values[0] != 0 {
+		t.Errorf("Aborted update was applied: %v", values)
+	}
+	if len(events) != 0 {
+		t.Errorf("Aborted update notified %d events", len(events))
+	}
+
+	err = obs.Update(func(tx Transaction) error {
+		if err := tx.SetHoldingRegistersAt(0, []uint16{1}); err != nil {
+			return err
+		}
+		return tx.SetHoldingRegistersAt(100, []uint16{20})
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if len(events) != 2 || events[1].Address != 100 || events[1].NewValues[0] != 20 {
+		t.Errorf("Unexpected events: %+v", events)
+	}
+}
+
+func TestObservableStore_Units(t *testing.T) {
+	def, unit := NewInMemoryStore(), NewInMemoryStore()
+	units := NewUnitMap(def)
+	units.Set(9, unit)
+	obs := NewObservableStore(units)
+
+	var events []ChangeEvent
+	obs.Subscribe(AllOf(TableHoldingRegisters), func(ev ChangeEvent) { events = append(events, ev) })
+	obs.OnWrite(AllOf(TableHoldingRegisters), func(req WriteRequest) ([]uint16, error) {
+		return []uint16{req.Values[0] + 1}, nil
+	})
+
+	if ids := obs.Units(); len(ids) != 1 || ids[0] != 9 {
+		t.Fatalf("Units() = %v, want [9]", ids)
+	}
+	ctx := WithOrigin(context.Background(), Origin{Source: SourceModbus, UnitID: 9})
+	if err := BindContext(StoreForUnit(obs, 9), ctx).SetHoldingRegistersAt(1, []uint16{41}); err != nil {
+		t.Fatal(err)
+	}
+	if values, _ := unit.GetHoldingRegisters(1, 1); values[0] != 42 {
+		t.Errorf("unit 9 store = %v, want [42]", values)
+	}
+	if values, _ := def.GetHoldingRegisters(1, 1); values[0] != 0 {
+		t.Errorf("default store = %v, want [0]", values)
+	}
+	if len(events) != 1 || events[0].Origin.UnitID != 9 || !events[0].InUnit || events[0].UnitID != 9 || events[0].NewValues[0] != 42 {
+		t.Errorf("events = %+v", events)
+	}
+
+	if StoreForUnit(obs, 3) != Store(obs) {
+		t.Error("unit without a store not sent to the default store")
+	}
+	if _, ok := NewObservableStore(def).Unit(9); ok {
+		t.Error("Unit found on a single-unit store")
+	}
+}
+
+func TestObservableStore_DeliversInWriteOrder(t *testing.T) {
+	obs := NewObservableStore(NewInMemoryStore())
+	var events []ChangeEvent
+	obs.Subscribe(Range(TableHoldingRegisters, 0, 1), func(ev ChangeEvent) { events = append(events, ev) })
+
+	const writers, writes = 8, 200
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				// 每次写入的值都不同，保证每次都产生事件
+				value := uint16(1 + w*writes + i)
+				if i%2 == 0 {
+					obs.SetHoldingRegistersAt(0, []uint16{value})
+				} else {
+					obs.Update(func(tx Transaction) error { return tx.SetHoldingRegistersAt(0, []uint16{value}) })
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	obs.Sync()
+
+	if len(events) != writers*writes {
+		t.Fatalf("got %d events, want %d", len(events), writers*writes)
+	}
+	for i := 1; i < len(events); i++ {
+		prev, ev := events[i-1], events[i]
+		if ev.OldValues[0] != prev.NewValues[0] {
+			t.Fatalf("event %d changes %d, but the previous event left %d", i, ev.OldValues[0], prev.NewValues[0])
+		}
+		if ev.Time.Before(prev.Time) {
+			t.Fatalf("event %d at %v is older than the previous one at %v", i, ev.Time, prev.Time)
+		}
+	}
+	if values, _ := obs.GetHoldingRegisters(0, 1); values[0] != events[len(events)-1].NewValues[0] {
+		t.Errorf("store holds %d, last event %d", values[0], events[len(events)-1].NewValues[0])
+	}
+}
+
+func TestObservableStore_SubscriberWrites(t *testing.T) {
+	obs := NewObservableStore(NewInMemoryStore())
+	// A subscriber mirroring register 0 to 1 writes from inside delivery.
+	obs.Subscribe(Range(TableHoldingRegisters, 0, 1), func(ev ChangeEvent) {
+		obs.SetHoldingRegistersAt(1, ev.NewValues)
+	})
+	var mirrored []uint16
+	obs.Subscribe(Range(TableHoldingRegisters, 1, 1), func(ev ChangeEvent) { mirrored = append(mirrored, ev.NewValues[0]) })
+
+	obs.SetHoldingRegistersAt(0, []uint16{5})
+	obs.SetHoldingRegistersAt(0, []uint16{6})
+	if len(mirrored) != 2 || mirrored[0] != 5 || mirrored[1] != 6 {
+		t.Errorf("mirrored = %v, want [5 6] once the writes return", mirrored)
+	}
+}
@@ -0,0 +1,388 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Region is a run of defined addresses in one table of a SparseStore.
+type Region struct {
+	Table Table  `json:"table"`
+	Start uint16 `json:"start"`
+	// Length is the number of addresses in the region. When zero the region
+	// covers len(Values) addresses.
+	Length int `json:"length,omitempty"`
+	// Values holds the initial values, one per address; for coils and
+	// discrete inputs non-zero means on. Missing values start at zero.
+	Values []uint16 `json:"values,omitempty"`
+	Access Access   `json:"access"`
+}
+
+// End returns the last address of the region.
+func (r Region) End() uint16 {
+	return uint16(int(r.Start) + r.length() - 1)
+}
+
+func (r Region) length() int {
+	if r.Length > 0 {
+		return r.Length
+	}
+	return len(r.Values)
+}
+
+// ErrRegionOverlap is returned when a region overlaps one already defined.
+var ErrRegionOverlap = &StoreError{Code: "REGION_OVERLAP", Message: "Region overlaps an existing region"}
+
+// SparseStore holds only the address regions that are defined, kept in
+// address order per table, so a device with a few registers scattered over
+// the 16-bit space costs only those registers. Any access that touches an
+// undefined address fails with ErrInvalidAddress, which the handlers answer
+// with exception 0x02. Adjacent regions can be read and written as one
+// range.
+type SparseStore struct {
+	tables [4][]*sparseRegion
+	mu     sync.RWMutex
+}
+
+var _ AccessChecker = (*SparseStore)(nil)
+
+type sparseRegion struct {
+	start  uint16
+	values []uint16
+	access Access
+}
+
+func (r *sparseRegion) end() int {
+	return int(r.start) + len(r.values) - 1
+}
+
+// NewSparseStore returns a store with the given regions defined.
+func NewSparseStore(regions ...Region) (*SparseStore, error) {
+	s := &SparseStore{}
+	for _, r := range regions {
+		if err := s.Define(r); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Define adds a region. It fails with ErrRegionOverlap if any of its
+// addresses is already defined.
+func (s *SparseStore) Define(r Region) error {
+	if !validTable(r.Table) {
+		return ErrInvalidTable
+	}
+	n := r.length()
+	if n == 0 || len(r.Values) > n || int(r.Start)+n > MaxSize {
+		return fmt.Errorf("region %s %d+%d: %w", r.Table, r.Start, n, ErrInvalidAddress)
+	}
+
+	values := make([]uint16, n)
+	copy(values, r.Values)
+	if r.Table == TableCoils || r.Table == TableDiscreteInputs {
+		for i, v := range values {
+			values[i] = min(v, 1)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	regions := s.tables[r.Table]
+	i := sort.Search(len(regions), func(i int) bool { return regions[i].start >= r.Start })
+	if i > 0 && regions[i-1].end() >= int(r.Start) {
+		return ErrRegionOverlap
+	}
+	if i < len(regions) && int(regions[i].start) <= int(r.Start)+n-1 {
+		return ErrRegionOverlap
+	}
+
+	region := &sparseRegion{start: r.Start, values: values, access: r.Access}
+	s.tables[r.Table] = append(regions[:i], append([]*sparseRegion{region}, regions[i:]...)...)
+	return nil
+}
+
+// Regions returns the defined regions of table in address order, with their
+// current values.
+func (s *SparseStore) Regions(table Table) []Region {
+	if !validTable(table) {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	regions := make([]Region, 0, len(s.tables[table]))
+	for _, r := range s.tables[table] {
+		regions = append(regions, Region{
+			Table:  table,
+			Start:  r.start,
+			Length: len(r.values),
+			Values: append([]uint16(nil), r.values...),
+			Access: r.access,
+		})
+	}
+	return regions
+}
+
+// Windows returns the defined addresses of table as merged windows.
+func (s *SparseStore) Windows(table Table) []Window {
+	if !validTable(table) {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	windows := make([]Window, 0, len(s.tables[table]))
+	for _, r := range s.tables[table] {
+		windows = append(windows, Window{Start: r.start, End: uint16(r.end())})
+	}
+	return mergeWindows(windows)
+}
+
+// AccessAt returns the access mode of an address, and false if the address
+// is not defined.
+func (s *SparseStore) AccessAt(table Table, address uint16) (Access, bool) {
+	if !validTable(table) {
+		return AccessReadWrite, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	regions := s.tables[table]
+	i := sort.Search(len(regions), func(i int) bool { return regions[i].end() >= int(address) })
+	if i == len(regions) || regions[i].start > address {
+		return AccessReadWrite, false
+	}
+	return regions[i].access, true
+}
+
+// Access implements AccessChecker with the modes of the regions a range
+// touches. The same regions apply to every unit; undefined addresses do not
+// restrict access, since the store rejects them anyway.
+func (s *SparseStore) Access(unitID byte, table Table, start uint16, quantity int) Access {
+	access := AccessReadWrite
+	if !validTable(table) || quantity <= 0 {
+		return access
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	regions := s.tables[table]
+	last := int(start) + quantity - 1
+	i := sort.Search(len(regions), func(i int) bool { return regions[i].end() >= int(start) })
+	for ; i < len(regions) && int(regions[i].start) <= last; i++ {
+		access = access.Intersect(regions[i].access)
+	}
+	return access
+}
+
+// GetCoils implements Store.
+func (s *SparseStore) GetCoils(start, quantity uint16) ([]byte, error) {
+	values, err := s.read(TableCoils, start, int(quantity))
+	if err != nil {
+		return nil, err
+	}
+	return wordsToBits(values), nil
+}
+
+// GetDiscreteInputs implements Store.
+func (s *SparseStore) GetDiscreteInputs(start, quantity uint16) ([]byte, error) {
+	values, err := s.read(TableDiscreteInputs, start, int(quantity))
+	if err != nil {
+		return nil, err
+	}
+	return wordsToBits(values), nil
+}
+
+// GetHoldingRegisters implements Store.
+func (s *SparseStore) GetHoldingRegisters(start, quantity uint16) ([]uint16, error) {
+	return s.read(TableHoldingRegisters, start, int(quantity))
+}
+
+// GetInputRegisters implements Store.
+func (s *SparseStore) GetInputRegisters(start, quantity uint16) ([]uint16, error) {
+	return s.read(TableInputRegisters, start, int(quantity))
+}
+
+// SetCoils implements Store. Regions are fixed, so values are written from
+// address 0 like SetCoilsAt.
+func (s *SparseStore) SetCoils(values []byte) error {
+	return s.SetCoilsAt(0, values)
+}
+
+// SetDiscreteInputs implements Store. Values are written from address 0.
+func (s *SparseStore) SetDiscreteInputs(values []byte) error {
+	return s.SetDiscreteInputsAt(0, values)
+}
+
+// SetHoldingRegisters implements Store. Values are written from address 0.
+func (s *SparseStore) SetHoldingRegisters(values []uint16) error {
+	return s.SetHoldingRegistersAt(0, values)
+}
+
+// SetInputRegisters implements Store. Values are written from address 0.
+func (s *SparseStore) SetInputRegisters(values []uint16) error {
+	return s.SetInputRegistersAt(0, values)
+}
+
+func (s *SparseStore) SetCoilsAt(start uint16, values []byte) error {
+	return s.write(TableCoils, start, bitsToWords(values))
+}
+
+func (s *SparseStore) SetDiscreteInputsAt(start uint16, values []byte) error {
+	return s.write(TableDiscreteInputs, start, bitsToWords(values))
+}
+
+func (s *SparseStore) SetHoldingRegistersAt(start uint16, values []uint16) error {
+	return s.write(TableHoldingRegisters, start, values)
+}
+
+func (s *SparseStore) SetInputRegistersAt(start uint16, values []uint16) error {
+	return s.write(TableInputRegisters, start, values)
+}
+
+// View calls fn with a consistent snapshot of all four tables. Writes are
+// blocked until fn returns.
+func (s *SparseStore) View(fn func(r Reader) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return fn(sparseReader{s})
+}
+
+// Update implements Store. The store is locked for the whole of fn and
+// writes are undone if fn fails.
+func (s *SparseStore) Update(fn func(tx Transaction) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return runUndoTx(sparseReader{s}, s.writeLocked, fn)
+}
+
+// Size implements Store. It returns one past the last defined address, so
+// addresses below it may still be undefined.
+func (s *SparseStore) Size(table Table) int {
+	if !validTable(table) {
+		return 0
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	regions := s.tables[table]
+	if len(regions) == 0 {
+		return 0
+	}
+	return regions[len(regions)-1].end() + 1
+}
+
+// Close implements Store.
+func (s *SparseStore) Close() error {
+	return nil
+}
+
+func (s *SparseStore) read(table Table, start uint16, quantity int) ([]uint16, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.readLocked(table, start, quantity)
+}
+
+func (s *SparseStore) readLocked(table Table, start uint16, quantity int) ([]uint16, error) {
+	values := make([]uint16, 0, quantity)
+	err := s.span(table, start, quantity, func(r *sparseRegion, from, to int) {
+		values = append(values, r.values[from:to]...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func (s *SparseStore) write(table Table, start uint16, values []uint16) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writeLocked(table, start, values)
+}
+
+func (s *SparseStore) writeLocked(table Table, start uint16, values []uint16) error {
+	if !validTable(table) {
+		return ErrInvalidTable
+	}
+	written := 0
+	return s.span(table, start, len(values), func(r *sparseRegion, from, to int) {
+		written += copy(r.values[from:to], values[written:])
+	})
+}
+
+// span checks that quantity addresses from start are all defined, then calls
+// fn for each region in the range with the slice bounds inside that region.
+// fn is not called when the check fails.
+func (s *SparseStore) span(table Table, start uint16, quantity int, fn func(r *sparseRegion, from, to int)) error {
+	if quantity <= 0 || int(start)+quantity > MaxSize {
+		return ErrInvalidAddress
+	}
+	regions := s.tables[table]
+	first := sort.Search(len(regions), func(i int) bool { return regions[i].end() >= int(start) })
+	last := int(start) + quantity - 1
+
+	i, addr := first, int(start)
+	for addr <= last {
+		if i == len(regions) || int(regions[i].start) > addr {
+			return ErrInvalidAddress
+		}
+		addr = regions[i].end() + 1
+		i++
+	}
+
+	addr = int(start)
+	for _, r := range regions[first:i] {
+		from := addr - int(r.start)
+		to := min(r.end(), last) - int(r.start) + 1
+		fn(r, from, to)
+		addr = int(r.start) + to
+	}
+	return nil
+}
+
+// sparseReader reads the tables of a store whose lock is already held.
+type sparseReader struct {
+	s *SparseStore
+}
+
+func (r sparseReader) GetCoils(start, quantity uint16) ([]byte, error) {
+	values, err := r.s.readLocked(TableCoils, start, int(quantity))
+	if err != nil {
+		return nil, err
+	}
+	return wordsToBits(values), nil
+}
+
+func (r sparseReader) GetDiscreteInputs(start, quantity uint16) ([]byte, error) {
+	values, err := r.s.readLocked(TableDiscreteInputs, start, int(quantity))
+	if err != nil {
+		return nil, err
+	}
+	return wordsToBits(values), nil
+}
+
+func (r sparseReader) GetHoldingRegisters(start, quantity uint16) ([]uint16, error) {
+	return r.s.readLocked(TableHoldingRegisters, start, int(quantity))
+}
+
+func (r sparseReader) GetInputRegisters(start, quantity uint16) ([]uint16, error) {
+	return r.s.readLocked(TableInputRegisters, start, int(quantity))
+}
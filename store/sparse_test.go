@@ -0,0 +1,172 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newTestSparseStore(t *testing.T) *SparseStore {
+	t.Helper()
+	s, err := NewSparseStore(
+		Region{Table: TableHoldingRegisters, Start: 40000, Values: []uint16{1, 2, 3, 4}},
+		Region{Table: TableHoldingRegisters, Start: 40004, Length: 2, Access: AccessReadOnly},
+		Region{Table: TableHoldingRegisters, Start: 40100, Values: []uint16{9}, Access: AccessWriteOnly},
+		Region{Table: TableCoils, Start: 10, Values: []uint16{1, 0, 5}},
+	)
+	if err != nil {
+		t.Fatalf("NewSparseStore() error = %v", err)
+	}
+	return s
+}
+
+func TestSparseStore_ReadWrite(t *testing.T) {
+	s := newTestSparseStore(t)
+
+	values, err := s.GetHoldingRegisters(40002, 4)
+	if err != nil {
+		t.Fatalf("GetHoldingRegisters() error = %v", err)
+	}
+	if !reflect.DeepEqual(values, []uint16{3, 4, 0, 0}) {
+		t.Errorf("GetHoldingRegisters() = %v, want [3 4 0 0]", values)
+	}
+
+	if err := s.SetHoldingRegistersAt(40003, []uint16{7, 8}); err != nil {
+		t.Fatalf("SetHoldingRegistersAt() error = %v", err)
+	}
+	values, _ = s.GetHoldingRegisters(40000, 6)
+	if !reflect.DeepEqual(values, []uint16{1, 2, 3, 7, 8, 0}) {
+		t.Errorf("GetHoldingRegisters() = %v, want [1 2 3 7 8 0]", values)
+	}
+
+	coils, err := s.GetCoils(10, 3)
+	if err != nil {
+		t.Fatalf("GetCoils() error = %v", err)
+	}
+	if !reflect.DeepEqual(coils, []byte{1, 0, 1}) {
+		t.Errorf("GetCoils() = %v, want [1 0 1]", coils)
+	}
+}
+
+func TestSparseStore_RejectsUndefined(t *testing.T) {
+	s := newTestSparseStore(t)
+
+	if _, err := s.GetHoldingRegisters(40004, 3); err != ErrInvalidAddress {
+		t.Errorf("Expected ErrInvalidAddress for a read past a region, got %v", err)
+	}
+	if _, err := s.GetHoldingRegisters(39999, 2); err != ErrInvalidAddress {
+		t.Errorf("Expected ErrInvalidAddress for a read before a region, got %v", err)
+	}
+	if _, err := s.GetInputRegisters(0, 1); err != ErrInvalidAddress {
+		t.Errorf("Expected ErrInvalidAddress for an empty table, got %v", err)
+	}
+	if err := s.SetHoldingRegistersAt(40005, []uint16{1, 2}); err != ErrInvalidAddress {
+		t.Errorf("Expected ErrInvalidAddress for a write past a region, got %v", err)
+	}
+	if values, _ := s.GetHoldingRegisters(40005, 1); values[0] != 0 {
+		t.Errorf("Rejected write must not change values, got %v", values)
+	}
+}
+
+func TestSparseStore_Define(t *testing.T) {
+	s := newTestSparseStore(t)
+
+	if err := s.Define(Region{Table: TableHoldingRegisters, Start: 40005, Length: 10}); err != ErrRegionOverlap {
+		t.Errorf("Expected ErrRegionOverlap, got %v", err)
+	}
+	if err := s.Define(Region{Table: TableHoldingRegisters, Start: 39990, Length: 11}); err != ErrRegionOverlap {
+		t.Errorf("Expected ErrRegionOverlap, got %v", err)
+	}
+	if err := s.Define(Region{Table: TableHoldingRegisters, Start: 39990, Length: 10}); err != nil {
+		t.Errorf("Define() error = %v", err)
+	}
+
+	windows := s.Windows(TableHoldingRegisters)
+	expected := []Window{{Start: 39990, End: 40005}, {Start: 40100, End: 40100}}
+	if !reflect.DeepEqual(windows, expected) {
+		t.Errorf("Windows() = %v, want %v", windows, expected)
+	}
+	if got := s.Size(TableHoldingRegisters); got != 40101 {
+		t.Errorf("Size() = %d, want 40101", got)
+	}
+
+	if access, ok := s.AccessAt(TableHoldingRegisters, 40005); !ok || access != AccessReadOnly {
+		t.Errorf("AccessAt(40005) = %v, %v; want read-only", access, ok)
+	}
+	if _, ok := s.AccessAt(TableHoldingRegisters, 40006); ok {
+		t.Error("Expected AccessAt to report an undefined address")
+	}
+	if regions := s.Regions(TableHoldingRegisters); len(regions) != 4 || regions[3].Access != AccessWriteOnly {
+		t.Errorf("Regions() = %v", regions)
+	}
+}
+
+func TestAccess(t *testing.T) {
+	if !AccessReadWrite.CanRead() || !AccessReadWrite.CanWrite() {
+		t.Error("read-write must allow reads and writes")
+	}
+	if !AccessReadOnly.CanRead() || AccessReadOnly.CanWrite() {
+		t.Error("read-only must allow only reads")
+	}
+	if AccessWriteOnly.CanRead() || !AccessWriteOnly.CanWrite() {
+		t.Error("write-only must allow only writes")
+	}
+	if got := AccessWriteOnly.String(); got != "write-only" {
+		t.Errorf("String() = %q, want write-only", got)
+	}
+
+	var parsed Access
+	if err := parsed.UnmarshalText([]byte("read-only")); err != nil || parsed != AccessReadOnly {
+		t.Errorf("UnmarshalText(read-only) = %v, %v", parsed, err)
+	}
+	if _, err := ParseAccess("rw"); err == nil {
+		t.Error("ParseAccess(rw) succeeded")
+	}
+}
+
+func TestAccessMap(t *testing.T) {
+	m := NewAccessMap(
+		AccessRule{Table: TableHoldingRegisters, Window: Window{Start: 10, End: 19}, Access: AccessReadOnly},
+		AccessRule{Units: []byte{2}, Table: TableHoldingRegisters, Window: Window{Start: 15, End: 25}, Access: AccessWriteOnly},
+	)
+
+	tests := []struct {
+		unit     byte
+		start    uint16
+		quantity int
+		want     Access
+	}{
+		{1, 0, 10, AccessReadWrite},
+		{1, 5, 10, AccessReadOnly},
+		{1, 20, 5, AccessReadWrite},
+		{2, 20, 5, AccessWriteOnly},
+		{2, 18, 4, AccessNone},
+	}
+	for _, tt := range tests {
+		if got := m.Access(tt.unit, TableHoldingRegisters, tt.start, tt.quantity); got != tt.want {
+			t.Errorf("Access(%d, %d, %d) = %v, want %v", tt.unit, tt.start, tt.quantity, got, tt.want)
+		}
+	}
+	if got := m.Access(1, TableInputRegisters, 10, 1); got != AccessReadWrite {
+		t.Errorf("Access() on another table = %v, want read-write", got)
+	}
+
+	s := newTestSparseStore(t)
+	if got := s.Access(0, TableHoldingRegisters, 40002, 4); got != AccessReadOnly {
+		t.Errorf("SparseStore.Access() = %v, want read-only", got)
+	}
+}
@@ -1,316 +1,614 @@
 package store
 
 import (
+	"context"
 	"database/sql"
-	_ "github.com/mattn/go-sqlite3"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-sqlite3"
 )
 
+// sqliteDriver sets per-connection options on every connection it opens.
+const sqliteDriver = "sqlite3_mbserver"
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			_, err := conn.Exec("PRAGMA busy_timeout = 5000; PRAGMA synchronous = NORMAL;", nil)
+			return err
+		},
+	})
+}
+
+// defaultUnitID is the unit_id of the tables of the store itself, outside
+// the range of Modbus unit IDs.
+const defaultUnitID = -1
+
+// upsertBatch is the largest number of rows written by one INSERT
+// statement. Writes are split into power-of-two batches so that a fixed set
+// of statements, prepared when the store opens, covers every write.
+const upsertBatch = 256
+
+// SqliteStore keeps the four tables in SQLite: registers one row per
+// address and coils and discrete inputs packed eight per row. Every row
+// carries a unit ID, so one database holds the tables of several units, see
+// AddUnit. The database runs in WAL mode and statements are prepared once
+// and reused.
 type SqliteStore struct {
-	db *sql.DB
+	db   *sqliteDB
+	ctx  context.Context
+	unit int
+}
+
+// sqliteDB is shared by a store and all its views.
+type sqliteDB struct {
+	*sql.DB
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+	units map[byte]bool
 }
 
+var (
+	_ ContextStore = (*SqliteStore)(nil)
+	_ UnitStore    = (*SqliteStore)(nil)
+)
+
 func NewSqliteStore(dsn string) (*SqliteStore, error) {
-	db, err := sql.Open("sqlite3", dsn)
+	db, err := sql.Open(sqliteDriver, dsn)
 	if err != nil {
 		return nil, err
 	}
-
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS coils (
-			address INTEGER PRIMARY KEY,
-			value INTEGER
-		);
-		CREATE TABLE IF NOT EXISTS discrete_inputs (
-			address INTEGER PRIMARY KEY,
-			value INTEGER
-		);
-		CREATE TABLE IF NOT EXISTS holding_registers (
-			address INTEGER PRIMARY KEY,
-			value INTEGER
-		);
-		CREATE TABLE IF NOT EXISTS input_registers (
-			address INTEGER PRIMARY KEY,
-			value INTEGER
-		);
-	`)
-	if err != nil {
+	if isMemoryDSN(dsn) {
+		// 每个连接都会打开独立的内存数据库
+		db.SetMaxOpenConns(1)
+	} else if _, err := db.Exec("PRAGMA journal_mode = WAL"); err != nil {
+		db.Close()
 		return nil, err
 	}
 
-	return &SqliteStore{db: db}, nil
-}
-
-func (s *SqliteStore) GetCoils(start, quantity uint16) ([]byte, error) {
-	if quantity == 0 {
-		return []byte{}, nil
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
 	}
-	
-	rows, err := s.db.Query("SELECT value FROM coils WHERE address BETWEEN ? AND ? ORDER BY address", start, start+quantity-1)
+
+	units := make(map[byte]bool)
+	rows, err := db.Query("SELECT unit_id FROM units")
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
 	defer rows.Close()
-
-	values := make([]byte, 0, quantity)
 	for rows.Next() {
-		var val int
-		if err := rows.Scan(&val); err != nil {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			db.Close()
 			return nil, err
 		}
-		values = append(values, byte(val))
+		units[byte(id)] = true
 	}
-	
-	// 填充缺失的地址
-	if len(values) < int(quantity) {
-		missing := int(quantity) - len(values)
-		values = append(values, make([]byte, missing)...)
-	}
-	
-	return values, nil
-}
-
-func (s *SqliteStore) GetDiscreteInputs(start, quantity uint16) ([]byte, error) {
-	if quantity == 0 {
-		return []byte{}, nil
-	}
-	
-	rows, err := s.db.Query("SELECT value FROM discrete_inputs WHERE address BETWEEN ? AND ? ORDER BY address", start, start+quantity-1)
-	if err != nil {
+	if err := rows.Err(); err != nil {
+		db.Close()
 		return nil, err
 	}
-	defer rows.Close()
 
-	values := make([]byte, 0, quantity)
-	for rows.Next() {
-		var val int
-		if err := rows.Scan(&val); err != nil {
+	sdb := &sqliteDB{DB: db, stmts: make(map[string]*sql.Stmt), units: units}
+	for _, query := range sqliteQueries() {
+		if _, err := sdb.prepare(query); err != nil {
+			db.Close()
 			return nil, err
 		}
-		values = append(values, byte(val))
-	}
-	
-	if len(values) < int(quantity) {
-		missing := int(quantity) - len(values)
-		values = append(values, make([]byte, missing)...)
 	}
-	
-	return values, nil
+
+	return &SqliteStore{db: sdb, ctx: context.Background(), unit: defaultUnitID}, nil
 }
 
-func (s *SqliteStore) GetHoldingRegisters(start, quantity uint16) ([]uint16, error) {
-	if quantity == 0 {
-		return []uint16{}, nil
+// sqliteQueries returns every statement the store runs.
+func sqliteQueries() []string {
+	queries := []string{selectRegisters, selectBitBlocks}
+	for n := upsertBatch; n > 0; n /= 2 {
+		queries = append(queries,
+			upsertQuery("registers", "address", "value", n),
+			upsertQuery("bit_blocks", "block", "bits", n))
 	}
-	
-	rows, err := s.db.Query("SELECT value FROM holding_registers WHERE address BETWEEN ? AND ? ORDER BY address", start, start+quantity-1)
-	if err != nil {
+	return queries
+}
+
+func isMemoryDSN(dsn string) bool {
+	return dsn == "" || strings.HasPrefix(dsn, ":memory:") || strings.Contains(dsn, "mode=memory")
+}
+
+// WithContext returns a view of the store whose queries are cancelled with
+// ctx. The view shares the database connection with s.
+func (s *SqliteStore) WithContext(ctx context.Context) Store {
+	return &SqliteStore{db: s.db, ctx: ctx, unit: s.unit}
+}
+
+// AddUnit gives unit id tables of its own in the same database and returns
+// its store. Adding a unit that exists returns its store.
+func (s *SqliteStore) AddUnit(id byte) (*SqliteStore, error) {
+	if _, err := s.db.ExecContext(s.ctx, "INSERT OR IGNORE INTO units (unit_id) VALUES (?)", int(id)); err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	s.db.mu.Lock()
+	s.db.units[id] = true
+	s.db.mu.Unlock()
+	return &SqliteStore{db: s.db, ctx: s.ctx, unit: int(id)}, nil
+}
 
-	values := make([]uint16, 0, quantity)
-	for rows.Next() {
-		var val int
-		if err := rows.Scan(&val); err != nil {
-			return nil, err
-		}
-		values = append(values, uint16(val))
+// Units implements UnitStore.
+func (s *SqliteStore) Units() []byte {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	ids := make([]byte, 0, len(s.db.units))
+	for id := range s.db.units {
+		ids = append(ids, id)
 	}
-	
-	if len(values) < int(quantity) {
-		missing := int(quantity) - len(values)
-		values = append(values, make([]uint16, missing)...)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Unit implements UnitStore.
+func (s *SqliteStore) Unit(id byte) (Store, bool) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if !s.db.units[id] {
+		return nil, false
 	}
-	
-	return values, nil
+	return &SqliteStore{db: s.db, ctx: s.ctx, unit: int(id)}, true
+}
+
+func (s *SqliteStore) GetCoils(start, quantity uint16) ([]byte, error) {
+	return s.conn().getBits(TableCoils, start, quantity)
+}
+
+func (s *SqliteStore) GetDiscreteInputs(start, quantity uint16) ([]byte, error) {
+	return s.conn().getBits(TableDiscreteInputs, start, quantity)
+}
+
+func (s *SqliteStore) GetHoldingRegisters(start, quantity uint16) ([]uint16, error) {
+	return s.conn().getRegisters(TableHoldingRegisters, start, quantity)
 }
 
 func (s *SqliteStore) GetInputRegisters(start, quantity uint16) ([]uint16, error) {
-	if quantity == 0 {
-		return []uint16{}, nil
+	return s.conn().getRegisters(TableInputRegisters, start, quantity)
+}
+
+func (s *SqliteStore) SetCoils(values []byte) error {
+	return s.SetCoilsAt(0, values)
+}
+
+func (s *SqliteStore) SetDiscreteInputs(values []byte) error {
+	return s.SetDiscreteInputsAt(0, values)
+}
+
+func (s *SqliteStore) SetHoldingRegisters(values []uint16) error {
+	return s.SetHoldingRegistersAt(0, values)
+}
+
+func (s *SqliteStore) SetInputRegisters(values []uint16) error {
+	return s.SetInputRegistersAt(0, values)
+}
+
+func (s *SqliteStore) SetCoilsAt(start uint16, values []byte) error {
+	return s.write(func(c sqliteConn) error { return c.setBits(TableCoils, start, values) })
+}
+
+func (s *SqliteStore) SetDiscreteInputsAt(start uint16, values []byte) error {
+	return s.write(func(c sqliteConn) error { return c.setBits(TableDiscreteInputs, start, values) })
+}
+
+func (s *SqliteStore) SetHoldingRegistersAt(start uint16, values []uint16) error {
+	return s.write(func(c sqliteConn) error { return c.setRegisters(TableHoldingRegisters, start, values) })
+}
+
+func (s *SqliteStore) SetInputRegistersAt(start uint16, values []uint16) error {
+	return s.write(func(c sqliteConn) error { return c.setRegisters(TableInputRegisters, start, values) })
+}
+
+// GetBit returns a single coil or discrete input.
+func (s *SqliteStore) GetBit(table Table, address uint16) (bool, error) {
+	if err := checkBitTable(table); err != nil {
+		return false, err
 	}
-	
-	rows, err := s.db.Query("SELECT value FROM input_registers WHERE address BETWEEN ? AND ? ORDER BY address", start, start+quantity-1)
+	bits, err := s.conn().getBits(table, address, 1)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	defer rows.Close()
+	return bits[0] != 0, nil
+}
 
-	values := make([]uint16, 0, quantity)
-	for rows.Next() {
-		var val int
-		if err := rows.Scan(&val); err != nil {
-			return nil, err
-		}
-		values = append(values, uint16(val))
-	}
-	
-	if len(values) < int(quantity) {
-		missing := int(quantity) - len(values)
-		values = append(values, make([]uint16, missing)...)
+// SetBits writes coils or discrete inputs from start.
+func (s *SqliteStore) SetBits(table Table, start uint16, values []bool) error {
+	if err := checkBitTable(table); err != nil {
+		return err
 	}
-	
-	return values, nil
+	return s.write(func(c sqliteConn) error { return c.setBits(table, start, bitsToBytes(values)) })
 }
 
-func (s *SqliteStore) SetCoils(values []byte) error {
-	if len(values) == 0 {
-		return nil
+// Update implements Store with a SQL transaction that is committed when fn
+// returns nil and rolled back otherwise.
+func (s *SqliteStore) Update(fn func(tx Transaction) error) error {
+	return s.write(func(c sqliteConn) error {
+		return fn(sqliteTx{c})
+	})
+}
+
+// Size implements Store. Every address of a SQLite table can be read and
+// written; addresses never written read as zero.
+func (s *SqliteStore) Size(table Table) int {
+	return MaxSize
+}
+
+// DB returns the underlying database, so that other components, such as
+// the history recorder, can keep their tables next to the store's.
+func (s *SqliteStore) DB() *sql.DB {
+	return s.db.DB
+}
+
+// Close closes the database, shared by every unit and view of the store.
+func (s *SqliteStore) Close() error {
+	s.db.mu.Lock()
+	for _, stmt := range s.db.stmts {
+		stmt.Close()
 	}
-	
-	tx, err := s.db.Begin()
+	s.db.stmts = make(map[string]*sql.Stmt)
+	s.db.mu.Unlock()
+	return s.db.Close()
+}
+
+// conn returns the connection for queries outside a transaction.
+func (s *SqliteStore) conn() sqliteConn {
+	return sqliteConn{db: s.db, ctx: s.ctx, unit: s.unit}
+}
+
+// write runs fn in a transaction.
+func (s *SqliteStore) write(fn func(c sqliteConn) error) error {
+	tx, err := s.db.BeginTx(s.ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare("INSERT OR REPLACE INTO coils(address, value) VALUES(?, ?)")
-	if err != nil {
+	if err := fn(sqliteConn{db: s.db, tx: tx, ctx: s.ctx, unit: s.unit}); err != nil {
 		return err
 	}
-	defer stmt.Close()
-
-	for i, val := range values {
-		if _, err := stmt.Exec(i, val); err != nil {
-			return err
-		}
-	}
-	
 	return tx.Commit()
 }
 
-func (s *SqliteStore) SetDiscreteInputs(values []byte) error {
-	if len(values) == 0 {
-		return nil
+// prepare returns the cached statement for query, preparing it on first use.
+func (db *sqliteDB) prepare(query string) (*sql.Stmt, error) {
+	if stmt := db.cached(query); stmt != nil {
+		return stmt, nil
 	}
-	
-	tx, err := s.db.Begin()
+	stmt, err := db.PrepareContext(context.Background(), query)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer tx.Rollback()
 
-	stmt, err := tx.Prepare("INSERT OR REPLACE INTO discrete_inputs(address, value) VALUES(?, ?)")
-	if err != nil {
-		return err
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if cached, ok := db.stmts[query]; ok {
+		stmt.Close()
+		return cached, nil
 	}
-	defer stmt.Close()
+	db.stmts[query] = stmt
+	return stmt, nil
+}
 
-	for i, val := range values {
-		if _, err := stmt.Exec(i, val); err != nil {
-			return err
-		}
+func (db *sqliteDB) cached(query string) *sql.Stmt {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.stmts[query]
+}
+
+// sqliteConn runs the table queries of one unit on the database or inside a
+// transaction.
+type sqliteConn struct {
+	db   *sqliteDB
+	tx   *sql.Tx
+	ctx  context.Context
+	unit int
+}
+
+func (c sqliteConn) stmt(query string) (*sql.Stmt, error) {
+	if c.tx == nil {
+		return c.db.prepare(query)
 	}
-	
-	return tx.Commit()
+	// 事务已占用连接，内存数据库只有一个连接，不能再从连接池准备语句
+	if stmt := c.db.cached(query); stmt != nil {
+		return c.tx.StmtContext(c.ctx, stmt), nil
+	}
+	return c.tx.PrepareContext(c.ctx, query)
 }
 
-func (s *SqliteStore) SetHoldingRegisters(values []uint16) error {
-	if len(values) == 0 {
-		return nil
+// sqliteTx is the Transaction passed to the function given to Update.
+type sqliteTx struct {
+	c sqliteConn
+}
+
+func (tx sqliteTx) GetCoils(start, quantity uint16) ([]byte, error) {
+	return tx.c.getBits(TableCoils, start, quantity)
+}
+
+func (tx sqliteTx) GetDiscreteInputs(start, quantity uint16) ([]byte, error) {
+	return tx.c.getBits(TableDiscreteInputs, start, quantity)
+}
+
+func (tx sqliteTx) GetHoldingRegisters(start, quantity uint16) ([]uint16, error) {
+	return tx.c.getRegisters(TableHoldingRegisters, start, quantity)
+}
+
+func (tx sqliteTx) GetInputRegisters(start, quantity uint16) ([]uint16, error) {
+	return tx.c.getRegisters(TableInputRegisters, start, quantity)
+}
+
+func (tx sqliteTx) SetCoilsAt(start uint16, values []byte) error {
+	return tx.c.setBits(TableCoils, start, values)
+}
+
+func (tx sqliteTx) SetDiscreteInputsAt(start uint16, values []byte) error {
+	return tx.c.setBits(TableDiscreteInputs, start, values)
+}
+
+func (tx sqliteTx) SetHoldingRegistersAt(start uint16, values []uint16) error {
+	return tx.c.setRegisters(TableHoldingRegisters, start, values)
+}
+
+func (tx sqliteTx) SetInputRegistersAt(start uint16, values []uint16) error {
+	return tx.c.setRegisters(TableInputRegisters, start, values)
+}
+
+const (
+	selectRegisters = "SELECT address, value FROM registers WHERE unit_id = ? AND table_id = ? AND address BETWEEN ? AND ?"
+	selectBitBlocks = "SELECT block, bits FROM bit_blocks WHERE unit_id = ? AND table_id = ? AND block BETWEEN ? AND ?"
+)
+
+// getRegisters reads quantity registers from start. Each row is placed at
+// its own address, so addresses never written read as zero wherever they
+// fall in the range.
+func (c sqliteConn) getRegisters(table Table, start, quantity uint16) ([]uint16, error) {
+	if quantity == 0 {
+		return []uint16{}, nil
 	}
-	
-	tx, err := s.db.Begin()
+	values := make([]uint16, quantity)
+	err := c.query(selectRegisters, table, int(start), int(start)+int(quantity)-1, func(address, value int) {
+		values[address-int(start)] = uint16(value)
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer tx.Rollback()
+	return values, nil
+}
 
-	stmt, err := tx.Prepare("INSERT OR REPLACE INTO holding_registers(address, value) VALUES(?, ?)")
+// getBits reads quantity bits from the packed rows, eight bits per block,
+// and unpacks them one per byte. Blocks never written read as zero.
+func (c sqliteConn) getBits(table Table, start, quantity uint16) ([]byte, error) {
+	if quantity == 0 {
+		return []byte{}, nil
+	}
+	set, first, err := c.readBlocks(table, int(start), int(start)+int(quantity)-1)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer stmt.Close()
+	return set.read(start-uint16(first*8), int(quantity), nil)
+}
 
-	for i, val := range values {
-		if _, err := stmt.Exec(i, val); err != nil {
-			return err
-		}
-	}
-	
-	return tx.Commit()
+// readBlocks reads the blocks holding bits first to last.
+func (c sqliteConn) readBlocks(table Table, first, last int) (bitSet, int, error) {
+	firstBlock, lastBlock := first/8, last/8
+	set := newBitSet((lastBlock - firstBlock + 1) * 8)
+	err := c.query(selectBitBlocks, table, firstBlock, lastBlock, func(block, bits int) {
+		set.data[block-firstBlock] = byte(bits)
+	})
+	return set, firstBlock, err
 }
 
-func (s *SqliteStore) SetInputRegisters(values []uint16) error {
-	if len(values) == 0 {
-		return nil
-	}
-	
-	tx, err := s.db.Begin()
+func (c sqliteConn) query(query string, table Table, from, to int, row func(key, value int)) error {
+	stmt, err := c.stmt(query)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
-
-	stmt, err := tx.Prepare("INSERT OR REPLACE INTO input_registers(address, value) VALUES(?, ?)")
+	rows, err := stmt.QueryContext(c.ctx, c.unit, int(table), from, to)
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
+	defer rows.Close()
 
-	for i, val := range values {
-		if _, err := stmt.Exec(i, val); err != nil {
+	for rows.Next() {
+		var key, value int
+		if err := rows.Scan(&key, &value); err != nil {
 			return err
 		}
+		row(key, value)
 	}
-	
-	return tx.Commit()
+	return rows.Err()
 }
 
-func (s *SqliteStore) SetCoilsAt(start uint16, values []byte) error {
+// setRegisters writes values from start; c must be a transaction.
+func (c sqliteConn) setRegisters(table Table, start uint16, values []uint16) error {
 	if len(values) == 0 {
 		return nil
 	}
-	
-	tx, err := s.db.Begin()
-	if err != nil {
-		return err
+	if int(start)+len(values) > MaxSize {
+		return ErrInvalidAddress
+	}
+	rows := make([]int, len(values))
+	for i, v := range values {
+		rows[i] = int(v)
+	}
+	return c.upsert("registers", "address", "value", table, int(start), rows)
+}
+
+// setBits writes values into the packed rows, merging them with the bits
+// already stored in the affected blocks; c must be a transaction.
+func (c sqliteConn) setBits(table Table, start uint16, values []byte) error {
+	if len(values) == 0 {
+		return nil
+	}
+	if int(start)+len(values) > MaxSize {
+		return ErrInvalidAddress
 	}
-	defer tx.Rollback()
 
-	stmt, err := tx.Prepare("INSERT OR REPLACE INTO coils(address, value) VALUES(?, ?)")
+	set, first, err := c.readBlocks(table, int(start), int(start)+len(values)-1)
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
+	if err := set.write(start-uint16(first*8), values); err != nil {
+		return err
+	}
 
-	for i, val := range values {
-		if _, err := stmt.Exec(start+uint16(i), val); err != nil {
+	rows := make([]int, len(set.data))
+	for i, bits := range set.data {
+		rows[i] = int(bits)
+	}
+	return c.upsert("bit_blocks", "block", "bits", table, first, rows)
+}
+
+// upsert stores values[i] under key first+i, in power-of-two batches of at
+// most upsertBatch rows per statement.
+func (c sqliteConn) upsert(sqlTable, keyColumn, valueColumn string, table Table, first int, values []int) error {
+	for off, n := 0, upsertBatch; off < len(values); off += n {
+		for n > len(values)-off {
+			n /= 2
+		}
+		stmt, err := c.stmt(upsertQuery(sqlTable, keyColumn, valueColumn, n))
+		if err != nil {
+			return err
+		}
+
+		args := make([]any, 0, 4*n)
+		for i := range n {
+			args = append(args, c.unit, int(table), first+off+i, values[off+i])
+		}
+		if _, err := stmt.ExecContext(c.ctx, args...); err != nil {
 			return err
 		}
 	}
-	
-	return tx.Commit()
+	return nil
 }
 
-func (s *SqliteStore) SetHoldingRegistersAt(start uint16, values []uint16) error {
-	if len(values) == 0 {
-		return nil
+func upsertQuery(sqlTable, keyColumn, valueColumn string, rows int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "INSERT INTO %s (unit_id, table_id, %s, %s) VALUES ", sqlTable, keyColumn, valueColumn)
+	for i := range rows {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(?, ?, ?, ?)")
 	}
-	
-	tx, err := s.db.Begin()
-	if err != nil {
+	fmt.Fprintf(&b, " ON CONFLICT (unit_id, table_id, %s) DO UPDATE SET %s = excluded.%s", keyColumn, valueColumn, valueColumn)
+	return b.String()
+}
+
+// migrations[v] upgrades the schema from version v to v+1. Append new
+// migrations; never edit released ones.
+var migrations = []func(tx *sql.Tx) error{
+	migrateUnitTables,
+}
+
+// ErrSchemaTooNew is returned when a database was written by a newer
+// version of the store.
+var ErrSchemaTooNew = errors.New("store: database schema is newer than supported")
+
+// migrate brings the schema to the latest version, one transaction per
+// migration.
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)"); err != nil {
 		return err
 	}
-	defer tx.Rollback()
-
-	stmt, err := tx.Prepare("INSERT OR REPLACE INTO holding_registers(address, value) VALUES(?, ?)")
-	if err != nil {
+	var version int
+	err := db.QueryRow("SELECT version FROM schema_version").Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := db.Exec("INSERT INTO schema_version (version) VALUES (0)"); err != nil {
+			return err
+		}
+	} else if err != nil {
 		return err
 	}
-	defer stmt.Close()
+	if version > len(migrations) {
+		return fmt.Errorf("%w: version %d, supported %d", ErrSchemaTooNew, version, len(migrations))
+	}
 
-	for i, val := range values {
-		if _, err := stmt.Exec(start+uint16(i), val); err != nil {
+	for ; version < len(migrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := migrations[version](tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("store: migrate schema to version %d: %w", version+1, err)
+		}
+		if _, err := tx.Exec("UPDATE schema_version SET version = ?", version+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
 			return err
 		}
 	}
-	
-	return tx.Commit()
+	return nil
 }
 
-func (s *SqliteStore) Close() error {
-	return s.db.Close()
+// migrateUnitTables creates the unit-aware tables and moves the data of the
+// earlier layouts, one table per Modbus table with coils either one row per
+// bit or packed eight per row, to the default unit.
+func migrateUnitTables(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE registers (
+			unit_id INTEGER NOT NULL,
+			table_id INTEGER NOT NULL,
+			address INTEGER NOT NULL,
+			value INTEGER NOT NULL,
+			PRIMARY KEY (unit_id, table_id, address)
+		) WITHOUT ROWID;
+		CREATE TABLE bit_blocks (
+			unit_id INTEGER NOT NULL,
+			table_id INTEGER NOT NULL,
+			block INTEGER NOT NULL,
+			bits INTEGER NOT NULL,
+			PRIMARY KEY (unit_id, table_id, block)
+		) WITHOUT ROWID;
+		CREATE TABLE units (
+			unit_id INTEGER PRIMARY KEY
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	legacy := []struct {
+		name  string
+		table Table
+		copy  string
+	}{
+		{"holding_registers", TableHoldingRegisters, "INSERT OR REPLACE INTO registers SELECT ?, ?, address, value FROM holding_registers"},
+		{"input_registers", TableInputRegisters, "INSERT OR REPLACE INTO registers SELECT ?, ?, address, value FROM input_registers"},
+		{"coils", TableCoils, "INSERT OR REPLACE INTO bit_blocks SELECT ?, ?, address / 8, SUM((value != 0) << (address % 8)) FROM coils GROUP BY address / 8"},
+		{"discrete_inputs", TableDiscreteInputs, "INSERT OR REPLACE INTO bit_blocks SELECT ?, ?, address / 8, SUM((value != 0) << (address % 8)) FROM discrete_inputs GROUP BY address / 8"},
+		{"coil_blocks", TableCoils, "INSERT OR REPLACE INTO bit_blocks SELECT ?, ?, block, bits FROM coil_blocks"},
+		{"discrete_input_blocks", TableDiscreteInputs, "INSERT OR REPLACE INTO bit_blocks SELECT ?, ?, block, bits FROM discrete_input_blocks"},
+	}
+	for _, l := range legacy {
+		var n int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", l.name).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			continue
+		}
+		if _, err := tx.Exec(l.copy, defaultUnitID, int(l.table)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DROP TABLE " + l.name); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Copyright (C) 2025 wwhai
@@ -327,4 +625,3 @@ func (s *SqliteStore) Close() error {
 //
 // You should have received a copy of the GNU Affero General Public License
 // along with this program.  If not, see <https://www.gnu.org/licenses/>.
-
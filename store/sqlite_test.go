@@ -16,7 +16,11 @@
 package store
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -45,7 +49,7 @@ func TestGetCoils(t *testing.T) {
 	}
 	defer store.Close()
 
-	_, err = store.db.Exec("INSERT INTO coils (address, value) VALUES (0, 1), (1, 0), (2, 1)")
+	_, err = store.db.Exec("INSERT INTO bit_blocks (unit_id, table_id, block, bits) VALUES (-1, 0, 0, 5)")
 	if err != nil {
 		t.Fatalf("Failed to insert test data: %v", err)
 	}
@@ -65,3 +69,284 @@ func TestGetCoils(t *testing.T) {
 		}
 	}
 }
+
+func TestSqliteStore_SetInputRegistersAt(t *testing.T) {
+	dsn := "test.db"
+	defer os.Remove(dsn)
+
+	store, err := NewSqliteStore(dsn)
+	if err != nil {
+		t.Fatalf("NewSqliteStore() error = %v", err)
+	}
+	defer store.Close()
+
+	if err := store.SetInputRegistersAt(100, []uint16{7, 8}); err != nil {
+		t.Fatalf("SetInputRegistersAt() error = %v", err)
+	}
+	values, err := store.GetInputRegisters(100, 2)
+	if err != nil {
+		t.Fatalf("GetInputRegisters() error = %v", err)
+	}
+	if values[0] != 7 || values[1] != 8 {
+		t.Errorf("GetInputRegisters() got %v, want [7 8]", values)
+	}
+
+	if err := store.SetDiscreteInputsAt(65535, []byte{1, 1}); err != ErrInvalidAddress {
+		t.Errorf("Expected ErrInvalidAddress for write past 65535, got %v", err)
+	}
+	if store.Size(TableHoldingRegisters) != MaxSize {
+		t.Errorf("Size() = %d; want %d", store.Size(TableHoldingRegisters), MaxSize)
+	}
+}
+
+func TestSqliteStore_WithContext(t *testing.T) {
+	dsn := "test.db"
+	defer os.Remove(dsn)
+
+	store, err := NewSqliteStore(dsn)
+	if err != nil {
+		t.Fatalf("NewSqliteStore() error = %v", err)
+	}
+	defer store.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	bound := BindContext(store, ctx)
+	if _, err := bound.GetHoldingRegisters(0, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled from cancelled read, got %v", err)
+	}
+	if err := bound.SetHoldingRegistersAt(0, []uint16{1}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled from cancelled write, got %v", err)
+	}
+}
+
+func TestSqliteStore_BitsArePacked(t *testing.T) {
+	store, err := NewSqliteStore(":memory:")
+	if err != nil {
+		t.Fatalf("NewSqliteStore() error = %v", err)
+	}
+	defer store.Close()
+
+	if err := store.SetCoilsAt(6, []byte{1, 1, 0, 1}); err != nil {
+		t.Fatalf("SetCoilsAt() error = %v", err)
+	}
+	if err := store.SetBits(TableCoils, 12, []bool{true}); err != nil {
+		t.Fatalf("SetBits() error = %v", err)
+	}
+
+	var rows int
+	if err := store.db.QueryRow("SELECT COUNT(*) FROM bit_blocks WHERE table_id = 0").Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 2 {
+		t.Errorf("Expected 2 packed rows, got %d", rows)
+	}
+
+	values, err := store.GetCoils(5, 9)
+	if err != nil {
+		t.Fatalf("GetCoils() error = %v", err)
+	}
+	expected := []byte{0, 1, 1, 0, 1, 0, 0, 1, 0}
+	if string(values) != string(expected) {
+		t.Errorf("GetCoils() = %v, want %v", values, expected)
+	}
+
+	if on, err := store.GetBit(TableCoils, 9); err != nil || !on {
+		t.Errorf("GetBit(9) = %v, %v; want true", on, err)
+	}
+	if _, err := store.GetBit(TableHoldingRegisters, 0); err != ErrInvalidTable {
+		t.Errorf("Expected ErrInvalidTable, got %v", err)
+	}
+}
+
+func TestSqliteStore_PacksLegacyBits(t *testing.T) {
+	dsn := "legacy.db"
+	defer os.Remove(dsn)
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE coils (address INTEGER PRIMARY KEY, value INTEGER);
+		INSERT INTO coils (address, value) VALUES (0, 1), (2, 1), (9, 1);
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewSqliteStore(dsn)
+	if err != nil {
+		t.Fatalf("NewSqliteStore() error = %v", err)
+	}
+	defer store.Close()
+
+	values, err := store.GetCoils(0, 10)
+	if err != nil {
+		t.Fatalf("GetCoils() error = %v", err)
+	}
+	expected := []byte{1, 0, 1, 0, 0, 0, 0, 0, 0, 1}
+	if string(values) != string(expected) {
+		t.Errorf("GetCoils() = %v, want %v", values, expected)
+	}
+}
+
+func TestSqliteStore_ReadsAreAddressAligned(t *testing.T) {
+	store, err := NewSqliteStore(":memory:")
+	if err != nil {
+		t.Fatalf("NewSqliteStore() error = %v", err)
+	}
+	defer store.Close()
+
+	// Addresses 1 and 3 are never written.
+	store.SetHoldingRegistersAt(0, []uint16{10})
+	store.SetHoldingRegistersAt(2, []uint16{30})
+	store.SetHoldingRegistersAt(4, []uint16{50})
+
+	values, err := store.GetHoldingRegisters(0, 5)
+	if err != nil {
+		t.Fatalf("GetHoldingRegisters() error = %v", err)
+	}
+	expected := []uint16{10, 0, 30, 0, 50}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("GetHoldingRegisters() = %v, want %v", values, expected)
+	}
+}
+
+func TestSqliteStore_Units(t *testing.T) {
+	dsn := "units.db"
+	defer os.Remove(dsn)
+	defer os.Remove(dsn + "-wal")
+	defer os.Remove(dsn + "-shm")
+
+	store, err := NewSqliteStore(dsn)
+	if err != nil {
+		t.Fatalf("NewSqliteStore() error = %v", err)
+	}
+	unit, err := store.AddUnit(5)
+	if err != nil {
+		t.Fatalf("AddUnit() error = %v", err)
+	}
+	store.SetHoldingRegistersAt(0, []uint16{1})
+	unit.SetHoldingRegistersAt(0, []uint16{5})
+	unit.SetCoilsAt(3, []byte{1})
+	store.Close()
+
+	store, err = NewSqliteStore(dsn)
+	if err != nil {
+		t.Fatalf("NewSqliteStore() error = %v", err)
+	}
+	defer store.Close()
+
+	var mode string
+	store.db.QueryRow("PRAGMA journal_mode").Scan(&mode)
+	if mode != "wal" {
+		t.Errorf("journal_mode = %q, want wal", mode)
+	}
+
+	if got := store.Units(); !reflect.DeepEqual(got, []byte{5}) {
+		t.Fatalf("Units() = %v, want [5]", got)
+	}
+	if _, ok := store.Unit(6); ok {
+		t.Error("Unit(6) should not exist")
+	}
+	st, ok := store.Unit(5)
+	if !ok {
+		t.Fatal("Unit(5) missing after reopen")
+	}
+	if values, _ := st.GetHoldingRegisters(0, 1); values[0] != 5 {
+		t.Errorf("unit 5 holding register = %v, want [5]", values)
+	}
+	if values, _ := store.GetHoldingRegisters(0, 1); values[0] != 1 {
+		t.Errorf("default holding register = %v, want [1]", values)
+	}
+	if coils, _ := store.GetCoils(3, 1); coils[0] != 0 {
+		t.Error("unit 5 coils leaked into the default unit")
+	}
+}
+
+func TestSqliteStore_BatchedWrites(t *testing.T) {
+	store, err := NewSqliteStore(":memory:")
+	if err != nil {
+		t.Fatalf("NewSqliteStore() error = %v", err)
+	}
+	defer store.Close()
+
+	values := make([]uint16, 1000)
+	for i := range values {
+		values[i] = uint16(i)
+	}
+	if err := store.SetInputRegistersAt(100, values); err != nil {
+		t.Fatalf("SetInputRegistersAt() error = %v", err)
+	}
+	got, err := store.GetInputRegisters(100, 1000)
+	if err != nil || !reflect.DeepEqual(got, values) {
+		t.Errorf("GetInputRegisters() mismatch, err = %v", err)
+	}
+	if err := store.SetInputRegistersAt(0xFFFF, []uint16{1, 2}); err != ErrInvalidAddress {
+		t.Errorf("Expected ErrInvalidAddress, got %v", err)
+	}
+}
+
+func TestSqliteStore_MigratesLegacyLayout(t *testing.T) {
+	dsn := "migrate.db"
+	defer os.Remove(dsn)
+	defer os.Remove(dsn + "-wal")
+	defer os.Remove(dsn + "-shm")
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE coils (address INTEGER PRIMARY KEY, value INTEGER);
+		CREATE TABLE discrete_inputs (address INTEGER PRIMARY KEY, value INTEGER);
+		CREATE TABLE holding_registers (address INTEGER PRIMARY KEY, value INTEGER);
+		CREATE TABLE input_registers (address INTEGER PRIMARY KEY, value INTEGER);
+		INSERT INTO holding_registers (address, value) VALUES (0, 11), (2, 33);
+		INSERT INTO input_registers (address, value) VALUES (7, 77);
+		INSERT INTO discrete_inputs (address, value) VALUES (1, 1);
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewSqliteStore(dsn)
+	if err != nil {
+		t.Fatalf("NewSqliteStore() error = %v", err)
+	}
+	defer store.Close()
+
+	if values, _ := store.GetHoldingRegisters(0, 3); !reflect.DeepEqual(values, []uint16{11, 0, 33}) {
+		t.Errorf("holding registers = %v, want [11 0 33]", values)
+	}
+	if values, _ := store.GetInputRegisters(7, 1); values[0] != 77 {
+		t.Errorf("input registers = %v, want [77]", values)
+	}
+	if values, _ := store.GetDiscreteInputs(0, 2); !reflect.DeepEqual(values, []byte{0, 1}) {
+		t.Errorf("discrete inputs = %v, want [0 1]", values)
+	}
+
+	var version, legacy int
+	store.db.QueryRow("SELECT version FROM schema_version").Scan(&version)
+	store.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'holding_registers'").Scan(&legacy)
+	if version != len(migrations) || legacy != 0 {
+		t.Errorf("schema version = %d, legacy tables = %d", version, legacy)
+	}
+}
+
+func TestSqliteStore_RejectsNewerSchema(t *testing.T) {
+	dsn := "newer.db"
+	defer os.Remove(dsn)
+
+	db, _ := sql.Open("sqlite3", dsn)
+	db.Exec("CREATE TABLE schema_version (version INTEGER NOT NULL); INSERT INTO schema_version VALUES (99);")
+	db.Close()
+
+	if _, err := NewSqliteStore(dsn); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Expected ErrSchemaTooNew, got %v", err)
+	}
+}
@@ -15,16 +15,85 @@
 
 package store
 
-type Store interface {
+// Table identifies one of the four Modbus data tables.
+type Table int
+
+const (
+	TableCoils Table = iota
+	TableDiscreteInputs
+	TableHoldingRegisters
+	TableInputRegisters
+)
+
+func (t Table) String() string {
+	switch t {
+	case TableCoils:
+		return "coils"
+	case TableDiscreteInputs:
+		return "discrete_inputs"
+	case TableHoldingRegisters:
+		return "holding_registers"
+	case TableInputRegisters:
+		return "input_registers"
+	}
+	return "unknown"
+}
+
+// Reader reads from the four tables.
+type Reader interface {
 	GetCoils(start, quantity uint16) ([]byte, error)
 	GetDiscreteInputs(start, quantity uint16) ([]byte, error)
 	GetHoldingRegisters(start, quantity uint16) ([]uint16, error)
 	GetInputRegisters(start, quantity uint16) ([]uint16, error)
+}
+
+type Store interface {
+	Reader
 	SetCoils(values []byte) error
 	SetDiscreteInputs(values []byte) error
 	SetHoldingRegisters(values []uint16) error
 	SetInputRegisters(values []uint16) error
 	SetCoilsAt(start uint16, values []byte) error
-	SetHoldingRegistersAt(start uint16, values []uint16) error // Add this line
+	SetDiscreteInputsAt(start uint16, values []byte) error
+	SetHoldingRegistersAt(start uint16, values []uint16) error
+	SetInputRegistersAt(start uint16, values []uint16) error
+	// Update runs fn as one atomic update: either every write fn makes is
+	// applied or, when fn returns an error, none is. Readers never observe a
+	// partially applied update. fn must use only tx; calling the store
+	// itself from fn may deadlock.
+	Update(fn func(tx Transaction) error) error
+	// Size returns the number of addresses available in a table.
+	Size(table Table) int
+	Close() error
+}
+
+// MaxSize is the number of addresses in a full 16-bit Modbus table.
+const MaxSize = 0x10000
+
+// ParseTable returns the table named by Table.String.
+func ParseTable(name string) (Table, error) {
+	for t := TableCoils; t <= TableInputRegisters; t++ {
+		if t.String() == name {
+			return t, nil
+		}
+	}
+	return 0, ErrInvalidTable
 }
 
+// MarshalText encodes the table as its name.
+func (t Table) MarshalText() ([]byte, error) {
+	if t < TableCoils || t > TableInputRegisters {
+		return nil, ErrInvalidTable
+	}
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText decodes a table name.
+func (t *Table) UnmarshalText(text []byte) error {
+	parsed, err := ParseTable(string(text))
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
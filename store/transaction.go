@@ -0,0 +1,138 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+// Transaction reads and writes several tables as one atomic update, see
+// Store.Update. Reads see the writes made earlier in the same transaction.
+type Transaction interface {
+	Reader
+	SetCoilsAt(start uint16, values []byte) error
+	SetDiscreteInputsAt(start uint16, values []byte) error
+	SetHoldingRegistersAt(start uint16, values []uint16) error
+	SetInputRegistersAt(start uint16, values []uint16) error
+}
+
+// undoTx is the Transaction of stores that hold their lock for the whole
+// update. It writes straight through and keeps the previous values so that a
+// failed update can be rolled back.
+type undoTx struct {
+	Reader
+	write func(table Table, start uint16, values []uint16) error
+	undo  []undoEntry
+}
+
+type undoEntry struct {
+	table  Table
+	start  uint16
+	values []uint16
+}
+
+// runUndoTx runs fn against r and write, which must not take the store lock,
+// and restores every written value if fn fails or panics.
+func runUndoTx(r Reader, write func(table Table, start uint16, values []uint16) error, fn func(tx Transaction) error) error {
+	tx := &undoTx{Reader: r, write: write}
+	committed := false
+	defer func() {
+		if !committed {
+			tx.rollback()
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+func (tx *undoTx) SetCoilsAt(start uint16, values []byte) error {
+	return tx.set(TableCoils, start, bitsToWords(values))
+}
+
+func (tx *undoTx) SetDiscreteInputsAt(start uint16, values []byte) error {
+	return tx.set(TableDiscreteInputs, start, bitsToWords(values))
+}
+
+func (tx *undoTx) SetHoldingRegistersAt(start uint16, values []uint16) error {
+	return tx.set(TableHoldingRegisters, start, values)
+}
+
+func (tx *undoTx) SetInputRegistersAt(start uint16, values []uint16) error {
+	return tx.set(TableInputRegisters, start, values)
+}
+
+func (tx *undoTx) set(table Table, start uint16, values []uint16) error {
+	old, err := readWords(tx.Reader, table, start, len(values))
+	if err != nil {
+		return err
+	}
+	if err := tx.write(table, start, values); err != nil {
+		return err
+	}
+	tx.undo = append(tx.undo, undoEntry{table: table, start: start, values: old})
+	return nil
+}
+
+func (tx *undoTx) rollback() {
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		e := tx.undo[i]
+		tx.write(e.table, e.start, e.values)
+	}
+	tx.undo = nil
+}
+
+// readWords reads n addresses of any table, with coils and discrete inputs
+// as 0 or 1.
+func readWords(r Reader, table Table, start uint16, n int) ([]uint16, error) {
+	if n <= 0 || n > 0xFFFF {
+		return nil, ErrInvalidAddress
+	}
+	switch table {
+	case TableCoils:
+		bits, err := r.GetCoils(start, uint16(n))
+		if err != nil {
+			return nil, err
+		}
+		return bitsToWords(bits), nil
+	case TableDiscreteInputs:
+		bits, err := r.GetDiscreteInputs(start, uint16(n))
+		if err != nil {
+			return nil, err
+		}
+		return bitsToWords(bits), nil
+	case TableHoldingRegisters:
+		return r.GetHoldingRegisters(start, uint16(n))
+	case TableInputRegisters:
+		return r.GetInputRegisters(start, uint16(n))
+	}
+	return nil, ErrInvalidTable
+}
+
+// writeWords writes values to any table of tx, with coils and discrete
+// inputs as 0 or 1.
+func writeWords(tx Transaction, table Table, start uint16, values []uint16) error {
+	switch table {
+	case TableCoils:
+		return tx.SetCoilsAt(start, wordsToBits(values))
+	case TableDiscreteInputs:
+		return tx.SetDiscreteInputsAt(start, wordsToBits(values))
+	case TableHoldingRegisters:
+		return tx.SetHoldingRegistersAt(start, values)
+	case TableInputRegisters:
+		return tx.SetInputRegistersAt(start, values)
+	}
+	return ErrInvalidTable
+}
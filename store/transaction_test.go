@@ -0,0 +1,178 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestInMemoryStore_Update(t *testing.T) {
+	s := NewInMemoryStore()
+
+	err := s.Update(func(tx Transaction) error {
+		if err := tx.SetHoldingRegistersAt(10, []uint16{1, 2}); err != nil {
+			return err
+		}
+		if err := tx.SetCoilsAt(3, []byte{1}); err != nil {
+			return err
+		}
+		values, err := tx.GetHoldingRegisters(10, 2)
+		if err != nil || !reflect.DeepEqual(values, []uint16{1, 2}) {
+			t.Errorf("Transaction read = %v, %v; want its own writes", values, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	values, _ := s.GetHoldingRegisters(10, 2)
+	coils, _ := s.GetCoils(3, 1)
+	if !reflect.DeepEqual(values, []uint16{1, 2}) || coils[0] != 1 {
+		t.Errorf("Update() not applied: %v %v", values, coils)
+	}
+}
+
+func TestInMemoryStore_UpdateRollback(t *testing.T) {
+	s := NewInMemoryStore()
+	s.SetHoldingRegistersAt(0, []uint16{7, 7})
+
+	errAbort := errors.New("abort")
+	err := s.Update(func(tx Transaction) error {
+		tx.SetHoldingRegistersAt(0, []uint16{1, 2})
+		tx.SetInputRegistersAt(5, []uint16{9})
+		tx.SetDiscreteInputsAt(0, []byte{1, 1})
+		return errAbort
+	})
+	if err != errAbort {
+		t.Fatalf("Update() error = %v, want %v", err, errAbort)
+	}
+
+	holding, _ := s.GetHoldingRegisters(0, 2)
+	input, _ := s.GetInputRegisters(5, 1)
+	inputs, _ := s.GetDiscreteInputs(0, 2)
+	if !reflect.DeepEqual(holding, []uint16{7, 7}) || input[0] != 0 || !reflect.DeepEqual(inputs, []byte{0, 0}) {
+		t.Errorf("Update() not rolled back: %v %v %v", holding, input, inputs)
+	}
+
+	// A write that fails inside the transaction aborts it too.
+	size := s.Size(TableHoldingRegisters)
+	err = s.Update(func(tx Transaction) error {
+		tx.SetHoldingRegistersAt(0, []uint16{3})
+		return tx.SetHoldingRegistersAt(uint16(size), []uint16{1})
+	})
+	if err != ErrInvalidAddress {
+		t.Fatalf("Update() error = %v, want ErrInvalidAddress", err)
+	}
+	if holding, _ := s.GetHoldingRegisters(0, 1); holding[0] != 7 {
+		t.Errorf("Update() not rolled back: %v", holding)
+	}
+}
+
+func TestInMemoryStore_UpdateNoTornReads(t *testing.T) {
+	s := NewInMemoryStore()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := uint16(1); i <= 500; i++ {
+			s.Update(func(tx Transaction) error {
+				if err := tx.SetHoldingRegistersAt(0, []uint16{i}); err != nil {
+					return err
+				}
+				return tx.SetInputRegistersAt(0, []uint16{i})
+			})
+		}
+	}()
+
+	for range 500 {
+		s.(*InMemoryStore).View(func(r Reader) error {
+			holding, _ := r.GetHoldingRegisters(0, 1)
+			input, _ := r.GetInputRegisters(0, 1)
+			if holding[0] != input[0] {
+				t.Errorf("Torn read: holding %d, input %d", holding[0], input[0])
+			}
+			return nil
+		})
+	}
+	wg.Wait()
+}
+
+func TestSparseStore_UpdateRollback(t *testing.T) {
+	s := newTestSparseStore(t)
+
+	err := s.Update(func(tx Transaction) error {
+		if err := tx.SetHoldingRegistersAt(40000, []uint16{9, 9}); err != nil {
+			return err
+		}
+		return tx.SetHoldingRegistersAt(40050, []uint16{1})
+	})
+	if err != ErrInvalidAddress {
+		t.Fatalf("Update() error = %v, want ErrInvalidAddress", err)
+	}
+	if values, _ := s.GetHoldingRegisters(40000, 2); !reflect.DeepEqual(values, []uint16{1, 2}) {
+		t.Errorf("Update() not rolled back: %v", values)
+	}
+}
+
+func TestSqliteStore_Update(t *testing.T) {
+	dsn := "tx.db"
+	defer os.Remove(dsn)
+
+	s, err := NewSqliteStore(dsn)
+	if err != nil {
+		t.Fatalf("NewSqliteStore() error = %v", err)
+	}
+	defer s.Close()
+
+	errAbort := errors.New("abort")
+	err = s.Update(func(tx Transaction) error {
+		tx.SetHoldingRegistersAt(0, []uint16{1, 2})
+		tx.SetCoilsAt(0, []byte{1})
+		return errAbort
+	})
+	if err != errAbort {
+		t.Fatalf("Update() error = %v, want %v", err, errAbort)
+	}
+	if values, _ := s.GetHoldingRegisters(0, 2); !reflect.DeepEqual(values, []uint16{0, 0}) {
+		t.Errorf("Update() not rolled back: %v", values)
+	}
+
+	err = s.Update(func(tx Transaction) error {
+		if err := tx.SetHoldingRegistersAt(0, []uint16{1, 2}); err != nil {
+			return err
+		}
+		if err := tx.SetCoilsAt(4, []byte{1}); err != nil {
+			return err
+		}
+		values, err := tx.GetHoldingRegisters(0, 2)
+		if err != nil || !reflect.DeepEqual(values, []uint16{1, 2}) {
+			t.Errorf("Transaction read = %v, %v; want its own writes", values, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if on, _ := s.GetBit(TableCoils, 4); !on {
+		t.Error("Update() not committed")
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// UnitStore is a Store that keeps separate tables per Modbus unit ID. The
+// server sends each request to the store of its unit.
+type UnitStore interface {
+	Store
+	// Units returns the unit IDs with a store of their own, in order.
+	Units() []byte
+	// Unit returns the store of a unit.
+	Unit(id byte) (Store, bool)
+}
+
+// UnitMap is a UnitStore built from one store per unit. Requests for units
+// without a store of their own, and the Store methods of the map itself, go
+// to the default store.
+type UnitMap struct {
+	Store
+	mu    sync.RWMutex
+	units map[byte]Store
+}
+
+var _ UnitStore = (*UnitMap)(nil)
+
+// NewUnitMap returns a map whose default store is def.
+func NewUnitMap(def Store) *UnitMap {
+	return &UnitMap{Store: def, units: make(map[byte]Store)}
+}
+
+// Set gives unit id its own store.
+func (m *UnitMap) Set(id byte, st Store) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.units[id] = st
+}
+
+// Units implements UnitStore.
+func (m *UnitMap) Units() []byte {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := make([]byte, 0, len(m.units))
+	for id := range m.units {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Unit implements UnitStore.
+func (m *UnitMap) Unit(id byte) (Store, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	st, ok := m.units[id]
+	return st, ok
+}
+
+// Close closes the default store and every unit store once.
+func (m *UnitMap) Close() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	closed := map[Store]bool{m.Store: true}
+	errs := []error{m.Store.Close()}
+	for _, st := range m.units {
+		if !closed[st] {
+			closed[st] = true
+			errs = append(errs, st.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// StoreForUnit returns the store serving unit id: its own store when st is a
+// UnitStore that has one, st otherwise.
+func StoreForUnit(st Store, id byte) Store {
+	if us, ok := st.(UnitStore); ok {
+		if unit, ok := us.Unit(id); ok {
+			return unit
+		}
+	}
+	return st
+}
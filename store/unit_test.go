@@ -0,0 +1,67 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnitMap(t *testing.T) {
+	def := NewInMemoryStore()
+	unit := NewInMemoryStore()
+	m := NewUnitMap(def)
+	m.Set(3, unit)
+	m.Set(1, unit)
+
+	if got := m.Units(); !reflect.DeepEqual(got, []byte{1, 3}) {
+		t.Errorf("Units() = %v, want [1 3]", got)
+	}
+	if st, ok := m.Unit(3); !ok || st != unit {
+		t.Error("Unit(3) did not return the unit store")
+	}
+	if _, ok := m.Unit(2); ok {
+		t.Error("Unit(2) should not exist")
+	}
+
+	if StoreForUnit(m, 3) != unit || StoreForUnit(m, 2) != Store(m) || StoreForUnit(def, 3) != def {
+		t.Error("StoreForUnit() selected the wrong store")
+	}
+
+	m.SetHoldingRegistersAt(0, []uint16{5})
+	if values, _ := def.GetHoldingRegisters(0, 1); values[0] != 5 {
+		t.Error("UnitMap should write to the default store")
+	}
+	if err := m.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
+
+func TestTableText(t *testing.T) {
+	for table := TableCoils; table <= TableInputRegisters; table++ {
+		text, err := table.MarshalText()
+		if err != nil {
+			t.Fatalf("MarshalText() error = %v", err)
+		}
+		var parsed Table
+		if err := parsed.UnmarshalText(text); err != nil || parsed != table {
+			t.Errorf("UnmarshalText(%s) = %v, %v", text, parsed, err)
+		}
+	}
+	if _, err := ParseTable("registers"); err != ErrInvalidTable {
+		t.Errorf("Expected ErrInvalidTable, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import "sort"
+
+// Window is an inclusive range of valid addresses in a table.
+type Window struct {
+	Start uint16
+	End   uint16
+}
+
+// Contains reports whether address lies in w.
+func (w Window) Contains(address uint16) bool {
+	return address >= w.Start && address <= w.End
+}
+
+// mergeWindows sorts windows and joins the ones that overlap or touch, so a
+// range is valid exactly when it lies inside one merged window.
+func mergeWindows(windows []Window) []Window {
+	if len(windows) == 0 {
+		return nil
+	}
+	sorted := make([]Window, 0, len(windows))
+	for _, w := range windows {
+		if w.End < w.Start {
+			w.Start, w.End = w.End, w.Start
+		}
+		sorted = append(sorted, w)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	merged := sorted[:1]
+	for _, w := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if int(w.Start) <= int(last.End)+1 {
+			last.End = max(last.End, w.End)
+			continue
+		}
+		merged = append(merged, w)
+	}
+	return merged
+}
+
+// windowsCover reports whether quantity addresses from start all lie in
+// windows, which must be merged. No windows means every address is valid.
+func windowsCover(windows []Window, start uint16, quantity int) bool {
+	if windows == nil {
+		return true
+	}
+	if quantity <= 0 || int(start)+quantity > MaxSize {
+		return false
+	}
+	end := uint16(int(start) + quantity - 1)
+	i := sort.Search(len(windows), func(i int) bool { return windows[i].End >= start })
+	return i < len(windows) && windows[i].Start <= start && end <= windows[i].End
+}
@@ -0,0 +1,55 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeWindows(t *testing.T) {
+	merged := mergeWindows([]Window{{Start: 10, End: 19}, {Start: 0, End: 4}, {Start: 20, End: 24}, {Start: 3, End: 6}})
+	expected := []Window{{Start: 0, End: 6}, {Start: 10, End: 24}}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("mergeWindows() = %v, want %v", merged, expected)
+	}
+}
+
+func TestWindowsCover(t *testing.T) {
+	windows := mergeWindows([]Window{{Start: 0, End: 6}, {Start: 10, End: 24}})
+
+	tests := []struct {
+		start    uint16
+		quantity int
+		want     bool
+	}{
+		{0, 7, true},
+		{10, 15, true},
+		{5, 3, false},  // runs into the hole at 7
+		{7, 1, false},  // inside the hole
+		{20, 6, false}, // past the last window
+		{0, 0, false},
+	}
+	for _, tt := range tests {
+		if got := windowsCover(windows, tt.start, tt.quantity); got != tt.want {
+			t.Errorf("windowsCover(%d, %d) = %v, want %v", tt.start, tt.quantity, got, tt.want)
+		}
+	}
+
+	if !windowsCover(nil, 500, 10) {
+		t.Error("Expected nil windows to cover every address")
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package tag
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+// tablePrefixes are the leading digits of the Modicon reference of each
+// table: 0xxxx coils, 1xxxx discrete inputs, 4xxxx holding registers and
+// 3xxxx input registers.
+var tablePrefixes = [...]int{0, 1, 4, 3}
+
+var tableTitles = [...]string{"Coils", "Discrete Inputs", "Holding Registers", "Input Registers"}
+
+// Reference returns the 1-based Modicon reference of a 0-based address,
+// such as 40001 for holding register 0. Addresses from 9999 on use the
+// six-digit form, such as 410000 for holding register 9999.
+func Reference(table store.Table, address uint16) string {
+	if table < store.TableCoils || table > store.TableInputRegisters {
+		return ""
+	}
+	if address < 9999 {
+		return fmt.Sprintf("%d%04d", tablePrefixes[table], int(address)+1)
+	}
+	return fmt.Sprintf("%d%05d", tablePrefixes[table], int(address)+1)
+}
+
+// ParseReference returns the table and 0-based address of a five- or
+// six-digit Modicon reference, the inverse of Reference.
+func ParseReference(ref string) (store.Table, uint16, error) {
+	if len(ref) != 5 && len(ref) != 6 {
+		return 0, 0, fmt.Errorf("%w: reference %q must have 5 or 6 digits", ErrInvalidTag, ref)
+	}
+	n, err := strconv.ParseUint(ref[1:], 10, 32)
+	if err != nil || n < 1 || n > 0x10000 {
+		return 0, 0, fmt.Errorf("%w: invalid reference %q", ErrInvalidTag, ref)
+	}
+	for table, prefix := range tablePrefixes {
+		if int(ref[0]-'0') == prefix {
+			return store.Table(table), uint16(n - 1), nil
+		}
+	}
+	return 0, 0, fmt.Errorf("%w: reference %q has no table prefix 0, 1, 3 or 4", ErrInvalidTag, ref)
+}
+
+// Reference returns the Modicon reference of the first address of the tag.
+func (t Tag) Reference() string {
+	return Reference(t.Table, t.Address)
+}
+
+// docTags returns the tags in table and address order.
+func (db *DB) docTags() []Tag {
+	tags := db.Tags()
+	sort.SliceStable(tags, func(i, j int) bool {
+		if tags[i].Table != tags[j].Table {
+			return tags[i].Table < tags[j].Table
+		}
+		return tags[i].Address < tags[j].Address
+	})
+	return tags
+}
+
+// docFields returns the order, scale, offset and length columns of a tag,
+// left empty where they do not apply.
+func (t Tag) docFields() (order, scale, offset, length string) {
+	if t.Type == Bool {
+		return "", "", "", ""
+	}
+	order = t.Order.String()
+	if t.Type == BCD || t.Type == String {
+		length = strconv.Itoa(t.Length)
+	}
+	if t.Type != String {
+		scale = strconv.FormatFloat(t.scale(), 'g', -1, 64)
+		if t.Offset != 0 {
+			offset = strconv.FormatFloat(t.Offset, 'g', -1, 64)
+		}
+	}
+	return order, scale, offset, length
+}
+
+// CSVHeader is the header row written by WriteCSV.
+var CSVHeader = []string{
+	"name", "table", "address", "reference", "type", "length", "order",
+	"scale", "offset", "units", "access", "description",
+}
+
+// WriteCSV writes the register map as CSV, one row per tag in table and
+// address order, with the columns of CSVHeader. The sheet loads back as a
+// device profile with profile.ParseCSV.
+func (db *DB) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(CSVHeader)
+	for _, t := range db.docTags() {
+		order, scale, offset, length := t.docFields()
+		cw.Write([]string{
+			t.Name, t.Table.String(), strconv.Itoa(int(t.Address)), t.Reference(),
+			t.Type.String(), length, order, scale, offset, t.Units, t.Access.String(), t.Description,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteMarkdown writes the register map as Markdown with one table per
+// Modbus table, in address order. A non-empty title is written as the top
+// heading.
+func (db *DB) WriteMarkdown(w io.Writer, title string) error {
+	bw := bufio.NewWriter(w)
+	if title != "" {
+		fmt.Fprintf(bw, "# %s\n\n", mdEscape(title))
+	}
+
+	tags := db.docTags()
+	for i := 0; i < len(tags); {
+		table := tags[i].Table
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+		fmt.Fprintf(bw, "## %s (%dxxxx)\n\n", tableTitles[table], tablePrefixes[table])
+		if table == store.TableCoils || table == store.TableDiscreteInputs {
+			bw.WriteString("| Address | Reference | Name | Access | Description |\n")
+			bw.WriteString("|---:|---:|---|---|---|\n")
+		} else {
+			bw.WriteString("| Address | Reference | Name | Type | Words | Order | Scale | Offset | Units | Access | Description |\n")
+			bw.WriteString("|---:|---:|---|---|---:|---|---:|---:|---|---|---|\n")
+		}
+
+		for ; i < len(tags) && tags[i].Table == table; i++ {
+			t := tags[i]
+			address, reference := strconv.Itoa(int(t.Address)), t.Reference()
+			// 多寄存器点位显示完整的地址范围
+			if words := t.Words(); words > 1 {
+				end := t.Address + uint16(words-1)
+				address += "–" + strconv.Itoa(int(end))
+				reference += "–" + Reference(t.Table, end)
+			}
+			if t.Type == Bool {
+				fmt.Fprintf(bw, "| %s | %s | %s | %s | %s |\n",
+					address, reference, mdEscape(t.Name), t.Access, mdEscape(t.Description))
+				continue
+			}
+			order, scale, offset, _ := t.docFields()
+			fmt.Fprintf(bw, "| %s | %s | %s | %s | %d | %s | %s | %s | %s | %s | %s |\n",
+				address, reference, mdEscape(t.Name), t.Type, t.Words(), order, scale, offset,
+				mdEscape(t.Units), t.Access, mdEscape(t.Description))
+		}
+	}
+	return bw.Flush()
+}
+
+// mdEscape keeps s on one line and inside its table cell.
+func mdEscape(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.Join(strings.Fields(s), " ")
+}
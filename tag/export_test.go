@@ -0,0 +1,122 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package tag
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+func TestReference(t *testing.T) {
+	tests := []struct {
+		table   store.Table
+		address uint16
+		want    string
+	}{
+		{store.TableCoils, 0, "00001"},
+		{store.TableDiscreteInputs, 9, "10010"},
+		{store.TableHoldingRegisters, 0, "40001"},
+		{store.TableHoldingRegisters, 9998, "49999"},
+		{store.TableHoldingRegisters, 9999, "410000"},
+		{store.TableInputRegisters, 65535, "365536"},
+	}
+	for _, tt := range tests {
+		if got := Reference(tt.table, tt.address); got != tt.want {
+			t.Errorf("Reference(%s, %d) = %s; want %s", tt.table, tt.address, got, tt.want)
+		}
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	for _, ref := range []string{"00001", "10010", "40001", "49999", "410000", "400001", "365536"} {
+		table, address, err := ParseReference(ref)
+		if err != nil {
+			t.Errorf("ParseReference(%s) error = %v", ref, err)
+			continue
+		}
+		if got := Reference(table, address); got != ref && !(ref == "400001" && got == "40001") {
+			t.Errorf("ParseReference(%s) = %s %d", ref, table, address)
+		}
+	}
+	for _, ref := range []string{"", "4001", "40000", "4000001", "465537", "20001", "4x001"} {
+		if _, _, err := ParseReference(ref); !errors.Is(err, ErrInvalidTag) {
+			t.Errorf("ParseReference(%q) error = %v; want ErrInvalidTag", ref, err)
+		}
+	}
+}
+
+func TestDB_WriteCSV(t *testing.T) {
+	db, _ := newDB(t)
+	db.Add(Tag{Name: "note", Table: store.TableHoldingRegisters, Address: 0, Type: Uint16, Description: "first, \"quoted\""})
+
+	var buf bytes.Buffer
+	if err := db.WriteCSV(&buf); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not CSV: %v", err)
+	}
+	want := [][]string{
+		CSVHeader,
+		{"pump", "coils", "3", "00004", "bool", "", "", "", "", "", "read-write", ""},
+		{"note", "holding_registers", "0", "40001", "uint16", "", "ABCD", "1", "", "", "read-write", `first, "quoted"`},
+		{"setpoint", "holding_registers", "10", "40011", "float32", "", "CDAB", "1", "", "°C", "read-write", ""},
+		{"flow", "holding_registers", "20", "40021", "uint16", "", "ABCD", "0.5", "-10", "m3/h", "read-write", ""},
+		{"counter", "holding_registers", "30", "40031", "bcd", "2", "ABCD", "1", "", "", "read-write", ""},
+		{"temperature", "input_registers", "0", "30001", "int16", "", "ABCD", "0.1", "", "°C", "read-only", ""},
+		{"model", "input_registers", "100", "30101", "string", "4", "ABCD", "", "", "", "read-write", ""},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("WriteCSV() rows:\n%q\nwant:\n%q", rows, want)
+	}
+}
+
+func TestDB_WriteMarkdown(t *testing.T) {
+	db, _ := newDB(t)
+	db.Add(Tag{Name: "alarm", Table: store.TableDiscreteInputs, Address: 7, Type: Bool, Description: "high | low\nlimit"})
+
+	var buf bytes.Buffer
+	if err := db.WriteMarkdown(&buf, "PM-200"); err != nil {
+		t.Fatalf("WriteMarkdown() error = %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# PM-200\n\n## Coils (0xxxx)\n\n",
+		"| 3 | 00004 | pump | read-write |  |\n",
+		"## Discrete Inputs (1xxxx)",
+		`| 7 | 10008 | alarm | read-write | high \| low limit |`,
+		"## Holding Registers (4xxxx)",
+		"| 10–11 | 40011–40012 | setpoint | float32 | 2 | CDAB | 1 |  | °C | read-write |  |\n",
+		"| 20 | 40021 | flow | uint16 | 1 | ABCD | 0.5 | -10 | m3/h | read-write |  |\n",
+		"## Input Registers (3xxxx)",
+		"| 0 | 30001 | temperature | int16 | 1 | ABCD | 0.1 |  | °C | read-only |  |\n",
+		"| 100–103 | 30101–30104 | model | string | 4 | ABCD |  |  |  | read-write |  |\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("WriteMarkdown() output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "Holding") > strings.Index(out, "Input Registers") {
+		t.Error("tables are not in Modbus table order")
+	}
+}
@@ -0,0 +1,371 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package tag lets applications read and write a store by point name, with
+// the data type, word order and engineering-unit scaling of each point
+// declared once.
+package tag
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/hootrhino/goodbusserver/protocol"
+	"github.com/hootrhino/goodbusserver/store"
+	"github.com/hootrhino/goodbusserver/typed"
+)
+
+var (
+	ErrUnknownTag   = errors.New("tag: unknown tag")
+	ErrDuplicateTag = errors.New("tag: duplicate tag name")
+	ErrInvalidTag   = errors.New("tag: invalid tag")
+	// ErrTypeMismatch is returned when a tag is read or written as a kind
+	// of value it does not hold, such as a string tag read as a number.
+	ErrTypeMismatch = errors.New("tag: type mismatch")
+	// ErrOutOfRange is returned when a written value does not fit the raw
+	// type of the tag after scaling.
+	ErrOutOfRange = errors.New("tag: value out of range")
+)
+
+// Tag is a named point of a device model. The engineering value of a
+// numeric tag is raw × Scale + Offset.
+type Tag struct {
+	Name    string             `json:"name"`
+	Table   store.Table        `json:"table"`
+	Address uint16             `json:"address"`
+	Type    DataType           `json:"type"`
+	Order   protocol.WordOrder `json:"order"`
+	// Length is the number of registers of BCD and string tags.
+	Length int `json:"length,omitempty"`
+	// Scale multiplies the raw value; 0 means 1.
+	Scale  float64 `json:"scale,omitempty"`
+	Offset float64 `json:"offset,omitempty"`
+	Units  string  `json:"units,omitempty"`
+	// Access is the access mode Modbus clients get, see DB.AccessRules.
+	// The application may always read and write a tag.
+	Access      store.Access `json:"access"`
+	Description string       `json:"description,omitempty"`
+}
+
+// Words returns the number of addresses the tag occupies.
+func (t Tag) Words() int {
+	return t.Type.Words(t.Length)
+}
+
+// Window returns the addresses the tag occupies.
+func (t Tag) Window() store.Window {
+	return store.Window{Start: t.Address, End: t.Address + uint16(t.Words()-1)}
+}
+
+func (t Tag) scale() float64 {
+	if t.Scale == 0 {
+		return 1
+	}
+	return t.Scale
+}
+
+// Validate checks that the type suits the table, that the tag fits in the
+// address space and that Modbus clients may read or write it.
+func (t Tag) Validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("%w: empty name", ErrInvalidTag)
+	}
+	bitTable := t.Table == store.TableCoils || t.Table == store.TableDiscreteInputs
+	switch {
+	case t.Table < store.TableCoils || t.Table > store.TableInputRegisters:
+		return fmt.Errorf("%w: %s: unknown table", ErrInvalidTag, t.Name)
+	case t.Type < Bool || t.Type > String:
+		return fmt.Errorf("%w: %s: unknown type", ErrInvalidTag, t.Name)
+	case bitTable != (t.Type == Bool):
+		return fmt.Errorf("%w: %s: type %s cannot live in %s", ErrInvalidTag, t.Name, t.Type, t.Table)
+	case t.Type == BCD && (t.Length < 1 || t.Length > 4):
+		return fmt.Errorf("%w: %s: BCD length must be 1-4 registers", ErrInvalidTag, t.Name)
+	case t.Type == String && t.Length < 1:
+		return fmt.Errorf("%w: %s: string length must be at least 1 register", ErrInvalidTag, t.Name)
+	case int(t.Address)+t.Words() > store.MaxSize:
+		return fmt.Errorf("%w: %s: runs past the end of the table", ErrInvalidTag, t.Name)
+	case t.Order < protocol.ABCD || t.Order > protocol.DCBA:
+		return fmt.Errorf("%w: %s: unknown word order", ErrInvalidTag, t.Name)
+	case t.Access != store.AccessReadWrite && t.Access != store.AccessReadOnly && t.Access != store.AccessWriteOnly:
+		return fmt.Errorf("%w: %s: access must be read-write, read-only or write-only", ErrInvalidTag, t.Name)
+	}
+	return nil
+}
+
+// DB holds the tags of one store.
+type DB struct {
+	st    store.Store
+	mu    sync.RWMutex
+	tags  map[string]Tag
+	names []string
+}
+
+// NewDB returns a tag database over st holding tags.
+func NewDB(st store.Store, tags ...Tag) (*DB, error) {
+	db := &DB{st: st, tags: make(map[string]Tag)}
+	for _, t := range tags {
+		if err := db.Add(t); err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// Store returns the store the tags map to.
+func (db *DB) Store() store.Store {
+	return db.st
+}
+
+// Add declares a tag. Tags may overlap, for example to view one register
+// both raw and scaled.
+func (db *DB) Add(t Tag) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if _, ok := db.tags[t.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateTag, t.Name)
+	}
+	db.tags[t.Name] = t
+	db.names = append(db.names, t.Name)
+	return nil
+}
+
+// Tag returns the tag with the given name.
+func (db *DB) Tag(name string) (Tag, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	t, ok := db.tags[name]
+	return t, ok
+}
+
+// Tags returns every tag in the order they were added.
+func (db *DB) Tags() []Tag {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	tags := make([]Tag, len(db.names))
+	for i, name := range db.names {
+		tags[i] = db.tags[name]
+	}
+	return tags
+}
+
+// AccessRules returns a rule for every tag that is not read-write, for use
+// in a store.AccessMap. Empty units applies the rules to every unit.
+func (db *DB) AccessRules(units ...byte) []store.AccessRule {
+	var rules []store.AccessRule
+	for _, t := range db.Tags() {
+		if t.Access == store.AccessReadWrite {
+			continue
+		}
+		rules = append(rules, store.AccessRule{Units: units, Table: t.Table, Window: t.Window(), Access: t.Access})
+	}
+	return rules
+}
+
+func (db *DB) lookup(name string) (Tag, error) {
+	t, ok := db.Tag(name)
+	if !ok {
+		return Tag{}, fmt.Errorf("%w: %s", ErrUnknownTag, name)
+	}
+	return t, nil
+}
+
+// Read returns the engineering value of a numeric tag, or 0 or 1 for a
+// bool tag. 64-bit integers beyond ±2^53 lose precision; read them with
+// the typed package instead.
+func (db *DB) Read(name string) (float64, error) {
+	t, err := db.lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	if t.Type == Bool {
+		on, err := readBool(db.st, t)
+		if on {
+			return 1, err
+		}
+		return 0, err
+	}
+
+	raw, err := readRaw(db.view(t), t)
+	if err != nil {
+		return 0, err
+	}
+	return raw*t.scale() + t.Offset, nil
+}
+
+// Write stores the engineering value of a numeric tag, or sets a bool tag
+// when value is not 0. Integer tags are rounded to the nearest raw value.
+func (db *DB) Write(name string, value float64) error {
+	t, err := db.lookup(name)
+	if err != nil {
+		return err
+	}
+	if t.Type == Bool {
+		return writeBool(db.st, t, value != 0)
+	}
+	if t.Type == String {
+		return fmt.Errorf("%w: %s is a string", ErrTypeMismatch, name)
+	}
+
+	raw := (value - t.Offset) / t.scale()
+	if lo, hi, ok := t.Type.rawRange(t.Length); ok {
+		raw = math.Round(raw)
+		if math.IsNaN(raw) || raw < lo || raw >= hi {
+			return fmt.Errorf("%w: %s = %v", ErrOutOfRange, name, value)
+		}
+	}
+	return writeRaw(db.view(t), t, raw)
+}
+
+// ReadBool returns the state of a bool tag.
+func (db *DB) ReadBool(name string) (bool, error) {
+	t, err := db.lookup(name)
+	if err != nil {
+		return false, err
+	}
+	if t.Type != Bool {
+		return false, fmt.Errorf("%w: %s is %s", ErrTypeMismatch, name, t.Type)
+	}
+	return readBool(db.st, t)
+}
+
+// WriteBool sets a bool tag.
+func (db *DB) WriteBool(name string, on bool) error {
+	t, err := db.lookup(name)
+	if err != nil {
+		return err
+	}
+	if t.Type != Bool {
+		return fmt.Errorf("%w: %s is %s", ErrTypeMismatch, name, t.Type)
+	}
+	return writeBool(db.st, t, on)
+}
+
+// ReadString returns the value of a string tag.
+func (db *DB) ReadString(name string) (string, error) {
+	t, err := db.lookup(name)
+	if err != nil {
+		return "", err
+	}
+	if t.Type != String {
+		return "", fmt.Errorf("%w: %s is %s", ErrTypeMismatch, name, t.Type)
+	}
+	return db.view(t).String(t.Address, t.Length, t.Order)
+}
+
+// WriteString stores s in a string tag, cut to its length.
+func (db *DB) WriteString(name, s string) error {
+	t, err := db.lookup(name)
+	if err != nil {
+		return err
+	}
+	if t.Type != String {
+		return fmt.Errorf("%w: %s is %s", ErrTypeMismatch, name, t.Type)
+	}
+	return db.view(t).SetString(t.Address, s, t.Length, t.Order)
+}
+
+func (db *DB) view(t Tag) *typed.View {
+	if t.Table == store.TableInputRegisters {
+		return typed.Input(db.st)
+	}
+	return typed.Holding(db.st)
+}
+
+func readBool(st store.Store, t Tag) (bool, error) {
+	get := st.GetCoils
+	if t.Table == store.TableDiscreteInputs {
+		get = st.GetDiscreteInputs
+	}
+	bits, err := get(t.Address, 1)
+	if err != nil {
+		return false, err
+	}
+	return bits[0] != 0, nil
+}
+
+func writeBool(st store.Store, t Tag, on bool) error {
+	set := st.SetCoilsAt
+	if t.Table == store.TableDiscreteInputs {
+		set = st.SetDiscreteInputsAt
+	}
+	var bit byte
+	if on {
+		bit = 1
+	}
+	return set(t.Address, []byte{bit})
+}
+
+func readRaw(v *typed.View, t Tag) (float64, error) {
+	a, o := t.Address, t.Order
+	switch t.Type {
+	case Int16:
+		raw, err := v.Int16(a, o)
+		return float64(raw), err
+	case Uint16:
+		raw, err := v.Uint16(a, o)
+		return float64(raw), err
+	case Int32:
+		raw, err := v.Int32(a, o)
+		return float64(raw), err
+	case Uint32:
+		raw, err := v.Uint32(a, o)
+		return float64(raw), err
+	case Int64:
+		raw, err := v.Int64(a, o)
+		return float64(raw), err
+	case Uint64:
+		raw, err := v.Uint64(a, o)
+		return float64(raw), err
+	case Float32:
+		raw, err := v.Float32(a, o)
+		return float64(raw), err
+	case Float64:
+		return v.Float64(a, o)
+	case BCD:
+		raw, err := v.BCD(a, t.Length, o)
+		return float64(raw), err
+	}
+	return 0, fmt.Errorf("%w: %s is %s", ErrTypeMismatch, t.Name, t.Type)
+}
+
+func writeRaw(v *typed.View, t Tag, raw float64) error {
+	a, o := t.Address, t.Order
+	switch t.Type {
+	case Int16:
+		return v.SetInt16(a, int16(raw), o)
+	case Uint16:
+		return v.SetUint16(a, uint16(raw), o)
+	case Int32:
+		return v.SetInt32(a, int32(raw), o)
+	case Uint32:
+		return v.SetUint32(a, uint32(raw), o)
+	case Int64:
+		return v.SetInt64(a, int64(raw), o)
+	case Uint64:
+		return v.SetUint64(a, uint64(raw), o)
+	case Float32:
+		return v.SetFloat32(a, float32(raw), o)
+	case Float64:
+		return v.SetFloat64(a, raw, o)
+	case BCD:
+		return v.SetBCD(a, uint64(raw), t.Length, o)
+	}
+	return fmt.Errorf("%w: %s is %s", ErrTypeMismatch, t.Name, t.Type)
+}
@@ -0,0 +1,180 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package tag
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/hootrhino/goodbusserver/protocol"
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+func newDB(t *testing.T) (*DB, store.Store) {
+	t.Helper()
+	st := store.NewInMemoryStore()
+	db, err := NewDB(st,
+		Tag{Name: "temperature", Table: store.TableInputRegisters, Address: 0, Type: Int16, Scale: 0.1, Units: "°C", Access: store.AccessReadOnly},
+		Tag{Name: "setpoint", Table: store.TableHoldingRegisters, Address: 10, Type: Float32, Order: protocol.CDAB, Units: "°C"},
+		Tag{Name: "flow", Table: store.TableHoldingRegisters, Address: 20, Type: Uint16, Scale: 0.5, Offset: -10, Units: "m3/h"},
+		Tag{Name: "counter", Table: store.TableHoldingRegisters, Address: 30, Type: BCD, Length: 2},
+		Tag{Name: "pump", Table: store.TableCoils, Address: 3, Type: Bool},
+		Tag{Name: "model", Table: store.TableInputRegisters, Address: 100, Type: String, Length: 4},
+	)
+	if err != nil {
+		t.Fatalf("NewDB() error = %v", err)
+	}
+	return db, st
+}
+
+func TestDB_Scaling(t *testing.T) {
+	db, st := newDB(t)
+
+	st.SetInputRegistersAt(0, []uint16{uint16(0xFFFF - 54)}) // raw -55
+	if got, err := db.Read("temperature"); err != nil || got != -5.5 {
+		t.Errorf("Read(temperature) = %v, %v; want -5.5", got, err)
+	}
+
+	if err := db.Write("temperature", 21.7); err != nil {
+		t.Fatalf("Write(temperature) error = %v", err)
+	}
+	if raw, _ := st.GetInputRegisters(0, 1); raw[0] != 217 {
+		t.Errorf("temperature raw = %d; want 217", raw[0])
+	}
+
+	db.Write("flow", 40)
+	if raw, _ := st.GetHoldingRegisters(20, 1); raw[0] != 100 {
+		t.Errorf("flow raw = %d; want (40 + 10) / 0.5 = 100", raw[0])
+	}
+	if got, _ := db.Read("flow"); got != 40 {
+		t.Errorf("Read(flow) = %v; want 40", got)
+	}
+	if err := db.Write("flow", -20); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("Write(flow, -20) error = %v; want ErrOutOfRange", err)
+	}
+
+	db.Write("setpoint", 23.5)
+	if raw, _ := st.GetHoldingRegisters(10, 2); !reflect.DeepEqual(raw, []uint16{0x0000, 0x41BC}) {
+		t.Errorf("setpoint raw = %04X; want [0000 41BC]", raw)
+	}
+
+	db.Write("counter", 1234567)
+	if raw, _ := st.GetHoldingRegisters(30, 2); !reflect.DeepEqual(raw, []uint16{0x0123, 0x4567}) {
+		t.Errorf("counter raw = %04X; want [0123 4567]", raw)
+	}
+	if err := db.Write("counter", 1e8); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("Write(counter, 1e8) error = %v; want ErrOutOfRange", err)
+	}
+}
+
+func TestDB_BoolAndString(t *testing.T) {
+	db, st := newDB(t)
+
+	if err := db.WriteBool("pump", true); err != nil {
+		t.Fatalf("WriteBool() error = %v", err)
+	}
+	if bits, _ := st.GetCoils(3, 1); bits[0] != 1 {
+		t.Errorf("pump coil = %d; want 1", bits[0])
+	}
+	if on, _ := db.ReadBool("pump"); !on {
+		t.Error("ReadBool(pump) = false")
+	}
+	if got, _ := db.Read("pump"); got != 1 {
+		t.Errorf("Read(pump) = %v; want 1", got)
+	}
+
+	db.WriteString("model", "MX-200")
+	if got, _ := db.ReadString("model"); got != "MX-200" {
+		t.Errorf("ReadString(model) = %q", got)
+	}
+
+	if _, err := db.Read("model"); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Read(model) error = %v; want ErrTypeMismatch", err)
+	}
+	if _, err := db.ReadBool("flow"); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("ReadBool(flow) error = %v; want ErrTypeMismatch", err)
+	}
+	if _, err := db.Read("missing"); !errors.Is(err, ErrUnknownTag) {
+		t.Errorf("Read(missing) error = %v; want ErrUnknownTag", err)
+	}
+}
+
+func TestDB_Add(t *testing.T) {
+	db, _ := newDB(t)
+
+	tests := []struct {
+		tag  Tag
+		want error
+	}{
+		{Tag{Name: "pump", Table: store.TableCoils, Type: Bool}, ErrDuplicateTag},
+		{Tag{Name: "bad", Table: store.TableCoils, Type: Int16}, ErrInvalidTag},
+		{Tag{Name: "bad", Table: store.TableHoldingRegisters, Type: Bool}, ErrInvalidTag},
+		{Tag{Name: "bad", Table: store.TableHoldingRegisters, Type: String}, ErrInvalidTag},
+		{Tag{Name: "bad", Table: store.TableHoldingRegisters, Address: 65535, Type: Float32}, ErrInvalidTag},
+		{Tag{Table: store.TableHoldingRegisters, Type: Int16}, ErrInvalidTag},
+		{Tag{Name: "bad", Table: store.TableHoldingRegisters, Type: Int16, Access: store.AccessNone}, ErrInvalidTag},
+		{Tag{Name: "bad", Table: store.TableHoldingRegisters, Type: Int16, Access: 9}, ErrInvalidTag},
+	}
+	for _, tt := range tests {
+		if err := db.Add(tt.tag); !errors.Is(err, tt.want) {
+			t.Errorf("Add(%+v) error = %v; want %v", tt.tag, err, tt.want)
+		}
+	}
+
+	names := []string{}
+	for _, tag := range db.Tags() {
+		names = append(names, tag.Name)
+	}
+	want := []string{"temperature", "setpoint", "flow", "counter", "pump", "model"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Tags() = %v; want %v", names, want)
+	}
+}
+
+func TestDB_AccessRules(t *testing.T) {
+	db, _ := newDB(t)
+	rules := db.AccessRules(1)
+	want := []store.AccessRule{{
+		Units:  []byte{1},
+		Table:  store.TableInputRegisters,
+		Window: store.Window{Start: 0, End: 0},
+		Access: store.AccessReadOnly,
+	}}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("AccessRules() = %+v; want %+v", rules, want)
+	}
+}
+
+func TestTag_JSON(t *testing.T) {
+	db, _ := newDB(t)
+	setpoint, _ := db.Tag("setpoint")
+
+	data, err := json.Marshal(setpoint)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	want := `{"name":"setpoint","table":"holding_registers","address":10,"type":"float32","order":"CDAB","units":"°C","access":"read-write"}`
+	if string(data) != want {
+		t.Errorf("Marshal() = %s; want %s", data, want)
+	}
+
+	var back Tag
+	if err := json.Unmarshal(data, &back); err != nil || back != setpoint {
+		t.Errorf("Unmarshal() = %+v, %v", back, err)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package tag
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// DataType is the type of the value a tag holds.
+type DataType int
+
+const (
+	// Bool is a coil or discrete input.
+	Bool DataType = iota
+	Int16
+	Uint16
+	Int32
+	Uint32
+	Int64
+	Uint64
+	Float32
+	Float64
+	// BCD is an unsigned packed BCD value of Tag.Length registers.
+	BCD
+	// String is an ASCII string of Tag.Length registers.
+	String
+)
+
+var typeNames = [...]string{"bool", "int16", "uint16", "int32", "uint32", "int64", "uint64", "float32", "float64", "bcd", "string"}
+
+func (t DataType) String() string {
+	if t < Bool || t > String {
+		return "unknown"
+	}
+	return typeNames[t]
+}
+
+// ParseDataType returns the type named by DataType.String, in any case.
+func ParseDataType(name string) (DataType, error) {
+	for i, n := range typeNames {
+		if strings.EqualFold(n, name) {
+			return DataType(i), nil
+		}
+	}
+	return 0, fmt.Errorf("tag: unknown data type %q", name)
+}
+
+// MarshalText encodes the type as its name.
+func (t DataType) MarshalText() ([]byte, error) {
+	if t < Bool || t > String {
+		return nil, fmt.Errorf("tag: unknown data type %d", int(t))
+	}
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText decodes a type name.
+func (t *DataType) UnmarshalText(text []byte) error {
+	parsed, err := ParseDataType(string(text))
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// Words returns the number of registers a value of the type occupies, or
+// length for BCD and strings. Bool occupies one coil or discrete input.
+func (t DataType) Words(length int) int {
+	switch t {
+	case Bool, Int16, Uint16:
+		return 1
+	case Int32, Uint32, Float32:
+		return 2
+	case Int64, Uint64, Float64:
+		return 4
+	}
+	return length
+}
+
+// rawRange returns the range [lo, hi) of the raw integer types, BCD
+// included; ok is false for the others. The bounds are exact in float64.
+func (t DataType) rawRange(length int) (lo, hi float64, ok bool) {
+	switch t {
+	case Int16:
+		return math.MinInt16, 1 << 15, true
+	case Uint16:
+		return 0, 1 << 16, true
+	case Int32:
+		return math.MinInt32, 1 << 31, true
+	case Uint32:
+		return 0, 1 << 32, true
+	case Int64:
+		return math.MinInt64, 1 << 63, true
+	case Uint64:
+		return 0, 1 << 64, true
+	case BCD:
+		return 0, math.Pow10(4 * length), true
+	}
+	return 0, 0, false
+}
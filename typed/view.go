@@ -0,0 +1,220 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package typed reads and writes integers, floats, BCD and strings that span
+// one or more registers of a store.
+package typed
+
+import (
+	"encoding/binary"
+
+	"github.com/hootrhino/goodbusserver/protocol"
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+// WordOrder is the register layout of a multi-register value, see
+// protocol.WordOrder.
+type WordOrder = protocol.WordOrder
+
+const (
+	ABCD = protocol.ABCD
+	CDAB = protocol.CDAB
+	BADC = protocol.BADC
+	DCBA = protocol.DCBA
+)
+
+// View gives typed access to the holding or input registers of a store.
+// Addresses are 0-based register addresses. A value spanning several
+// registers is read with one store call and written with one, so it is
+// never seen half written.
+type View struct {
+	st    store.Store
+	table store.Table
+}
+
+// Holding returns a view of the holding registers of st.
+func Holding(st store.Store) *View {
+	return &View{st: st, table: store.TableHoldingRegisters}
+}
+
+// Input returns a view of the input registers of st.
+func Input(st store.Store) *View {
+	return &View{st: st, table: store.TableInputRegisters}
+}
+
+// NewView returns a view of a register table of st.
+func NewView(st store.Store, table store.Table) (*View, error) {
+	if table != store.TableHoldingRegisters && table != store.TableInputRegisters {
+		return nil, store.ErrInvalidTable
+	}
+	return &View{st: st, table: table}, nil
+}
+
+// Table returns the table the view reads and writes.
+func (v *View) Table() store.Table {
+	return v.table
+}
+
+// Words reads n raw registers from address.
+func (v *View) Words(address uint16, n int) ([]uint16, error) {
+	if n <= 0 || n > 0xFFFF {
+		return nil, store.ErrInvalidAddress
+	}
+	if v.table == store.TableInputRegisters {
+		return v.st.GetInputRegisters(address, uint16(n))
+	}
+	return v.st.GetHoldingRegisters(address, uint16(n))
+}
+
+// SetWords writes raw registers from address.
+func (v *View) SetWords(address uint16, words []uint16) error {
+	if v.table == store.TableInputRegisters {
+		return v.st.SetInputRegistersAt(address, words)
+	}
+	return v.st.SetHoldingRegistersAt(address, words)
+}
+
+func (v *View) Uint16(address uint16, order WordOrder) (uint16, error) {
+	words, err := v.Words(address, 1)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(order.FromWords(words)), nil
+}
+
+func (v *View) SetUint16(address uint16, value uint16, order WordOrder) error {
+	return v.SetWords(address, order.ToWords(binary.BigEndian.AppendUint16(nil, value)))
+}
+
+func (v *View) Int16(address uint16, order WordOrder) (int16, error) {
+	words, err := v.Words(address, 1)
+	if err != nil {
+		return 0, err
+	}
+	return protocol.DecodeInt16(words, order), nil
+}
+
+func (v *View) SetInt16(address uint16, value int16, order WordOrder) error {
+	return v.SetWords(address, protocol.EncodeInt16(value, order))
+}
+
+func (v *View) Uint32(address uint16, order WordOrder) (uint32, error) {
+	words, err := v.Words(address, 2)
+	if err != nil {
+		return 0, err
+	}
+	return protocol.DecodeUint32(words, order), nil
+}
+
+func (v *View) SetUint32(address uint16, value uint32, order WordOrder) error {
+	return v.SetWords(address, protocol.EncodeUint32(value, order))
+}
+
+func (v *View) Int32(address uint16, order WordOrder) (int32, error) {
+	words, err := v.Words(address, 2)
+	if err != nil {
+		return 0, err
+	}
+	return protocol.DecodeInt32(words, order), nil
+}
+
+func (v *View) SetInt32(address uint16, value int32, order WordOrder) error {
+	return v.SetWords(address, protocol.EncodeInt32(value, order))
+}
+
+func (v *View) Uint64(address uint16, order WordOrder) (uint64, error) {
+	words, err := v.Words(address, 4)
+	if err != nil {
+		return 0, err
+	}
+	return protocol.DecodeUint64(words, order), nil
+}
+
+func (v *View) SetUint64(address uint16, value uint64, order WordOrder) error {
+	return v.SetWords(address, protocol.EncodeUint64(value, order))
+}
+
+func (v *View) Int64(address uint16, order WordOrder) (int64, error) {
+	words, err := v.Words(address, 4)
+	if err != nil {
+		return 0, err
+	}
+	return protocol.DecodeInt64(words, order), nil
+}
+
+func (v *View) SetInt64(address uint16, value int64, order WordOrder) error {
+	return v.SetWords(address, protocol.EncodeInt64(value, order))
+}
+
+func (v *View) Float32(address uint16, order WordOrder) (float32, error) {
+	words, err := v.Words(address, 2)
+	if err != nil {
+		return 0, err
+	}
+	return protocol.DecodeFloat32(words, order), nil
+}
+
+func (v *View) SetFloat32(address uint16, value float32, order WordOrder) error {
+	return v.SetWords(address, protocol.EncodeFloat32(value, order))
+}
+
+func (v *View) Float64(address uint16, order WordOrder) (float64, error) {
+	words, err := v.Words(address, 4)
+	if err != nil {
+		return 0, err
+	}
+	return protocol.DecodeFloat64(words, order), nil
+}
+
+func (v *View) SetFloat64(address uint16, value float64, order WordOrder) error {
+	return v.SetWords(address, protocol.EncodeFloat64(value, order))
+}
+
+// BCD reads an unsigned packed BCD value of n registers, four digits each.
+func (v *View) BCD(address uint16, n int, order WordOrder) (uint64, error) {
+	words, err := v.Words(address, n)
+	if err != nil {
+		return 0, err
+	}
+	return protocol.DecodeBCD(words, order)
+}
+
+// SetBCD writes value as packed BCD into n registers.
+func (v *View) SetBCD(address uint16, value uint64, n int, order WordOrder) error {
+	words, err := protocol.EncodeBCD(value, n, order)
+	if err != nil {
+		return err
+	}
+	return v.SetWords(address, words)
+}
+
+// String reads an ASCII string of n registers, two characters each, see
+// protocol.DecodeString.
+func (v *View) String(address uint16, n int, order WordOrder) (string, error) {
+	words, err := v.Words(address, n)
+	if err != nil {
+		return "", err
+	}
+	return protocol.DecodeString(words, order), nil
+}
+
+// SetString writes s into n registers, padded with NUL bytes and cut to
+// fit.
+func (v *View) SetString(address uint16, s string, n int, order WordOrder) error {
+	if n <= 0 {
+		return store.ErrInvalidAddress
+	}
+	return v.SetWords(address, protocol.EncodeString(s, n, order))
+}
@@ -0,0 +1,106 @@
+// Copyright (C) 2025 wwhai
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package typed
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/hootrhino/goodbusserver/store"
+)
+
+func TestView_Float32(t *testing.T) {
+	st := store.NewInMemoryStore(store.WithFullAddressSpace())
+	v := Holding(st)
+
+	if err := v.SetFloat32(40100, 23.5, CDAB); err != nil {
+		t.Fatalf("SetFloat32() error = %v", err)
+	}
+	raw, _ := st.GetHoldingRegisters(40100, 2)
+	if !reflect.DeepEqual(raw, []uint16{0x0000, 0x41BC}) {
+		t.Errorf("registers = %04X; want [0000 41BC]", raw)
+	}
+	if got, err := v.Float32(40100, CDAB); err != nil || got != 23.5 {
+		t.Errorf("Float32() = %v, %v; want 23.5", got, err)
+	}
+	if got, _ := v.Float32(40100, ABCD); got == 23.5 {
+		t.Error("Float32() ignored the word order")
+	}
+}
+
+func TestView_Types(t *testing.T) {
+	v := Input(store.NewInMemoryStore())
+
+	v.SetInt16(0, -5, ABCD)
+	v.SetUint16(1, 0x1234, BADC)
+	v.SetInt32(2, -70000, DCBA)
+	v.SetUint32(4, 4000000000, CDAB)
+	v.SetInt64(6, -1, ABCD)
+	v.SetUint64(10, 1<<40, CDAB)
+	v.SetFloat64(14, 0.1, BADC)
+	v.SetBCD(18, 2025, 1, ABCD)
+	v.SetString(19, "SN-42", 3, ABCD)
+
+	if got, _ := v.Int16(0, ABCD); got != -5 {
+		t.Errorf("Int16() = %d", got)
+	}
+	if raw, _ := v.Words(1, 1); raw[0] != 0x3412 {
+		t.Errorf("Uint16 BADC register = %04X; want 3412", raw[0])
+	}
+	if got, _ := v.Uint16(1, BADC); got != 0x1234 {
+		t.Errorf("Uint16() = %04X", got)
+	}
+	if got, _ := v.Int32(2, DCBA); got != -70000 {
+		t.Errorf("Int32() = %d", got)
+	}
+	if got, _ := v.Uint32(4, CDAB); got != 4000000000 {
+		t.Errorf("Uint32() = %d", got)
+	}
+	if got, _ := v.Int64(6, ABCD); got != -1 {
+		t.Errorf("Int64() = %d", got)
+	}
+	if got, _ := v.Uint64(10, CDAB); got != 1<<40 {
+		t.Errorf("Uint64() = %d", got)
+	}
+	if got, _ := v.Float64(14, BADC); got != 0.1 {
+		t.Errorf("Float64() = %v", got)
+	}
+	if raw, _ := v.Words(18, 1); raw[0] != 0x2025 {
+		t.Errorf("BCD register = %04X; want 2025", raw[0])
+	}
+	if got, _ := v.BCD(18, 1, ABCD); got != 2025 {
+		t.Errorf("BCD() = %d", got)
+	}
+	if got, _ := v.String(19, 3, ABCD); got != "SN-42" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestView_Errors(t *testing.T) {
+	st := store.NewInMemoryStore(store.WithTableSize(store.TableHoldingRegisters, 10))
+	v := Holding(st)
+
+	if err := v.SetFloat64(8, 1, ABCD); !errors.Is(err, store.ErrInvalidAddress) {
+		t.Errorf("SetFloat64() past the end error = %v", err)
+	}
+	if _, err := v.Uint32(9, ABCD); !errors.Is(err, store.ErrInvalidAddress) {
+		t.Errorf("Uint32() past the end error = %v", err)
+	}
+	if _, err := NewView(st, store.TableCoils); !errors.Is(err, store.ErrInvalidTable) {
+		t.Errorf("NewView(coils) error = %v", err)
+	}
+}